@@ -0,0 +1,133 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Anchors are positions in a document that move with the edits, to refer to
+// lines that may be moved by other edits, like the lines marked by
+// document_global.
+//
+// The anchors are kept sorted by offset, so an edit only visits the anchors
+// after it. The edits keep the order: the anchors in a deleted range all move
+// to its start.
+
+package editor
+
+import (
+	"bytes"
+	"sort"
+)
+
+// anchor is a position in a document that moves with the edits.
+type anchor struct {
+	offset  int  // Byte offset in the content.
+	deleted bool // The line of the anchor was deleted, offset is where it was.
+}
+
+// firstAnchor returns the index of the first anchor at or after offset.
+func (d *document) firstAnchor(offset int) int {
+	return sort.Search(len(d.anchors), func(i int) bool {
+		return d.anchors[i].offset >= offset
+	})
+}
+
+// addAnchor returns a new anchor at offset. It must be removed with
+// removeAnchor once not needed anymore.
+func (d *document) addAnchor(offset int) *anchor {
+	a := &anchor{offset: offset}
+	i := d.firstAnchor(offset)
+	d.anchors = append(d.anchors, nil)
+	copy(d.anchors[i+1:], d.anchors[i:])
+	d.anchors[i] = a
+	return a
+}
+
+// indexAnchor returns the index of a, -1 if it is not in the document.
+func (d *document) indexAnchor(a *anchor) int {
+	for i := d.firstAnchor(a.offset); i < len(d.anchors) && d.anchors[i].offset == a.offset; i++ {
+		if d.anchors[i] == a {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *document) removeAnchor(a *anchor) {
+	if i := d.indexAnchor(a); i != -1 {
+		copy(d.anchors[i:], d.anchors[i+1:])
+		d.anchors[len(d.anchors)-1] = nil
+		d.anchors = d.anchors[:len(d.anchors)-1]
+	}
+}
+
+// removeAnchors removes many anchors at once, in a single pass.
+func (d *document) removeAnchors(as []*anchor) {
+	remove := make(map[*anchor]bool, len(as))
+	for _, a := range as {
+		remove[a] = true
+	}
+	out := d.anchors[:0]
+	for _, a := range d.anchors {
+		if !remove[a] {
+			out = append(out, a)
+		}
+	}
+	for i := len(out); i < len(d.anchors); i++ {
+		d.anchors[i] = nil
+	}
+	d.anchors = out
+}
+
+// moveAnchor moves an anchor to offset.
+func (d *document) moveAnchor(a *anchor, offset int) {
+	d.removeAnchor(a)
+	a.offset = offset
+	i := d.firstAnchor(offset)
+	d.anchors = append(d.anchors, nil)
+	copy(d.anchors[i+1:], d.anchors[i:])
+	d.anchors[i] = a
+}
+
+// moveAnchorsInsert moves the anchors after n bytes inserted at offset. The
+// anchors at offset move with the text after them.
+func (d *document) moveAnchorsInsert(offset, n int) {
+	for _, a := range d.anchors[d.firstAnchor(offset):] {
+		a.offset += n
+	}
+}
+
+// moveAnchorsDelete moves the anchors before the bytes in [start, end) are
+// deleted. An anchor inside the range is deleted if its line terminator is
+// deleted too.
+func (d *document) moveAnchorsDelete(start, end int) {
+	i := d.firstAnchor(start)
+	if i == len(d.anchors) {
+		return
+	}
+	// The anchors before the last line terminator of the range lose their
+	// line.
+	lastNewline := -1
+	if d.anchors[i].offset < end {
+		if j := bytes.LastIndexByte(d.content.Range(start, end), '\n'); j != -1 {
+			lastNewline = start + j
+		}
+	}
+	for _, a := range d.anchors[i:] {
+		if a.offset >= end {
+			a.offset -= end - start
+		} else {
+			if a.offset <= lastNewline {
+				a.deleted = true
+			}
+			a.offset = start
+		}
+	}
+}
+
+// clampAnchors keeps the anchors in the content after it was replaced as a
+// whole, like on undo.
+func (d *document) clampAnchors() {
+	n := d.content.Len()
+	for _, a := range d.anchors[d.firstAnchor(n):] {
+		a.offset = n
+	}
+}
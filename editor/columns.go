@@ -0,0 +1,177 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Display columns of a documentView. A tab is shown up to the next multiple of
+// tabWidth. When columnMode is set, the cursor moves freely on the display
+// columns: it can be past the end of a line or inside a tab, and typing there
+// first fills the virtual space with spaces.
+
+package editor
+
+import (
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+)
+
+// tabWidth is the number of display columns between two tab stops.
+const tabWidth = 8
+
+// runeWidth returns the number of display columns of r at display column x.
+func runeWidth(r rune, x int) int {
+	if r == '\t' {
+		return tabWidth - x%tabWidth
+	}
+	return 1
+}
+
+// displayColumn returns the display column of the rune at col. The columns
+// past the end of the line are one display column each.
+func displayColumn(runes []rune, col int) int {
+	x := 0
+	for i := 0; i < col && i < len(runes); i++ {
+		x += runeWidth(runes[i], x)
+	}
+	if col > len(runes) {
+		x += col - len(runes)
+	}
+	return x
+}
+
+// cellWidth returns the number of display columns of the rune at col. The
+// line terminator and the columns past it are one display column.
+func cellWidth(runes []rune, col int) int {
+	if col >= len(runes) {
+		return 1
+	}
+	return runeWidth(runes[col], displayColumn(runes, col))
+}
+
+// columnAt returns the column of the rune shown at display column x and the
+// position of x inside the rune. Past the end of the line, the column is past
+// the end too and the position is 0.
+func columnAt(runes []rune, x int) (int, int) {
+	d := 0
+	for i, r := range runes {
+		w := runeWidth(r, d)
+		if x < d+w {
+			return i, x - d
+		}
+		d += w
+	}
+	return len(runes) + x - d, 0
+}
+
+// columnAdd returns the position of the primary cursor inside a tab, in
+// display columns.
+func (v *documentView) columnAdd() int {
+	if v.movingSecondary || v.colAddCursor != v.primary() {
+		return 0
+	}
+	return v.colAdd
+}
+
+// virtualColumn returns the display column of the primary cursor.
+func (v *documentView) virtualColumn() int {
+	return displayColumn([]rune(v.document.line(v.cursorLine)), v.cursorColumn) + v.columnAdd()
+}
+
+// displayToColumn returns the column of the rune shown at display column x of
+// a line. Without columnMode, it stays inside the line.
+func (v *documentView) displayToColumn(line, x int) int {
+	col, _ := columnAt([]rune(v.document.line(line)), x)
+	if n := v.document.lineLength(line); col > n && !v.columnMode {
+		col = n
+	}
+	return col
+}
+
+// setVirtualColumn moves the primary cursor to display column x of its line.
+// Without columnMode, the cursor stays on the runes of the line.
+func (v *documentView) setVirtualColumn(x int) {
+	col, add := columnAt([]rune(v.document.line(v.cursorLine)), x)
+	if !v.columnMode {
+		if n := v.document.lineLength(v.cursorLine); col > n {
+			col = n
+		}
+		add = 0
+	}
+	v.cursorColumn, v.cursorColumnMax = col, col
+	if !v.movingSecondary {
+		v.colAdd, v.colAddCursor = add, v.primary()
+	}
+}
+
+// isVirtual returns true if a cursor is past the end of its line.
+func (v *documentView) isVirtual(c cursor) bool {
+	return v.columnMode && c.column > v.document.lineLength(c.line)
+}
+
+// padTo makes display column x of a line the start of a rune, replacing the
+// tab around it with spaces or appending spaces to the line. It returns the
+// column of the rune.
+func (d *document) padTo(line, x int) int {
+	runes := []rune(d.line(line))
+	col, add := columnAt(runes, x)
+	if n := len(runes); col > n {
+		d.insert(d.offset(line, n), strings.Repeat(" ", col-n))
+	} else if add != 0 {
+		o := d.offset(line, col)
+		d.delete(o, o+1)
+		d.insert(o, strings.Repeat(" ", runeWidth('\t', x-add)))
+		col += add
+	}
+	return col
+}
+
+// fillVirtual replaces the virtual space under the cursors with spaces, so
+// text can be inserted there.
+func (v *documentView) fillVirtual() {
+	if !v.columnMode {
+		return
+	}
+	if add := v.columnAdd(); add != 0 {
+		col := v.document.padTo(v.cursorLine, v.virtualColumn())
+		v.cursorColumn, v.cursorColumnMax = col, col
+	}
+	for i, c := range v.allCursors() {
+		if !v.isVirtual(c) {
+			continue
+		}
+		runes := []rune(v.document.line(c.line))
+		c.column = v.document.padTo(c.line, displayColumn(runes, c.column))
+		c.columnMax = c.column
+		if i == 0 {
+			v.setPrimary(c)
+		} else {
+			v.cursors[i-1] = c
+		}
+	}
+}
+
+func cmdViewSetColumnMode(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+	v, ok := w.View().(*documentView)
+	if !ok {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	if len(args) > 1 {
+		e.ExecuteCommand(w, "alert", c.LongDesc())
+		return
+	}
+	mode := !v.columnMode
+	if len(args) != 0 {
+		switch args[0] {
+		case "on":
+			mode = true
+		case "off":
+			mode = false
+		default:
+			e.ExecuteCommand(w, "alert", c.LongDesc())
+			return
+		}
+	}
+	v.columnMode = mode
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestDisplayColumns(t *testing.T) {
+	runes := []rune("a\tbc\t")
+	data := []struct {
+		col int
+		x   int
+	}{
+		{0, 0}, {1, 1}, {2, 8}, {3, 9}, {4, 10}, {5, 16}, {7, 18},
+	}
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, line.x, displayColumn(runes, line.col))
+	}
+	data2 := []struct {
+		x   int
+		col int
+		add int
+	}{
+		{0, 0, 0}, {1, 1, 0}, {5, 1, 4}, {8, 2, 0}, {12, 4, 2}, {16, 5, 0}, {18, 7, 0},
+	}
+	for i, line := range data2 {
+		col, add := columnAt(runes, line.x)
+		ut.AssertEqualIndex(t, i, line.col, col)
+		ut.AssertEqualIndex(t, i, line.add, add)
+	}
+	// The tabs count for their display width when wrapping.
+	ut.AssertEqual(t, []int{0, 3}, wrapLine([]rune("ab\tcd"), 9, 0))
+}
+
+func TestColumnMode(t *testing.T) {
+	const on = ":view_set_column_mode\n"
+	data := []struct {
+		content  string
+		keys     string
+		expected string
+	}{
+		// Typing past the end of a line pads it with spaces.
+		{"ab\nabcdef\n", on + "jllllllkiX\x1b", "ab    X\nabcdef\n"},
+		// Typing inside a tab replaces it with spaces.
+		{"\tx\n", on + "lliY\x1b", "  Y      x\n"},
+		// Nothing is deleted past the end of a line.
+		{"ab\n", on + "lllllx", "ab\n"},
+		// A block selection uses the display columns.
+		{"a\tb\n123456789\n", on + "l\x16jlld", "ab\n19\n"},
+		// A block insert pads the short lines.
+		{"abc\na\nabc\n", on + "lll\x16jjc|\x1b", "abc|\na  |\nabc|\n"},
+		// Toggled off.
+		{"ab\n", on + on + "liX\x1b", "aXb\n"},
+	}
+	for i, line := range data {
+		_, v := typeKeys(t, line.content, line.keys)
+		ut.AssertEqualIndex(t, i, line.expected, v.document.content.String())
+	}
+
+	// The cursor is shown inside the tab.
+	_, v := typeKeys(t, "\tx\n", on+"lll")
+	ut.AssertEqual(t, cursor{0, 0, 0}, v.primary())
+	ut.AssertEqual(t, 3, v.virtualColumn())
+	ut.AssertEqual(t, "        x", string(v.buffer.Line(0).Runes()[:9]))
+	ut.AssertEqual(t, v.buffer.Cell(3, 0), v.cell(0, 0, v.columnAdd()))
+
+	// The display column is kept on the vertical motions.
+	_, v = typeKeys(t, "\tx\n123456789\nab\n", on+"jllllllllj")
+	ut.AssertEqual(t, cursor{2, 8, 8}, v.primary())
+	_, v = typeKeys(t, "\tx\n123456789\nab\n", on+"jlllkj")
+	ut.AssertEqual(t, cursor{1, 3, 3}, v.primary())
+}
@@ -14,36 +14,109 @@ import (
 // commandView would normally be in a floating Window near the current cursor
 // on the last focused Window or at the very last line at the bottom of the
 // screen.
+//
+// With a "/" or "?" prompt, it is the search window: the text is a regexp
+// searched incrementally while typing, see search.go.
 type commandView struct {
 	view
-	text string
+	e       *editor
+	text    string
+	prompt  string // "/" or "?" for the search window, "" for commands.
+	history int    // Index in the search history recalled with Up and Down, len(history) when typing a new pattern.
 }
 
 func (v *commandView) Buffer() *raster.Buffer {
 	v.buffer.Fill(raster.Cell{' ', v.DefaultFormat()})
-	v.buffer.DrawString(v.text, 0, 0, v.DefaultFormat())
+	v.buffer.DrawString(v.prompt+v.text, 0, 0, v.DefaultFormat())
 	return v.buffer
 }
 
+// isSearch returns true if the window is used to type a search pattern.
+func (v *commandView) isSearch() bool {
+	return v.prompt != ""
+}
+
+// setText replaces the text and searches for it in the search window.
+func (v *commandView) setText(text string) {
+	v.text = text
+	if v.isSearch() {
+		v.e.incrementalSearch(v.text, v.prompt == "?")
+	}
+	wicore.PostCommand(v.e, nil, "editor_redraw")
+}
+
 func (v *commandView) onTerminalKeyPressed(k key.Press) {
-	// TODO(maruel): React to keys.
+	if v.e.ActiveWindow().View() != wicore.View(v) {
+		return
+	}
 	if k.Ch != '\000' {
-		v.text += string(k.Ch)
-	} else {
-		switch k.Key {
-		case key.Escape:
-			// Dismiss window.
-		case key.Enter:
-			// Execute command.
-		case key.Space:
-			v.text += " "
-		case key.Tab:
-			// Command completion.
+		v.setText(v.text + string(k.Ch))
+		return
+	}
+	switch k.Key {
+	case key.Escape:
+		v.dismiss()
+		if v.isSearch() {
+			v.e.cancelIncrementalSearch()
+		}
+	case key.Enter:
+		line := v.text
+		v.dismiss()
+		if v.isSearch() {
+			v.e.commitIncrementalSearch(line, v.prompt == "?")
+		} else {
+			v.e.runCommandLine(line)
 		}
+	case key.Space:
+		v.setText(v.text + " ")
+	case key.Tab:
+		// Command completion.
 	}
 }
 
-// The command dialog box.
+func (v *commandView) onTerminalMetaKeyPressed(k key.Press) {
+	if v.e.ActiveWindow().View() != wicore.View(v) {
+		return
+	}
+	switch {
+	case k.Key == key.Backspace:
+		if r := []rune(v.text); len(r) != 0 {
+			v.setText(string(r[:len(r)-1]))
+		}
+	case k.Key == key.Up && v.isSearch():
+		if v.history > 0 {
+			v.history--
+			v.setText(v.e.search.history[v.history])
+		}
+	case k.Key == key.Down && v.isSearch():
+		if v.history < len(v.e.search.history)-1 {
+			v.history++
+			v.setText(v.e.search.history[v.history])
+		} else if v.history != len(v.e.search.history) {
+			v.history = len(v.e.search.history)
+			v.setText("")
+		}
+	default:
+		// Only the global key bindings, like Ctrl-C, apply to the command window.
+		if cmdName := wicore.GetKeyBindingCommand(v.e, v.e.KeyboardMode(), k); cmdName != "" {
+			v.e.ExecuteCommand(v.e.ActiveWindow(), cmdName)
+		} else {
+			v.e.ExecuteCommand(v.e.ActiveWindow(), "alert", notMapped.Formatf(k))
+		}
+	}
+}
+
+// dismiss closes the command window.
+func (v *commandView) dismiss() {
+	_ = v.Close()
+	v.events = nil
+	if v.window != nil {
+		v.e.ExecuteCommand(v.window, "window_close", v.window.ID())
+	}
+}
+
+// The command dialog box. The optional arguments are the prompt of the search
+// window, empty for commands, and the initial text.
 //
 // TODO(maruel): Position it 5 lines below the cursor in the parent Window's
 // View. Do this via onAttach.
@@ -62,11 +135,19 @@ func commandViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
 			naturalY:      1,
 			defaultFormat: raster.CellFormat{Fg: colors.Green, Bg: colors.Black},
 		},
+		e.(*editor),
+		"",
 		"",
+		len(e.(*editor).search.history),
+	}
+	if len(args) != 0 && args[0] != "" {
+		v.prompt = args[0]
+		v.title = "Search"
+	}
+	if len(args) > 1 {
+		v.text = args[1]
 	}
-	event := e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed)
-	e.RegisterViewActivated(func(v wicore.View) {
-		_ = event.Close()
-	})
+	v.events = append(v.events, e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed))
+	v.events = append(v.events, e.RegisterTerminalMetaKeyPressed(v.onTerminalMetaKeyPressed))
 	return v
 }
@@ -68,6 +68,7 @@ func (c *privilegedCommandImpl) Name() string {
 func (c *privilegedCommandImpl) Handle(e wicore.EditorW, w wicore.Window, args ...string) {
 	if c.ExpectedArgs != -1 && len(args) != c.ExpectedArgs {
 		e.ExecuteCommand(w, "alert", c.LongDesc())
+		return
 	}
 	// Convert types to internal types.
 	ed := e.(*editor)
@@ -0,0 +1,452 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Multiple cursors in a documentView. The motions and the edits apply to all
+// the cursors at once.
+
+package editor
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// maxCursors limits the number of cursors added at once, so a pattern matching
+// everywhere doesn't make the editor unusable.
+const maxCursors = 10000
+
+// cursor is a position in a document, like the primary cursor of a
+// documentView.
+type cursor struct {
+	line      int // 0-based.
+	column    int // In runes.
+	columnMax int // Column if the line was long enough.
+}
+
+// primary returns the primary cursor.
+func (v *documentView) primary() cursor {
+	return cursor{v.cursorLine, v.cursorColumn, v.cursorColumnMax}
+}
+
+func (v *documentView) setPrimary(c cursor) {
+	v.cursorLine = c.line
+	v.cursorColumn = c.column
+	v.cursorColumnMax = c.columnMax
+}
+
+// allCursors returns the primary cursor followed by the secondary ones.
+func (v *documentView) allCursors() []cursor {
+	return append([]cursor{v.primary()}, v.cursors...)
+}
+
+// setAllCursors is the reverse of allCursors. Duplicates are removed.
+func (v *documentView) setAllCursors(e wicore.Editor, all []cursor) {
+	v.setPrimary(all[0])
+	seen := map[[2]int]bool{{all[0].line, all[0].column}: true}
+	v.cursors = v.cursors[:0]
+	for _, c := range all[1:] {
+		if k := [2]int{c.line, c.column}; !seen[k] && len(v.cursors) < maxCursors {
+			seen[k] = true
+			v.cursors = append(v.cursors, c)
+		}
+	}
+	v.cursorMoved(e)
+}
+
+// addCursor adds a secondary cursor, unless there's already one there.
+func (v *documentView) addCursor(c cursor) {
+	if len(v.cursors) >= maxCursors || (c.line == v.cursorLine && c.column == v.cursorColumn) {
+		return
+	}
+	for _, o := range v.cursors {
+		if o.line == c.line && o.column == c.column {
+			return
+		}
+	}
+	v.cursors = append(v.cursors, c)
+}
+
+// addCursorAt adds a secondary cursor at a byte offset and makes it the
+// primary cursor, so it is the one shown.
+func (v *documentView) addCursorAt(e wicore.Editor, offset int) {
+	line, col := v.document.position(offset)
+	old := v.primary()
+	v.setPrimary(cursor{line, col, col})
+	v.addCursor(old)
+	v.cursorMoved(e)
+}
+
+// forEachCursor applies a motion to every cursor. The secondary cursors are
+// moved by swapping them in turn with the primary cursor, so any motion
+// written for a single cursor works.
+func forEachCursor(motion func(v *documentView, e wicore.EditorW)) func(v *documentView, e wicore.EditorW) {
+	return func(v *documentView, e wicore.EditorW) {
+		if len(v.cursors) != 0 {
+			primary := v.primary()
+			v.movingSecondary = true
+			for i := range v.cursors {
+				v.setPrimary(v.cursors[i])
+				motion(v, e)
+				v.cursors[i] = v.primary()
+			}
+			v.movingSecondary = false
+			v.setPrimary(primary)
+		}
+		motion(v, e)
+		if len(v.cursors) != 0 {
+			// Cursors that moved to the same position are merged.
+			v.setAllCursors(e, v.allCursors())
+		}
+	}
+}
+
+// cursorOffsets returns the byte offsets of all the cursors, the primary first.
+func (v *documentView) cursorOffsets() []int {
+	all := v.allCursors()
+	offsets := make([]int, len(all))
+	for i, c := range all {
+		offsets[i] = v.document.offset(c.line, c.column)
+	}
+	return offsets
+}
+
+// setCursorOffsets moves all the cursors to byte offsets, the primary first.
+func (v *documentView) setCursorOffsets(e wicore.Editor, offsets []int) {
+	all := make([]cursor, len(offsets))
+	for i, o := range offsets {
+		line, col := v.document.position(o)
+		all[i] = cursor{line, col, col}
+	}
+	v.setAllCursors(e, all)
+}
+
+// insertAll inserts s at every cursor. The cursors are moved after the
+// inserted text.
+func (v *documentView) insertAll(e wicore.Editor, s string) {
+	offsets := v.cursorOffsets()
+	order := byOffset(offsets)
+	// Inserting from the end keeps the offsets of the other cursors valid.
+	for i := len(order) - 1; i >= 0; i-- {
+		v.document.insert(offsets[order[i]], s)
+	}
+	for n, i := range order {
+		offsets[i] += (n + 1) * len(s)
+	}
+	v.setCursorOffsets(e, offsets)
+}
+
+// deleteAll deletes a range around every cursor. span returns the range to
+// delete for a cursor offset. The cursors end up at the start of the deleted
+// ranges. The cursors past the end of their line, in columnMode, delete
+// nothing and keep their column.
+func (v *documentView) deleteAll(e wicore.Editor, span func(offset int) (int, int)) {
+	all := v.allCursors()
+	// past is the number of columns of the cursors past the end of their line.
+	past := make([]int, len(all))
+	for i, c := range all {
+		if v.isVirtual(c) {
+			past[i] = c.column - v.document.lineLength(c.line)
+		}
+	}
+	offsets := v.cursorOffsets()
+	order := byOffset(offsets)
+	starts := make([]int, len(offsets))
+	ends := make([]int, len(offsets))
+	prevEnd := 0
+	for _, i := range order {
+		if past[i] != 0 {
+			starts[i], ends[i] = offsets[i], offsets[i]
+		} else {
+			starts[i], ends[i] = span(offsets[i])
+		}
+		if starts[i] < prevEnd {
+			// Overlapping ranges are merged.
+			starts[i] = prevEnd
+		}
+		if ends[i] < starts[i] {
+			ends[i] = starts[i]
+		}
+		prevEnd = ends[i]
+	}
+	for n := len(order) - 1; n >= 0; n-- {
+		i := order[n]
+		v.document.delete(starts[i], ends[i])
+	}
+	deleted := 0
+	for _, i := range order {
+		offsets[i] = starts[i] - deleted
+		deleted += ends[i] - starts[i]
+	}
+	for i, o := range offsets {
+		line, col := v.document.position(o)
+		all[i] = cursor{line, col + past[i], col + past[i]}
+	}
+	v.setAllCursors(e, all)
+}
+
+// offsetOrder sorts indexes of offsets by increasing offset.
+type offsetOrder struct {
+	order   []int
+	offsets []int
+}
+
+func (o offsetOrder) Len() int           { return len(o.order) }
+func (o offsetOrder) Less(i, j int) bool { return o.offsets[o.order[i]] < o.offsets[o.order[j]] }
+func (o offsetOrder) Swap(i, j int)      { o.order[i], o.order[j] = o.order[j], o.order[i] }
+
+// byOffset returns the indexes of offsets sorted by increasing offset.
+func byOffset(offsets []int) []int {
+	order := make([]int, len(offsets))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Stable(offsetOrder{order, offsets})
+	return order
+}
+
+// prevRuneStart returns the offset of the rune before offset. A "\r\n"
+// terminator is considered a single rune.
+func prevRuneStart(content text.Buffer, offset int) int {
+	if offset == 0 {
+		return 0
+	}
+	start := offset - utf8.UTFMax
+	if start < 0 {
+		start = 0
+	}
+	b := content.Range(start, offset)
+	_, size := utf8.DecodeLastRune(b)
+	if len(b) >= 2 && b[len(b)-1] == '\n' && b[len(b)-2] == '\r' {
+		size = 2
+	}
+	return offset - size
+}
+
+// nextRuneEnd returns the offset after the rune at offset. A "\r\n"
+// terminator is considered a single rune.
+func nextRuneEnd(content text.Buffer, offset int) int {
+	b := content.Range(offset, offset+utf8.UTFMax)
+	if len(b) == 0 {
+		return offset
+	}
+	_, size := utf8.DecodeRune(b)
+	if len(b) >= 2 && b[0] == '\r' && b[1] == '\n' {
+		size = 2
+	}
+	return offset + size
+}
+
+// isWordRune returns true if r is part of a word. Combining marks are part of
+// the word they modify.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// wordAt returns the word around column col of line, as the rune indexes
+// [start, end). start == end if there is no word there.
+func wordAt(line string, col int) (int, int) {
+	r := []rune(line)
+	if col >= len(r) || !isWordRune(r[col]) {
+		return col, col
+	}
+	start := col
+	for start > 0 && isWordRune(r[start-1]) {
+		start--
+	}
+	end := col
+	for end < len(r) && isWordRune(r[end]) {
+		end++
+	}
+	return start, end
+}
+
+// isWholeWord returns true if the bytes [start, end) of content are not
+// surrounded by word runes.
+func isWholeWord(content text.Buffer, start, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRune(content.Range(prevRuneStart(content, start), start))
+		if isWordRune(r) {
+			return false
+		}
+	}
+	r, _ := utf8.DecodeRune(content.Range(end, end+utf8.UTFMax))
+	return !isWordRune(r)
+}
+
+// nextWholeWord returns the offset of the next occurrence of word in content
+// after offset, wrapping around the end, skipping the offsets in skip. Returns
+// -1 if none. It is run in a background goroutine.
+func nextWholeWord(content text.Buffer, word []byte, offset int, skip map[int]bool) int {
+	for pass, from := range []int{offset, 0} {
+		for i := indexBuffer(content, from, word); i != -1; i = indexBuffer(content, i+1, word) {
+			if pass == 1 && i >= offset {
+				break
+			}
+			if !skip[i] && isWholeWord(content, i, i+len(word)) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Commands.
+
+func cmdDocumentDeleteLeft(v *documentView, e wicore.EditorW) {
+	if v.document.loading {
+		return
+	}
+	if v.isVirtual(v.primary()) {
+		// Past the end of the line, the cursors move left like in vim.
+		all := v.allCursors()
+		for i, c := range all {
+			if v.isVirtual(c) {
+				all[i] = cursor{c.line, c.column - 1, c.column - 1}
+			}
+		}
+		v.setAllCursors(e, all)
+		return
+	}
+	content := v.document.content
+	v.deleteAll(e, func(offset int) (int, int) {
+		return prevRuneStart(content, offset), offset
+	})
+	// TODO(maruel): Implement dirty instead.
+	e.TriggerTerminalResized()
+}
+
+func cmdDocumentDeleteRight(v *documentView, e wicore.EditorW) {
+	if v.document.loading {
+		return
+	}
+	content := v.document.content
+	v.deleteAll(e, func(offset int) (int, int) {
+		return offset, nextRuneEnd(content, offset)
+	})
+	// TODO(maruel): Implement dirty instead.
+	e.TriggerTerminalResized()
+}
+
+// addCursorVertically adds a cursor on the line above or below the topmost or
+// bottommost cursor, at the column of the primary cursor. Repeating it creates
+// a block of cursors. In columnMode, it is the display column and the cursor
+// can be past the end of the line.
+func (v *documentView) addCursorVertically(e wicore.EditorW, delta int) {
+	line := v.cursorLine
+	for _, c := range v.cursors {
+		if (delta < 0 && c.line < line) || (delta > 0 && c.line > line) {
+			line = c.line
+		}
+	}
+	line += delta
+	if line < 0 || line >= v.document.lineCount() {
+		// TODO(maruel): Beep.
+		return
+	}
+	if v.columnMode {
+		col := v.displayToColumn(line, v.virtualColumn())
+		v.addCursor(cursor{line, col, col})
+		wicore.PostCommand(e, nil, "editor_redraw")
+		return
+	}
+	col := v.cursorColumnMax
+	if l := v.document.lineLength(line); col > l {
+		col = l
+	}
+	v.addCursor(cursor{line, col, v.cursorColumnMax})
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+func cmdDocumentCursorAddAbove(v *documentView, e wicore.EditorW) {
+	v.addCursorVertically(e, -1)
+}
+
+func cmdDocumentCursorAddBelow(v *documentView, e wicore.EditorW) {
+	v.addCursorVertically(e, 1)
+}
+
+func cmdDocumentCursorAddNextMatch(v *documentView, e wicore.EditorW) {
+	line := v.document.line(v.cursorLine)
+	start, end := wordAt(line, v.cursorColumn)
+	if start == end {
+		e.ExecuteCommand(nil, "alert", noWordUnderCursor.String())
+		return
+	}
+	r := []rune(line)
+	word := []byte(string(r[start:end]))
+	// The new cursor is put at the same position in the next word.
+	delta := len(string(r[start:v.cursorColumn]))
+	wordStart := v.document.offset(v.cursorLine, start)
+	skip := map[int]bool{}
+	for _, o := range v.cursorOffsets() {
+		skip[o-delta] = true
+	}
+	content := v.document.snapshot()
+	wicore.Go("cursorAddNextMatch", func() {
+		i := nextWholeWord(content, word, wordStart+1, skip)
+		v.document.runInUI(e.(*editor), func() {
+			if v.document.content != content {
+				// Modified in the meantime.
+				return
+			}
+			if i == -1 {
+				e.ExecuteCommand(nil, "alert", patternNotFound.Formatf(string(word)))
+				return
+			}
+			v.addCursorAt(e, i+delta)
+		})
+	})
+}
+
+func cmdDocumentCursorsAddRegexp(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+	v, ok := w.View().(*documentView)
+	if !ok {
+		e.ExecuteCommand(w, "alert", "Internal error")
+		return
+	}
+	if len(args) == 0 {
+		e.ExecuteCommand(w, "alert", c.LongDesc())
+		return
+	}
+	pattern := strings.Join(args, " ")
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		e.ExecuteCommand(w, "alert", invalidPattern.Formatf(pattern, err))
+		return
+	}
+	content := v.document.snapshot()
+	wicore.Go("cursorsAddRegexp", func() {
+		matches := re.FindAllIndex(content.Bytes(), maxCursors)
+		v.document.runInUI(e.(*editor), func() {
+			if v.document.content != content {
+				// Modified in the meantime.
+				return
+			}
+			if len(matches) == 0 {
+				e.ExecuteCommand(nil, "alert", patternNotFound.Formatf(pattern))
+				return
+			}
+			all := v.allCursors()
+			for _, m := range matches {
+				line, col := v.document.position(m[0])
+				all = append(all, cursor{line, col, col})
+			}
+			v.setAllCursors(e, all)
+			wicore.PostCommand(e, nil, "editor_redraw")
+		})
+	})
+}
+
+func cmdDocumentCursorsClear(v *documentView, e wicore.EditorW) {
+	if len(v.cursors) != 0 {
+		v.cursors = nil
+		wicore.PostCommand(e, nil, "editor_redraw")
+	}
+}
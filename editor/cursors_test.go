@@ -0,0 +1,58 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+func TestMultipleCursors(t *testing.T) {
+	e, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	doc := e.(*editor).newDocument("")
+	doc.reset(text.NewString("foo bar\nfoo baz\nfo\n"))
+	v := &documentView{docView: docView{document: doc}}
+
+	v.addCursorVertically(e, 1)
+	v.addCursorVertically(e, 1)
+	ut.AssertEqual(t, []cursor{{1, 0, 0}, {2, 0, 0}}, v.cursors)
+	v.insertAll(e, "X")
+	ut.AssertEqual(t, "Xfoo bar\nXfoo baz\nXfo\n", doc.content.String())
+	forEachCursor(cmdDocumentCursorRight)(v, e)
+	forEachCursor(cmdDocumentCursorRight)(v, e)
+	v.insertAll(e, "-")
+	ut.AssertEqual(t, "Xfo-o bar\nXfo-o baz\nXfo-\n", doc.content.String())
+	// The last cursor deletes the line terminator.
+	cmdDocumentDeleteRight(v, e)
+	ut.AssertEqual(t, "Xfo- bar\nXfo- baz\nXfo-", doc.content.String())
+	cmdDocumentDeleteRight(v, e)
+	ut.AssertEqual(t, "Xfo-bar\nXfo-baz\nXfo-", doc.content.String())
+	cmdDocumentDeleteLeft(v, e)
+	ut.AssertEqual(t, "Xfobar\nXfobaz\nXfo", doc.content.String())
+	ut.AssertEqual(t, cursor{0, 3, 3}, v.primary())
+	ut.AssertEqual(t, []cursor{{1, 3, 3}, {2, 3, 3}}, v.cursors)
+
+	// Cursors moving to the same position are merged.
+	forEachCursor(cmdDocumentCursorHome)(v, e)
+	ut.AssertEqual(t, 0, len(v.cursors))
+}
+
+func TestNextWholeWord(t *testing.T) {
+	content := text.NewString("foo foobar foo_ été foo")
+	ut.AssertEqual(t, 22, nextWholeWord(content, []byte("foo"), 1, nil))
+	ut.AssertEqual(t, 0, nextWholeWord(content, []byte("foo"), 1, map[int]bool{22: true}))
+	ut.AssertEqual(t, -1, nextWholeWord(content, []byte("foo"), 1, map[int]bool{0: true, 22: true}))
+	ut.AssertEqual(t, 16, nextWholeWord(content, []byte("été"), 0, nil))
+
+	start, end := wordAt("a été_1+", 3)
+	ut.AssertEqual(t, 2, start)
+	ut.AssertEqual(t, 7, end)
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// maxDiffCells is the maximum size of the table used to diff, as the number of
+// lines of the first text multiplied by the number of lines of the second.
+// Past this, the differing part is shown as a single replacement.
+const maxDiffCells = 16 * 1024 * 1024
+
+// splitLines returns the lines of b, without their terminators.
+func splitLines(b text.Buffer) []string {
+	lines := strings.Split(b.String(), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+// diffLines returns the differences between a and b as a unified diff
+// without context lines.
+func diffLines(a, b []string) []string {
+	// Trim the common prefix and suffix, which is usually most of the text.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	a = a[pre : len(a)-suf]
+	b = b[pre : len(b)-suf]
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	if len(a)*len(b) > maxDiffCells {
+		return hunk(nil, pre, pre, a, b)
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if i < len(a) && j < len(b) && a[i] == b[j] {
+			i++
+			j++
+			continue
+		}
+		// Collect the hunk up to the next common line.
+		si, sj := i, j
+		for i < len(a) || j < len(b) {
+			if i < len(a) && j < len(b) && a[i] == b[j] {
+				break
+			}
+			if j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]) {
+				i++
+			} else {
+				j++
+			}
+		}
+		out = hunk(out, pre+si, pre+sj, a[si:i], b[sj:j])
+	}
+	return out
+}
+
+// hunk appends a hunk replacing del at the 0-based line aLine with ins at the
+// 0-based line bLine.
+func hunk(out []string, aLine, bLine int, del, ins []string) []string {
+	out = append(out, fmt.Sprintf("@@ -%d,%d +%d,%d @@", aLine+1, len(del), bLine+1, len(ins)))
+	for _, l := range del {
+		out = append(out, "-"+l)
+	}
+	for _, l := range ins {
+		out = append(out, "+"+l)
+	}
+	return out
+}
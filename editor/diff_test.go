@@ -0,0 +1,27 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestDiffLines(t *testing.T) {
+	a := []string{"a", "b", "c", "d", "e"}
+	b := []string{"a", "x", "c", "e", "f"}
+	expected := []string{
+		"@@ -2,1 +2,1 @@",
+		"-b",
+		"+x",
+		"@@ -4,1 +4,0 @@",
+		"-d",
+		"@@ -6,0 +5,1 @@",
+		"+f",
+	}
+	ut.AssertEqual(t, expected, diffLines(a, b))
+	ut.AssertEqual(t, []string(nil), diffLines(a, a))
+}
@@ -7,13 +7,14 @@ package editor
 import (
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"strings"
-	"unicode"
+	"unicode/utf8"
 
 	"github.com/wi-ed/wi/wicore"
 	"github.com/wi-ed/wi/wicore/lang"
 	"github.com/wi-ed/wi/wicore/raster"
+	"github.com/wi-ed/wi/wicore/text"
 )
 
 // ReadWriteSeekCloser is a generic handle to a file.
@@ -24,6 +25,20 @@ type ReadWriteSeekCloser interface {
 	io.ReadWriteSeeker
 }
 
+// fileFormat describes how the content of a document is stored on disk.
+type fileFormat struct {
+	encoding   encoding
+	lineEnding lineEnding
+}
+
+func (f fileFormat) String() string {
+	if f.encoding == binaryEncoding {
+		// The line endings are meaningless.
+		return f.encoding.String()
+	}
+	return f.encoding.String() + " " + f.lineEnding.String()
+}
+
 // document is a live editable document.
 //
 // TODO(maruel): This will probably have to be moved into wicore, since
@@ -37,59 +52,274 @@ type ReadWriteSeekCloser interface {
 // output from a live command, whatever). This means wicore.Document would need
 // to be a proper interface.
 type document struct {
-	filePath string              // filePath encoded in unicode. This can cause problems with systems not using an unicode code page.
-	fileType string              // One of the known file type. Generally described by a file extension, optionally followed by a version (?). TODO(maruel): Design.
-	handle   ReadWriteSeekCloser // Handle to the file. For unsaved files, it's empty.
-	content  []string            // Content as a slice of string, each being a line. In practice, it could be desired that a document not to be fully loaded in memory, or loaded asynchronously. TODO(maruel): Implement partial loading.
-	isDirty  bool                // true if the content was not saved to disk.
+	id          int                 // Unique ID for the process lifetime.
+	filePath    string              // filePath encoded in unicode. This can cause problems with systems not using an unicode code page.
+	identity    fileIdentity        // Canonical identity of the file, to never load the same file twice.
+	fileType    wicore.FileType     // Determined asynchronously by the scanners, see scanFileType().
+	handle      ReadWriteSeekCloser // Handle to the file. Only kept opened in large file mode.
+	content     text.Buffer         // Content as an immutable rope. Each modification replaces it, so a copy of it is a snapshot usable from any goroutine. It is loaded asynchronously, and only partially held in memory in large file mode.
+	saved       text.Buffer         // Content as last loaded or saved. The document is dirty when content differs from it.
+	format      fileFormat          // How the content is stored on disk. The content is converted on load and on save.
+	savedFmt    fileFormat          // File format as last loaded or saved.
+	history     undoTree            // Undo history, shared by all the views of this document.
+	loading     bool                // true while the content is being loaded from disk. The document is read-only in the meantime.
+	saving      bool                // true while the content is being saved to disk.
+	pendingSave []func()            // Saves requested while saving, run in order once the current one is done.
+	saveSeq     int                 // Incremented on each save, to never record an older content as saved.
+	savedSeq    int                 // saveSeq of the save that set saved.
+	diskStat    fileStat            // State of the file as last loaded or saved, to detect modifications by other programs.
+	watched     string              // File being watched for modifications.
+	watcher     fileWatcher         // Watcher of the file, set by watch().
+	loaded      int64               // Number of bytes loaded so far.
+	size        int64               // Size of the file being loaded, used for progress reporting.
+	done        chan struct{}       // Closed on Close() to cancel background operations.
+	views       int                 // Number of documentView of this document.
+	onClosed    func()              // Called when the last view is closed, to unregister the document.
+	large       bool                // Large file mode: the content is read on demand from source and the expensive features, like undo, are disabled.
+	source      *text.Source        // Backing store of the content in large file mode.
+	swapPath    string              // Swap file journaling the modifications. Empty if the document has no file.
+	swap        *swapFile           // Created on the first modification.
+	swapChecked bool                // true once checked for a swap file left by a crash.
+	recoverable bool                // true while the user didn't decide what to do with a swap file left by a crash. The document is not journaled in the meantime.
+	autoHex     bool                // true until the file being opened is known to be binary or not, see onFormatDetected().
+	anchors     []*anchor           // Positions moving with the edits, see anchor.go.
+	marks       map[rune]*anchor    // Local marks a-z, see mark_set.
+	changes     []*anchor           // Change list, the position of the last modifications, see change_older.
+	changeIndex int                 // Position in changes when going back with change_older.
 }
 
-func makeDocument() *document {
+func makeDocument(id int) *document {
 	return &document{
-		// TODO(maruel): Obviously, no initial content.
-		content: []string{"Dummy content\n", "Really\n"},
+		id:       id,
+		fileType: wicore.Scanning,
+		history:  makeUndoTree(text.Buffer{}),
+		done:     make(chan struct{}),
+		marks:    map[rune]*anchor{},
 	}
 }
 
 func (d *document) ID() string {
-	// TODO(maruel): This implies the same document should never be loaded twice.
-	// It think it's a valid assumption, multiple DocumentView should be created
-	// instead.
-	// TODO(maruel): Implement uniqueness. And look at hardlinks and symlinks too
-	// to dedupe paths.
-	return fmt.Sprintf("document:%s", d.filePath)
+	// The same file is never loaded twice, see editor.documentByIdentity();
+	// multiple documentView are created instead.
+	return fmt.Sprintf("document:%d", d.id)
 }
 
 func (d *document) String() string {
 	return fmt.Sprintf("Document(%s)", d.filePath)
 }
 
+// Close releases the document. The swap file, if any, is kept; see closeView.
 func (d *document) Close() error {
+	select {
+	case <-d.done:
+	default:
+		close(d.done)
+		if d.watched != "" {
+			d.watcher.unwatch(d.watched)
+		}
+		d.closeSwap()
+		return d.closeHandle()
+	}
 	return nil
 }
 
+// closeView is called when a view of the document is closed. The document is
+// closed and unregistered with its last view; its swap file is deleted if it
+// has no modifications to recover.
+func (d *document) closeView() error {
+	if d.views--; d.views != 0 {
+		return nil
+	}
+	if !d.IsDirty() {
+		d.removeSwap()
+	}
+	err := d.Close()
+	if d.onClosed != nil {
+		d.onClosed()
+	}
+	return err
+}
+
+// closeHandle closes the file kept opened in large file mode. The content
+// must not be used afterward.
+func (d *document) closeHandle() error {
+	var err error
+	if d.handle != nil {
+		err = d.handle.Close()
+		d.handle = nil
+	}
+	d.large = false
+	d.source = nil
+	return err
+}
+
 func (d *document) RenderInto(buffer *raster.Buffer, view wicore.View, offsetColumn, offsetLine int) {
-	for row, l := range d.content {
+	// Only the visible lines are fetched from the content.
+	for row := 0; row < buffer.Height && offsetLine+row < d.lineCount(); row++ {
+		l := d.line(offsetLine + row)
 		// This will automatically elide text.
 		if offsetColumn != 0 {
 			// TODO(maruel): This is a hot path and should be optimized accordingly
 			// by not requiring converting the full string.
 			// TODO(maruel): Handle zero width space U+200B. It should (obviously)
 			// not take any space.
-			l = string([]rune(l)[offsetColumn:])
+			r := []rune(l)
+			if offsetColumn >= len(r) {
+				continue
+			}
+			l = string(r[offsetColumn:])
 		}
-		// It is particularly important on Windows, as "\n" would be rendered as an invalid character.
-		l := strings.TrimRightFunc(l, unicode.IsSpace)
-		buffer.DrawString(l, offsetColumn, row+offsetLine, view.DefaultFormat())
+		buffer.DrawString(l, 0, row, view.DefaultFormat())
 	}
 }
 
 func (d *document) FileType() wicore.FileType {
-	return wicore.Scanning
+	return d.fileType
 }
 
 func (d *document) IsDirty() bool {
-	return d.isDirty
+	// Since the content is immutable, undoing back to the saved state restores
+	// the exact same snapshot.
+	return d.content != d.saved || d.format != d.savedFmt
+}
+
+// status returns the properties of the document shown in the status bar.
+func (d *document) status() string {
+	if d.large {
+		return d.format.String() + " " + largeFile.String()
+	}
+	return d.format.String()
+}
+
+// snapshot returns an immutable copy of the content. It is safe to use from
+// any goroutine.
+func (d *document) snapshot() text.Buffer {
+	return d.content
+}
+
+// lineCount returns the number of lines in the document.
+func (d *document) lineCount() int {
+	return d.content.LineCount()
+}
+
+// line returns a line without its terminator. The "\r" of a "\r\n" terminator
+// is only present in documents with mixed line endings or in large file mode
+// and is hidden. With "\n" terminators, a trailing "\r" is part of the line.
+func (d *document) line(l int) string {
+	s := d.content.Line(l)
+	if d.format.lineEnding != lfEnding {
+		s = strings.TrimSuffix(s, "\r")
+	}
+	return s
+}
+
+// lineLength returns the length of a line in runes.
+func (d *document) lineLength(l int) int {
+	// TODO(maruel): Cache when it becomes a bottleneck on very long lines.
+	return utf8.RuneCountInString(d.line(l))
+}
+
+// offset converts a 0-based line and column in runes into a byte offset. The
+// column is clamped to the line length.
+func (d *document) offset(line, col int) int {
+	start := d.content.LineStart(line)
+	end := start + len(d.line(line))
+	o := d.content.RuneOffset(d.content.RuneIndex(start) + col)
+	if o > end {
+		return end
+	}
+	return o
+}
+
+// position converts a byte offset back into a 0-based line and column in
+// runes.
+func (d *document) position(offset int) (line, col int) {
+	line = d.content.LineAt(offset)
+	col = d.content.RuneIndex(offset) - d.content.RuneIndex(d.content.LineStart(line))
+	return
+}
+
+// reset replaces the content, considered as saved in the current file format,
+// and clears the undo history.
+func (d *document) reset(content text.Buffer) {
+	d.content = content
+	d.saved = content
+	d.savedFmt = d.format
+	// A save still in progress is older than this content.
+	d.saveSeq++
+	d.savedSeq = d.saveSeq
+	d.history = makeUndoTree(content)
+}
+
+// insert inserts s at offset.
+func (d *document) insert(offset int, s string) {
+	if swap := d.journal(); swap != nil {
+		swap.insert(offset, s)
+	}
+	d.moveAnchorsInsert(offset, len(s))
+	d.content = d.content.InsertString(offset, s)
+	d.record(offset)
+}
+
+// delete removes the bytes in [start, end).
+func (d *document) delete(start, end int) {
+	if start >= end {
+		return
+	}
+	if swap := d.journal(); swap != nil {
+		swap.delete(start, end)
+	}
+	d.moveAnchorsDelete(start, end)
+	d.content = d.content.Delete(start, end)
+	d.record(start)
+}
+
+// record records the content in the undo history and the change list, except
+// in large file mode.
+func (d *document) record(offset int) {
+	if !d.large {
+		d.history.record(d.content, offset)
+		d.recordChange(offset)
+	}
+}
+
+// undo reverts the last group of edits. It returns the offset of the reverted
+// change.
+func (d *document) undo() (int, bool) {
+	content, offset, ok := d.history.undo()
+	if ok {
+		d.content = content
+		d.clampAnchors()
+		d.checkpoint()
+	}
+	return offset, ok
+}
+
+// redo reapplies the last undone group of edits. It returns the offset of the
+// change.
+func (d *document) redo() (int, bool) {
+	content, offset, ok := d.history.redo()
+	if ok {
+		d.content = content
+		d.clampAnchors()
+		d.checkpoint()
+	}
+	return offset, ok
+}
+
+// setLineEnding changes the line terminators used on save. With mixed line
+// endings, the "\r" kept in the content are removed as an undoable step of its
+// own.
+func (d *document) setLineEnding(ending lineEnding) {
+	if d.format.lineEnding == mixedEnding {
+		d.history.seal()
+		d.content = stripCR(d.content)
+		d.clampAnchors()
+		d.history.record(d.content, 0)
+		d.history.seal()
+	}
+	d.format.lineEnding = ending
+	d.checkpoint()
 }
 
 // Commands.
@@ -108,16 +338,165 @@ func cmdDocumentNew(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, ar
 	e.ExecuteCommand(w, "window_new", cmd...)
 }
 
-func cmdDocumentOpen(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+func cmdDocumentOpen(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
 	// The Window and View are created synchronously. The View is populated
-	// asynchronously.
-	log.Printf("Faking opening a file: %s", args)
+	// asynchronously. Opening an already opened file creates a new View of the
+	// existing document.
+	id := getFileIdentity(args[0])
+	doc := e.documentByIdentity(id)
+	if doc == nil {
+		doc = e.newDocument(args[0])
+		doc.identity = id
+		doc.swapPath = e.swapFilePath(id)
+		doc.autoHex = true
+		doc.load(e)
+	}
+	viewFactoryName := "new_document"
+	if doc.format.encoding == binaryEncoding {
+		viewFactoryName = "hex"
+	}
+	e.ExecuteCommand(w, "window_new", e.rootWindow.ID(), "fill", viewFactoryName, doc.ID())
+}
+
+// activeDocument returns the document in the Window's View, if any.
+func activeDocument(w wicore.Window) *document {
+	return documentOf(w.View())
+}
+
+// documentOf returns the document shown by a View, if any.
+func documentOf(v wicore.View) *document {
+	switch v := v.(type) {
+	case *documentView:
+		return v.document
+	case *hexView:
+		return v.document
+	}
+	return nil
 }
 
 func cmdDocumentRun(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
 	e.ExecuteCommand(w, "alert", "Implement 'document_run' for your document")
 }
 
+func cmdDocumentSetEncoding(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	doc := activeDocument(w)
+	if doc == nil {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	enc, ok := stringToEncoding(args[0])
+	if !ok {
+		e.ExecuteCommand(w, "alert", invalidEncoding.Formatf(args[0]))
+		return
+	}
+	// Refuse the conversion upfront instead of failing on save.
+	format := doc.format
+	format.encoding = enc
+	if _, err := (encodedContent{doc.content, format}).WriteTo(ioutil.Discard); err != nil {
+		e.ExecuteCommand(w, "alert", failedToConvert.Formatf(enc, err))
+		return
+	}
+	doc.format = format
+	doc.checkpoint()
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+func cmdDocumentSetLineEnding(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	doc := activeDocument(w)
+	if doc == nil {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	ending, ok := stringToLineEnding(args[0])
+	if !ok {
+		e.ExecuteCommand(w, "alert", invalidLineEnding.Formatf(args[0]))
+		return
+	}
+	if doc.large {
+		// It would require to load the whole content in memory.
+		e.ExecuteCommand(w, "alert", notInLargeFileMode.String())
+		return
+	}
+	if doc.format.encoding == binaryEncoding {
+		e.ExecuteCommand(w, "alert", notForBinary.String())
+		return
+	}
+	doc.setLineEnding(ending)
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+func cmdDocumentSave(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	doc := activeDocument(w)
+	if doc == nil {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	if doc.loading {
+		// The content is partial.
+		e.ExecuteCommand(w, "alert", stillLoading.String())
+		return
+	}
+	if doc.filePath == "" {
+		e.ExecuteCommand(w, "alert", noFileName.String())
+		return
+	}
+	doc.save(e, doc.filePath, nil)
+}
+
+func cmdDocumentSaveAll(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	for _, d := range e.documents {
+		doc, ok := d.(*document)
+		if !ok || doc.filePath == "" {
+			continue
+		}
+		if doc.loading {
+			// The document is not dirty while loading but its content is partial.
+			e.ExecuteCommand(w, "alert", stillLoading.String())
+		} else if doc.IsDirty() {
+			doc.save(e, doc.filePath, nil)
+		}
+	}
+}
+
+func cmdDocumentSaveAs(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	doc := activeDocument(w)
+	if doc == nil {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	if doc.loading {
+		// The content is partial.
+		e.ExecuteCommand(w, "alert", stillLoading.String())
+		return
+	}
+	if other := e.documentByIdentity(getFileIdentity(args[0])); other != nil && other != doc {
+		// It would be overwritten on its next save.
+		e.ExecuteCommand(w, "alert", alreadyOpened.Formatf(args[0]))
+		return
+	}
+	doc.save(e, args[0], nil)
+}
+
+func cmdDocumentSaveQuit(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	doc := activeDocument(w)
+	if doc == nil {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	if doc.loading {
+		// The content is partial.
+		e.ExecuteCommand(w, "alert", stillLoading.String())
+		return
+	}
+	if doc.filePath == "" {
+		e.ExecuteCommand(w, "alert", noFileName.String())
+		return
+	}
+	doc.save(e, doc.filePath, func() {
+		e.ExecuteCommand(w, "editor_quit")
+	})
+}
+
 // RegisterDocumentCommands registers the top-level native commands to manage
 // documents.
 func RegisterDocumentCommands(dispatcher wicore.CommandsW) {
@@ -134,6 +513,54 @@ func RegisterDocumentCommands(dispatcher wicore.CommandsW) {
 				lang.En: "Build a file.",
 			},
 		},
+		&privilegedCommandImpl{
+			"document_delete_lines",
+			-1,
+			cmdDocumentDeleteLines,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Deletes the lines of a range",
+			},
+			lang.Map{
+				lang.En: "Usage: document_delete_lines [range] [register]\nDeletes the lines of a range, the cursor line by default, into a register, like :d in vim. See document_substitute for the ranges.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_global",
+			2,
+			cmdDocumentGlobal,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Runs a command on the lines matching a regexp",
+			},
+			lang.Map{
+				lang.En: "Usage: document_global <range> </regexp/[command]>\nRuns a command on each line of a range matching a regexp, like :g in vim. The range is the whole document when empty. The lines are marked first, so the lines deleted by the command on a previous line are skipped. The command is a command line, like d or s/a/b/, or normal followed by the keys to type in Normal mode, like normal A!, where <Escape> or <Ctrl-v> is a single key. Without command, the matching lines are listed. All the edits are a single undo step. An empty regexp is the last search pattern.\nIn the command window, :[range]g/regexp/command runs it.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_hex",
+			0,
+			cmdDocumentHex,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Switches between the text and the hex views",
+			},
+			lang.Map{
+				lang.En: "Switches the active Window between the text and the hex views of its document. Binary files are shown in the hex view when opened.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_join",
+			-1,
+			cmdDocumentJoin,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Joins the lines of a range",
+			},
+			lang.Map{
+				lang.En: "Usage: document_join [range] [!]\nJoins the lines of a range, the cursor line and the next one by default, like :j in vim. The leading whitespace of the joined lines is replaced with a space; with !, the lines are joined as is.",
+			},
+		},
 		&wicore.CommandImpl{
 			"document_new",
 			0,
@@ -149,7 +576,7 @@ func RegisterDocumentCommands(dispatcher wicore.CommandsW) {
 				lang.En: "Create a new buffer. It also creates a new window to hold the document.",
 			},
 		},
-		&wicore.CommandImpl{
+		&privilegedCommandImpl{
 			"document_open",
 			1,
 			cmdDocumentOpen,
@@ -158,7 +585,19 @@ func RegisterDocumentCommands(dispatcher wicore.CommandsW) {
 				lang.En: "Opens a file in a new buffer",
 			},
 			lang.Map{
-				lang.En: "Opens a file in a new buffer.",
+				lang.En: "Usage: document_open <path>\nOpens a file in a new buffer. The window is created immediately and the file is loaded in the background.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_recover",
+			0,
+			cmdDocumentRecover,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Recovers the active document from its swap file",
+			},
+			lang.Map{
+				lang.En: "Recovers the active document from the swap file left by an editor that crashed. The modifications of the documents are journaled in swap files in $XDG_STATE_HOME/wi/swap until they are saved.",
 			},
 		},
 		&wicore.CommandImpl{
@@ -174,9 +613,145 @@ func RegisterDocumentCommands(dispatcher wicore.CommandsW) {
 			},
 		},
 
+		&privilegedCommandImpl{
+			"document_save",
+			0,
+			cmdDocumentSave,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Saves the active document",
+			},
+			lang.Map{
+				lang.En: "Saves the active document to its file. The file is written in the background to a temporary file which then replaces the original file, so a failure never leaves a partially written file.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_save_all",
+			0,
+			cmdDocumentSaveAll,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Saves all the modified documents",
+			},
+			lang.Map{
+				lang.En: "Saves all the modified documents that have a file name.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_save_as",
+			1,
+			cmdDocumentSaveAs,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Saves the active document to a new file",
+			},
+			lang.Map{
+				lang.En: "Usage: document_save_as <path>\nSaves the active document to a new file. On success, the document is associated to this new file.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_save_quit",
+			0,
+			cmdDocumentSaveQuit,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Saves the active document and quits",
+			},
+			lang.Map{
+				lang.En: "Saves the active document then quits the editor once the file was successfully written.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_set_encoding",
+			1,
+			cmdDocumentSetEncoding,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Converts the active document to another encoding",
+			},
+			lang.Map{
+				lang.En: "Usage: document_set_encoding <encoding>\nConverts the active document to another character encoding. The file is written in this encoding on the next save. Supported encodings are utf-8, utf-8-bom, utf-16le, utf-16be, latin1 and windows-1252.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_set_line_ending",
+			1,
+			cmdDocumentSetLineEnding,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Converts the line endings of the active document",
+			},
+			lang.Map{
+				lang.En: "Usage: document_set_line_ending <lf|crlf>\nConverts the line endings of the active document. The file is written with these line endings on the next save. A file with mixed line endings is normalized.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_sort",
+			-1,
+			cmdDocumentSort,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Sorts the lines of a range",
+			},
+			lang.Map{
+				lang.En: "Usage: document_sort [range] [options]\nSorts the lines of a range, the whole document by default, like :sort in vim. The options are ! to sort in reverse order, i to ignore the case, n to sort on the first decimal number of the lines and u to remove the duplicate lines. The sort is stable.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_substitute",
+			2,
+			cmdDocumentSubstitute,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Replaces the matches of a regexp",
+			},
+			lang.Map{
+				lang.En: "Usage: document_substitute <range> </regexp/replacement/[flags]>\nReplaces the matches of a regexp in the lines of a range, like :s in vim. The replacement uses the Go regexp syntax, $1 is the first group; \\n is a line break. The flags are g to replace all the matches of a line instead of the first one, i to ignore the case and c to confirm each replacement with y, n, a or q. An empty regexp is the last search pattern and an empty expression repeats the last substitution.\nThe range is empty for the cursor line, % for the whole document, or one or two addresses separated by ',' like .,+5, '<,'> or /foo/,/bar/. An address is a line number, . for the cursor line, $ for the last line, '< and '> for the bounds of the last selection, /regexp/ or ?regexp? for the next or previous matching line, with optional +N and -N offsets.\nIn the command window, :[range]s/regexp/replacement/flags runs it.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_uniq",
+			-1,
+			cmdDocumentUniq,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Removes the consecutive duplicate lines of a range",
+			},
+			lang.Map{
+				lang.En: "Usage: document_uniq [range] [i]\nRemoves the consecutive duplicate lines of a range, the whole document by default. With i, the case is ignored.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_vglobal",
+			2,
+			cmdDocumentVGlobal,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Runs a command on the lines not matching a regexp",
+			},
+			lang.Map{
+				lang.En: "Usage: document_vglobal <range> </regexp/[command]>\nRuns a command on each line of a range not matching a regexp, like :v in vim. See document_global.",
+			},
+		},
+		&privilegedCommandImpl{
+			"file_type_register",
+			3,
+			cmdFileTypeRegister,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Registers a file type scanner",
+			},
+			lang.Map{
+				lang.En: "Usage: file_type_register <file type> <content|shebang|name|modeline> <pattern>\nRegisters a scanner determining the file type of the documents. The pattern is a regexp matched against the beginning of the content for content, otherwise a glob matched against the interpreter of the #! line, the file name or the type set in a vim or emacs modeline. The scanners are tried in the order modeline, name, shebang then content, the last registered first. Plugins use it to add new file types.",
+			},
+		},
+
 		&wicore.CommandAlias{"new", "document_new", nil},
 		&wicore.CommandAlias{"o", "document_open", nil},
 		&wicore.CommandAlias{"open", "document_open", nil},
+		&wicore.CommandAlias{"w", "document_save", nil},
+		&wicore.CommandAlias{"wa", "document_save_all", nil},
+		&wicore.CommandAlias{"wq", "document_save_quit", nil},
 	}
 	for _, cmd := range cmds {
 		dispatcher.Register(cmd)
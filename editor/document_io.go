@@ -0,0 +1,374 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Document I/O. All the file system accesses are done in background
+// goroutines, the results are piped back into the UI goroutine via
+// editor.deferred.
+
+package editor
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// loadChunkSize is the size of each read when loading a file. Each chunk
+// results in a round trip to the UI goroutine, so the View is refreshed while
+// the file is being loaded.
+const loadChunkSize = 1024 * 1024
+
+// defaultLargeFileSize is the default size from which files are loaded in
+// large file mode. See editor_set_large_file_size.
+const defaultLargeFileSize = 64 * 1024 * 1024
+
+// parseSize parses a size in bytes with an optional K, M or G suffix.
+func parseSize(s string) (int64, bool) {
+	mult := int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		mult = 1024
+	case "M":
+		mult = 1024 * 1024
+	case "G":
+		mult = 1024 * 1024 * 1024
+	}
+	if mult != 1 {
+		s = s[:len(s)-1]
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	return i * mult, true
+}
+
+// runInUI runs f in the UI goroutine. Returns false if the document was closed
+// in the meantime, in which case the background operation should be aborted.
+func (d *document) runInUI(e *editor, f func()) bool {
+	select {
+	case e.deferred <- f:
+		return true
+	case <-d.done:
+		return false
+	}
+}
+
+// load asynchronously loads d.filePath into the document. It must be called
+// from the UI goroutine.
+//
+// The content is streamed into the document chunk by chunk. The document is
+// read-only until the load completes.
+func (d *document) load(e *editor) {
+	d.loading = true
+	d.loaded = 0
+	d.size = 0
+	d.watch(e)
+	filePath := d.filePath
+	largeFileSize := e.largeFileSize
+	wicore.Go("documentLoad", func() {
+		err := d.loadAsync(e, filePath, largeFileSize)
+		d.runInUI(e, func() {
+			d.onLoaded(e, filePath, err)
+		})
+	})
+}
+
+// onLoaded is called in the UI goroutine once a load completed.
+func (d *document) onLoaded(e *editor, filePath string, err error) {
+	d.loading = false
+	// Loading is not undoable.
+	d.reset(d.content)
+	d.checkSwap(e)
+	d.scanFileType(e)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Opening a file that doesn't exist creates a new document.
+			log.Printf("%s: new file", d)
+		} else {
+			e.ExecuteCommand(e.ActiveWindow(), "alert", failedToOpen.Formatf(filePath, err))
+		}
+	}
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+// loadAsync is run in a background goroutine.
+func (d *document) loadAsync(e *editor, filePath string, largeFileSize int64) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if f != nil {
+			_ = f.Close()
+		}
+	}()
+	if fi, err := f.Stat(); err == nil {
+		stat := fileStat{fi.ModTime(), fi.Size()}
+		d.runInUI(e, func() {
+			d.size = stat.size
+			d.diskStat = stat
+		})
+		if stat.size >= largeFileSize {
+			if format, ok := largeFileFormat(f); ok {
+				// The file is kept opened as the document handle.
+				handle := f
+				f = nil
+				return d.loadLarge(e, handle, format)
+			}
+			log.Printf("%s: large file mode requires UTF-8 or binary", d)
+		}
+	}
+	var dec *decoder
+	var eol lineEndingCounter
+	// The whole content is also kept here to normalize the line endings once
+	// the file is fully loaded. It is cheap since the chunks are shared.
+	var all text.Buffer
+	for {
+		buf := make([]byte, loadChunkSize)
+		n, err := io.ReadFull(f, buf)
+		buf = buf[:n]
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if dec == nil {
+			// The encoding is detected on the first chunk.
+			dec = newDecoder(detectEncoding(buf, eof))
+			enc := dec.enc
+			if !d.runInUI(e, func() {
+				d.format.encoding = enc
+				d.onFormatDetected(e)
+			}) {
+				return nil
+			}
+		}
+		if out := dec.decode(buf, eof); len(out) != 0 {
+			eol.count(out)
+			// The "\r" are stripped once loaded, they are hidden meanwhile.
+			ending := eol.lineEnding()
+			if dec.enc == binaryEncoding {
+				ending = lfEnding
+			}
+			chunk := text.New(out)
+			all = all.Concat(chunk)
+			loaded := int64(n)
+			if !d.runInUI(e, func() {
+				d.format.lineEnding = ending
+				d.content = d.content.Concat(chunk)
+				d.saved = d.content
+				d.loaded += loaded
+				wicore.PostCommand(e, nil, "editor_redraw")
+			}) {
+				return nil
+			}
+		}
+		if eof {
+			ending := eol.lineEnding()
+			if dec.enc == binaryEncoding {
+				ending = lfEnding
+			} else if ending == crlfEnding {
+				// Done in this goroutine since it copies the whole content.
+				all = stripCR(all)
+			}
+			d.runInUI(e, func() {
+				d.content = all
+				d.format.lineEnding = ending
+			})
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// largeFileFormat determines the file format of a large file from its
+// beginning. Returns false if the file can't be loaded lazily because its
+// content would need to be converted.
+func largeFileFormat(f io.ReaderAt) (fileFormat, bool) {
+	head := make([]byte, loadChunkSize)
+	n, err := f.ReadAt(head, 0)
+	head = head[:n]
+	enc := detectEncoding(head, err == io.EOF)
+	if enc == binaryEncoding {
+		return fileFormat{enc, lfEnding}, true
+	}
+	if enc != utf8Encoding && enc != utf8BOMEncoding {
+		return fileFormat{}, false
+	}
+	var eol lineEndingCounter
+	eol.count(head)
+	return fileFormat{enc, eol.lineEnding()}, true
+}
+
+// loadLarge loads a file in large file mode. It is run in a background
+// goroutine.
+//
+// Only the lines are indexed, the content is read on demand from f as the
+// document is displayed. The content is kept as is, including the "\r" of the
+// line terminators, so it doesn't need to be converted on save.
+func (d *document) loadLarge(e *editor, f *os.File, format fileFormat) error {
+	source := text.NewSource(f)
+	if !d.runInUI(e, func() {
+		d.large = true
+		d.handle = f
+		d.source = source
+		d.format = format
+		d.onFormatDetected(e)
+	}) {
+		return f.Close()
+	}
+	return d.loadLazily(e, source, int64(len(format.encoding.bom())))
+}
+
+// loadLazily indexes the content of source starting at offset off and
+// appends it to the document. It is run in a background goroutine.
+func (d *document) loadLazily(e *editor, source *text.Source, off int64) error {
+	for {
+		chunk, err := source.Load(off, loadChunkSize)
+		if chunk.Len() != 0 {
+			off += int64(chunk.Len())
+			if !d.runInUI(e, func() {
+				d.content = d.content.Concat(chunk)
+				d.saved = d.content
+				d.loaded = off
+				wicore.PostCommand(e, nil, "editor_redraw")
+			}) {
+				return nil
+			}
+		}
+		if err != nil || chunk.Len() == 0 {
+			return err
+		}
+	}
+}
+
+// loadAppended loads what was appended to the file of an unmodified document
+// in large file mode, which is what happens to log files. It must be called
+// from the UI goroutine.
+func (d *document) loadAppended(e *editor) {
+	d.loading = true
+	filePath := d.filePath
+	source := d.source
+	off := int64(len(d.format.encoding.bom()) + d.content.Len())
+	wicore.Go("documentLoad", func() {
+		err := d.loadLazily(e, source, off)
+		d.runInUI(e, func() {
+			d.onLoaded(e, filePath, err)
+		})
+	})
+}
+
+// save asynchronously writes the content of the document to filePath. It must
+// be called from the UI goroutine.
+//
+// The saved content is updated only once the write succeeded, so the document
+// stays dirty if it was modified in the meantime. On success, the document is
+// associated to filePath and onDone, if not nil, is called in the UI
+// goroutine.
+//
+// The saves of a document are serialized, so the file ends up with the
+// content of the last one and its own renames are not mistaken for external
+// modifications.
+func (d *document) save(e *editor, filePath string, onDone func()) {
+	if d.saving {
+		d.pendingSave = append(d.pendingSave, func() {
+			d.save(e, filePath, onDone)
+		})
+		return
+	}
+	content := d.content
+	format := d.format
+	d.saving = true
+	d.saveSeq++
+	seq := d.saveSeq
+	wicore.Go("documentSave", func() {
+		err := writeFileAtomic(filePath, encodedContent{content, format})
+		var stat fileStat
+		var id fileIdentity
+		if err == nil {
+			stat, err = statFile(filePath)
+			id = getFileIdentity(filePath)
+		}
+		d.runInUI(e, func() {
+			d.saving = false
+			defer d.nextSave()
+			if err != nil {
+				e.ExecuteCommand(e.ActiveWindow(), "alert", failedToSave.Formatf(filePath, err))
+				return
+			}
+			log.Printf("%s: saved as %s", d, filePath)
+			d.filePath = filePath
+			d.identity = id
+			if seq > d.savedSeq {
+				d.saved = content
+				d.savedFmt = format
+				d.savedSeq = seq
+			}
+			d.diskStat = stat
+			d.watch(e)
+			d.setSwapPath(e.swapFilePath(id))
+			// Removes the swap file, unless the document was modified in the
+			// meantime.
+			d.checkpoint()
+			// The file name may have changed.
+			d.scanFileType(e)
+			if onDone != nil {
+				onDone()
+			}
+		})
+	})
+}
+
+// nextSave starts the oldest save requested while saving, if any.
+func (d *document) nextSave() {
+	if len(d.pendingSave) != 0 {
+		next := d.pendingSave[0]
+		d.pendingSave = d.pendingSave[1:]
+		next()
+	}
+}
+
+// writeFileAtomic writes content to a temporary file in the same directory as
+// filePath, flushes it to disk then renames it over filePath. The permissions
+// of the original file are kept. It is run in a background goroutine.
+//
+// The conversion to the document file format is done by content.
+func writeFileAtomic(filePath string, content io.WriterTo) error {
+	// Replace the target of a symlink, not the symlink itself.
+	if p, err := filepath.EvalSymlinks(filePath); err == nil {
+		filePath = p
+	}
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(filePath); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	f, err := ioutil.TempFile(filepath.Dir(filePath), "."+filepath.Base(filePath)+".")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	_, err = content.WriteTo(f)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filePath)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+	}
+	return err
+}
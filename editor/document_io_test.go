@@ -0,0 +1,109 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	p := filepath.Join(dir, "foo.txt")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(p, []byte("old\r\n"), 0600))
+
+	ut.AssertEqual(t, nil, writeFileAtomic(p, text.NewString("new\r\ncontent\r\n")))
+	content, err := ioutil.ReadFile(p)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "new\r\ncontent\r\n", string(content))
+	fi, err := os.Stat(p)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, os.FileMode(0600), fi.Mode().Perm())
+
+	// No temporary file left behind.
+	files, err := ioutil.ReadDir(dir)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(files))
+}
+
+func TestSaveWhileLoading(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	p := filepath.Join(dir, "foo.txt")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(p, []byte("whole content\n"), 0600))
+
+	e, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	wicore.PostCommand(e, nil, "editor_bootstrap_ui")
+	wicore.PostCommand(e, func() {
+		w := e.ActiveWindow()
+		doc := w.View().(*documentView).document
+		doc.filePath = p
+		doc.reset(text.NewString("whole"))
+		doc.loading = true
+		for _, cmd := range []string{"document_save", "document_save_all", "document_save_quit"} {
+			e.ExecuteCommand(w, cmd)
+		}
+		e.ExecuteCommand(w, "document_save_as", p)
+		doc.loading = false
+		wicore.PostCommand(e, nil, "editor_quit")
+	}, "new")
+	ut.AssertEqual(t, 0, e.EventLoop())
+	content, err := ioutil.ReadFile(p)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "whole content\n", string(content))
+}
+
+func TestSaveSerialized(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	p := filepath.Join(dir, "foo.txt")
+
+	e, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	var doc *document
+	var onDisk []string
+	read := func() {
+		b, _ := ioutil.ReadFile(p)
+		onDisk = append(onDisk, string(b))
+	}
+	wicore.PostCommand(e, nil, "editor_bootstrap_ui")
+	wicore.PostCommand(e, func() {
+		doc = e.ActiveWindow().View().(*documentView).document
+		doc.reset(text.NewString("first\n"))
+		doc.save(e.(*editor), p, read)
+		doc.insert(0, "second\n")
+		doc.save(e.(*editor), p, func() {
+			read()
+			wicore.PostCommand(e, nil, "editor_quit")
+		})
+	}, "new")
+	ut.AssertEqual(t, 0, e.EventLoop())
+	// The second save waited for the first one.
+	ut.AssertEqual(t, []string{"first\n", "second\nfirst\n"}, onDisk)
+	ut.AssertEqual(t, false, doc.IsDirty())
+}
@@ -0,0 +1,249 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Journaling of the documents in swap files and recovery after a crash.
+
+package editor
+
+import (
+	"os"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// swapFilePath returns the swap file of the file id, or "" if it has none.
+func (e *editor) swapFilePath(id fileIdentity) string {
+	if e.swapDir == "" || id.path == "" {
+		return ""
+	}
+	return swapPath(e.swapDir, id)
+}
+
+// journal returns the swap file to journal a modification, creating it on the
+// first modification. Returns nil if the document is not journaled.
+func (d *document) journal() *swapFile {
+	if d.swap == nil {
+		if d.swapPath == "" || d.large || d.recoverable {
+			return nil
+		}
+		d.swap = newSwapFile(d.swapPath)
+		d.swap.checkpoint(d.content, d.format)
+	}
+	return d.swap
+}
+
+// checkpoint journals the whole content, after a modification that is not a
+// simple insertion or deletion. The swap file is deleted when there is
+// nothing to recover.
+func (d *document) checkpoint() {
+	if !d.IsDirty() {
+		d.removeSwap()
+		return
+	}
+	if d.swap != nil {
+		d.swap.checkpoint(d.content, d.format)
+		return
+	}
+	d.journal()
+}
+
+// setSwapPath changes the swap file, when the document is associated to
+// another file.
+func (d *document) setSwapPath(swapPath string) {
+	if swapPath != d.swapPath {
+		d.removeSwap()
+		d.swapPath = swapPath
+		d.recoverable = false
+	}
+}
+
+// closeSwap stops journaling and keeps the swap file, if any, to recover the
+// modifications later.
+func (d *document) closeSwap() {
+	if d.swap != nil {
+		_ = d.swap.Close()
+		d.swap = nil
+	}
+}
+
+// removeSwap stops journaling and deletes the swap file, if any. It must only
+// be called when there is nothing to recover.
+func (d *document) removeSwap() {
+	if d.swap != nil {
+		_ = d.swap.Remove()
+		d.swap = nil
+	}
+}
+
+// checkSwap offers to recover the document if a swap file more recent than
+// the file exists. It is only done once, after the document is loaded.
+func (d *document) checkSwap(e *editor) {
+	if d.swapChecked || d.swapPath == "" || d.swap != nil {
+		return
+	}
+	d.swapChecked = true
+	fi, err := os.Stat(d.swapPath)
+	if err != nil || !fi.ModTime().After(d.diskStat.modTime) {
+		return
+	}
+	// Do not overwrite it until the user decides.
+	d.recoverable = true
+	e.ExecuteCommand(e.ActiveWindow(), "window_new", "0", "floating", "document_recovery", d.ID())
+}
+
+// recoverFromSwap replaces the content with the one in the swap file. It is
+// undoable.
+func (d *document) recoverFromSwap(e *editor) {
+	swapPath := d.swapPath
+	wicore.Go("documentRecover", func() {
+		content, format, err := readSwapFile(swapPath)
+		d.runInUI(e, func() {
+			if err != nil {
+				e.ExecuteCommand(e.ActiveWindow(), "alert", failedToRecover.Formatf(d.filePath, err))
+				return
+			}
+			d.recoverable = false
+			d.content = content
+			d.format = format
+			d.record(0)
+			d.checkpoint()
+			wicore.PostCommand(e, nil, "editor_redraw")
+		})
+	})
+}
+
+// diffWithSwap asynchronously diffs the content with the swap file. onDone is
+// called in the UI goroutine with the diff.
+func (d *document) diffWithSwap(e *editor, onDone func(diff []string)) {
+	swapPath := d.swapPath
+	d.diffWith(e, swapPath, func() (text.Buffer, error) {
+		content, _, err := readSwapFile(swapPath)
+		return content, err
+	}, onDone)
+}
+
+func cmdDocumentRecover(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	doc := activeDocument(w)
+	if doc == nil {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	if doc.loading {
+		e.ExecuteCommand(w, "alert", stillLoading.String())
+		return
+	}
+	if doc.swapPath == "" || doc.swap != nil {
+		// The swap file, if any, is the one of this session.
+		e.ExecuteCommand(w, "alert", noSwapFile.Formatf(doc.filePath))
+		return
+	}
+	doc.recoverFromSwap(e)
+}
+
+// documentRecoveryViewFactory offers to recover a document from its swap
+// file. args[0] is the document ID, the remaining arguments are the diff to
+// show, if any.
+func documentRecoveryViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	var doc *document
+	for _, d := range e.AllDocuments() {
+		if d.ID() == args[0] {
+			doc, _ = d.(*document)
+			break
+		}
+	}
+	title := ""
+	if doc != nil {
+		title = doc.filePath
+	}
+	lines := append([]string{swapFound.Formatf(title), swapFoundChoices.String()}, args[1:]...)
+	v := makeListView(id, title, lines)
+	if doc == nil {
+		return v
+	}
+
+	deleteSwap := func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+		e.ExecuteCommand(w, "window_close", w.ID())
+		swapPath := doc.swapPath
+		doc.recoverable = false
+		wicore.Go("swapDelete", func() {
+			_ = os.Remove(swapPath)
+		})
+	}
+	ignore := func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+		// The swap file is kept for document_recover.
+		e.ExecuteCommand(w, "window_close", w.ID())
+	}
+	recoverSwap := func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+		e.ExecuteCommand(w, "window_close", w.ID())
+		doc.recoverFromSwap(e.(*editor))
+	}
+	showDiff := func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+		e.ExecuteCommand(w, "window_close", w.ID())
+		doc.diffWithSwap(e.(*editor), func(diff []string) {
+			e.ExecuteCommand(nil, "window_new", append([]string{"0", "floating", "document_recovery", doc.ID()}, diff...)...)
+		})
+	}
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"document_recovery_delete",
+			0,
+			deleteSwap,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Deletes the swap file",
+			},
+			lang.Map{
+				lang.En: "Deletes the swap file, discarding the modifications it contains.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_recovery_diff",
+			0,
+			showDiff,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Shows what would be recovered",
+			},
+			lang.Map{
+				lang.En: "Shows the differences between the document and the content that would be recovered from the swap file.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_recovery_ignore",
+			0,
+			ignore,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Keeps the swap file for later",
+			},
+			lang.Map{
+				lang.En: "Keeps the swap file so the document can be recovered later with document_recover. The document is not journaled in the meantime.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_recovery_recover",
+			0,
+			recoverSwap,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Recovers the document from the swap file",
+			},
+			lang.Map{
+				lang.En: "Recovers the document from the swap file. The recovery can be undone.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		v.commands.Register(cmd)
+	}
+	v.keyBindings.Set(wicore.AllMode, key.Press{Key: key.Escape}, "document_recovery_ignore")
+	v.keyBindings.Set(wicore.AllMode, key.Press{Ch: 'd'}, "document_recovery_diff")
+	v.keyBindings.Set(wicore.AllMode, key.Press{Ch: 'i'}, "document_recovery_ignore")
+	v.keyBindings.Set(wicore.AllMode, key.Press{Ch: 'r'}, "document_recovery_recover")
+	v.keyBindings.Set(wicore.AllMode, key.Press{Ch: 'x'}, "document_recovery_delete")
+	return v
+}
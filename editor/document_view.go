@@ -10,6 +10,7 @@ import (
 	"github.com/wi-ed/wi/wicore/key"
 	"github.com/wi-ed/wi/wicore/lang"
 	"github.com/wi-ed/wi/wicore/raster"
+	"github.com/wi-ed/wi/wicore/text"
 )
 
 // ColorMode is the coloring mode in effect.
@@ -29,53 +30,185 @@ type ColorMode int
 // TODO(maruel): The part that is serializable has to be in its own structure
 // for easier deserialization.
 type documentView struct {
+	docView
+	cursorLine        int // cursor position is 0-based.
+	cursorColumn      int
+	cursorColumnMax   int            // cursor position if the line was long enough.
+	offsetLine        int            // Offset of the view of the document.
+	offsetColumn      int            // Offset of the view of the document, in display columns. Only make sense when wordWrap==false.
+	offsetRow         int            // First row of offsetLine shown when wordWrap==true.
+	wordWrap          bool           // true if word-wrapping is in effect, see wrap.go.
+	wrapIndent        int            // Indentation of the continuation rows when wordWrap==true.
+	showBreak         string         // Marker starting the continuation rows when wordWrap==true.
+	rows              []displayRow   // Rows shown by the last Buffer() call.
+	wantX             int            // Position in the row kept by the vertical motions when wordWrap==true.
+	wantCursor        cursor         // Cursor position wantX is valid for.
+	columnMode        bool           // true if free movement is in effect, see columns.go.
+	colAdd            int            // Position of the primary cursor inside a tab when columnMode==true.
+	colAddCursor      cursor         // Cursor position colAdd is valid for.
+	colorMode         ColorMode      // Coloring of the file. Technically it'd be possible to have one file view without color and another with. TODO(maruel): Determine if useful.
+	selection         selection      // Selection if any, see selection.go.
+	lastSelection     [2]cursor      // Bounds of the last selection, for the '< and '> range addresses.
+	lastSelectionKind selectionKind  // Kind of the last selection, noSelection if there was none.
+	cursors           []cursor       // Secondary cursors, see cursors.go. The fields above are the primary cursor.
+	movingSecondary   bool           // true while a motion is applied to a secondary cursor.
+	highlight         *searchPattern // Search matches to highlight, see search.go.
+}
+
+// docView is the part shared by the Views of a document, embedded in
+// documentView and hexView.
+type docView struct {
 	view
-	document        *document
-	cursorLine      int // cursor position is 0-based.
-	cursorColumn    int
-	cursorColumnMax int         // cursor position if the line was long enough.
-	offsetLine      int         // Offset of the view of the document.
-	offsetColumn    int         // Offset of the view of the document. Only make sense when wordWrap==false.
-	wordWrap        bool        // true if word-wrapping is in effect. TODO(maruel): Implement.
-	columnMode      bool        // true if free movement is in effect. TODO(maruel): Implement.
-	colorMode       ColorMode   // Coloring of the file. Technically it'd be possible to have one file view without color and another with. TODO(maruel): Determine if useful.
-	selection       raster.Rect // selection if any. TODO(maruel): Selection in columnMode vs normal selection vs line selection.
+	document *document
 }
 
-func (v *documentView) Close() error {
+func (v *docView) Close() error {
 	err := v.view.Close()
-	err2 := v.document.Close()
+	// The document is shared by all its views.
+	err2 := v.document.closeView()
 	if err != nil {
 		return err
 	}
 	return err2
 }
 
+// Title returns the file path of the document, which can change on
+// document_save_as.
+func (v *docView) Title() string {
+	if v.document.filePath == "" {
+		return v.title
+	}
+	return v.document.filePath
+}
+
+// drawLoading draws the loading progress indicator on the last line of the
+// View while the document is loading.
+func (v *docView) drawLoading() {
+	if !v.document.loading {
+		return
+	}
+	percent := 0
+	if v.document.size != 0 {
+		percent = int(v.document.loaded * 100 / v.document.size)
+	}
+	v.buffer.DrawString(loadingProgress.Formatf(v.document.FileType(), percent), 0, v.buffer.Height-1, v.defaultFormat)
+}
+
 func (v *documentView) Buffer() *raster.Buffer {
+	// The document may have been modified through another View.
+	v.clampCursor()
+	v.scrollToCursor()
 	v.buffer.Fill(raster.Cell{' ', v.defaultFormat})
-	v.document.RenderInto(v.buffer, v, v.offsetColumn, v.offsetLine)
+	v.rows = v.layout()
+	v.drawRows()
+	v.drawLoading()
+	v.drawMatches()
+	v.drawSelection()
+	for _, c := range v.cursors {
+		if cell := v.cell(c.line, c.column, 0); cell != nil {
+			cell.F.Bg = colors.LightGray
+			cell.F.Fg = colors.Black
+		}
+	}
 	// TODO(maruel): Draw the cursor using proper terminal function.
-	cell := v.buffer.Cell(v.offsetColumn+v.cursorColumn, v.offsetLine+v.cursorLine)
-	cell.F.Bg = colors.White
-	cell.F.Fg = colors.Black
-	// TODO(maruel): Draw the selection over.
+	if cell := v.cell(v.cursorLine, v.cursorColumn, v.columnAdd()); cell != nil {
+		cell.F.Bg = colors.White
+		cell.F.Fg = colors.Black
+	}
 	return v.buffer
 }
 
-// cursorMoved triggers the event and ensures the cursor is visible.
+// cursorMoved triggers the event for the primary cursor. The cursor is made
+// visible on the next redraw.
 func (v *documentView) cursorMoved(e wicore.Editor) {
+	if v.movingSecondary {
+		return
+	}
 	e.TriggerDocumentCursorMoved(v.document, v.cursorColumn, v.cursorLine)
-	// TODO(maruel): Adjust v.offsetLine and v.offsetColumn as necessary.
+	if v.selection.kind != noSelection {
+		v.selectionChanged(e)
+	}
 	// TODO(maruel): Trigger redraw.
 }
 
-func (v *documentView) onKeyPress(e wicore.Editor, k key.Press) {
-	// TODO(maruel): Only get when the View is active.
-	l := v.document.content[v.cursorLine]
-	v.document.content[v.cursorLine] = l[:v.cursorColumn] + string(k.Ch) + l[v.cursorColumn:]
-	v.cursorColumn++
+// scrollToCursor adjusts the offsets so the cursor is inside the View.
+func (v *documentView) scrollToCursor() {
+	if v.wordWrap {
+		v.scrollToCursorWrapped()
+		return
+	}
+	if v.cursorLine < v.offsetLine {
+		v.offsetLine = v.cursorLine
+	} else if h := v.buffer.Height; h != 0 && v.cursorLine >= v.offsetLine+h {
+		v.offsetLine = v.cursorLine - h + 1
+	}
+	if x := v.virtualColumn(); x < v.offsetColumn {
+		v.offsetColumn = x
+	} else if w := v.buffer.Width; w != 0 && x >= v.offsetColumn+w {
+		v.offsetColumn = x - w + 1
+	}
+}
+
+// clampCursor ensures the cursors are inside the document. When columnMode is
+// set, they can stay past the end of the lines.
+func (v *documentView) clampCursor() {
+	last := v.document.lineCount() - 1
+	if v.cursorLine > last {
+		v.cursorLine = last
+	}
+	if l := v.document.lineLength(v.cursorLine); v.cursorColumn > l && !v.columnMode {
+		v.cursorColumn = l
+	}
+	a := &v.selection.anchor
+	if a.line > last {
+		a.line = last
+	}
+	if l := v.document.lineLength(a.line); a.column > l && !v.columnMode {
+		a.column = l
+	}
+	for i := range v.cursors {
+		c := &v.cursors[i]
+		if c.line > last {
+			c.line = last
+		}
+		if l := v.document.lineLength(c.line); c.column > l && !v.columnMode {
+			c.column = l
+		}
+	}
+}
+
+// setCursorOffset moves the cursor to a byte offset in the document.
+func (v *documentView) setCursorOffset(e wicore.Editor, offset int) {
+	v.cursorLine, v.cursorColumn = v.document.position(offset)
 	v.cursorColumnMax = v.cursorColumn
 	v.cursorMoved(e)
+}
+
+// onKeyPress inserts the key in the document at every cursor. It is called by
+// the editor in Insert mode when the View is active and the key is not mapped
+// to a command.
+func (v *documentView) onKeyPress(e wicore.Editor, k key.Press) {
+	if v.document.loading {
+		// TODO(maruel): Beep.
+		return
+	}
+	var s string
+	if k.Ch != 0 {
+		s = string(k.Ch)
+	} else {
+		switch k.Key {
+		case key.Enter:
+			s = "\n"
+		case key.Space:
+			s = " "
+		case key.Tab:
+			s = "\t"
+		default:
+			return
+		}
+	}
+	v.fillVirtual()
+	v.insertAll(e, s)
 	// TODO(maruel): Implement dirty instead.
 	e.TriggerTerminalResized()
 }
@@ -91,7 +224,23 @@ func cmdToDoc(handler func(v *documentView, e wicore.EditorW)) wicore.CommandImp
 	}
 }
 
+func motionToDoc(handler func(v *documentView, e wicore.EditorW)) wicore.MotionImplHandler {
+	return func(c *wicore.MotionImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+		v, ok := w.View().(*documentView)
+		if !ok {
+			e.ExecuteCommand(w, "alert", "Internal error")
+			return
+		}
+		handler(v, e)
+	}
+}
+
 func cmdDocumentCursorLeft(v *documentView, e wicore.EditorW) {
+	if x := v.virtualColumn(); v.columnMode && x != 0 {
+		v.setVirtualColumn(x - 1)
+		v.cursorMoved(e)
+		return
+	}
 	if v.cursorColumn == 0 {
 		// TODO(maruel): Make wrap behavior optional.
 		if v.cursorLine == 0 {
@@ -99,16 +248,24 @@ func cmdDocumentCursorLeft(v *documentView, e wicore.EditorW) {
 			return
 		}
 		v.cursorLine--
-		v.cursorColumn = len(v.document.content[v.cursorLine]) - 1
+		v.cursorColumn = v.document.lineLength(v.cursorLine)
+	} else {
+		v.cursorColumn--
 	}
 	v.cursorColumnMax = v.cursorColumn
 	v.cursorMoved(e)
 }
 
 func cmdDocumentCursorRight(v *documentView, e wicore.EditorW) {
-	if v.cursorColumn == len(v.document.content[v.cursorLine])-1 {
+	if v.columnMode {
+		// The cursor goes past the end of the line instead of wrapping.
+		v.setVirtualColumn(v.virtualColumn() + 1)
+		v.cursorMoved(e)
+		return
+	}
+	if v.cursorColumn >= v.document.lineLength(v.cursorLine) {
 		// TODO(maruel): Make wrap behavior optional.
-		if v.cursorLine > len(v.document.content)-1 {
+		if v.cursorLine >= v.document.lineCount()-1 {
 			// TODO(maruel): Beep.
 			return
 		}
@@ -126,21 +283,38 @@ func cmdDocumentCursorUp(v *documentView, e wicore.EditorW) {
 		// TODO(maruel): Beep.
 		return
 	}
+	if v.columnMode {
+		// The cursor keeps its display column.
+		x := v.virtualColumn()
+		v.cursorLine--
+		v.setVirtualColumn(x)
+		v.cursorMoved(e)
+		return
+	}
 	v.cursorLine--
-	if v.cursorColumn >= len(v.document.content[v.cursorLine]) {
-		v.cursorColumn = len(v.document.content[v.cursorLine]) - 1
+	v.cursorColumn = v.cursorColumnMax
+	if l := v.document.lineLength(v.cursorLine); v.cursorColumn > l {
+		v.cursorColumn = l
 	}
 	v.cursorMoved(e)
 }
 
 func cmdDocumentCursorDown(v *documentView, e wicore.EditorW) {
-	if v.cursorLine >= len(v.document.content)-1 {
+	if v.cursorLine >= v.document.lineCount()-1 {
 		// TODO(maruel): Beep.
 		return
 	}
+	if v.columnMode {
+		x := v.virtualColumn()
+		v.cursorLine++
+		v.setVirtualColumn(x)
+		v.cursorMoved(e)
+		return
+	}
 	v.cursorLine++
-	if v.cursorColumn >= len(v.document.content[v.cursorLine]) {
-		v.cursorColumn = len(v.document.content[v.cursorLine]) - 1
+	v.cursorColumn = v.cursorColumnMax
+	if l := v.document.lineLength(v.cursorLine); v.cursorColumn > l {
+		v.cursorColumn = l
 	}
 	v.cursorMoved(e)
 }
@@ -154,91 +328,366 @@ func cmdDocumentCursorHome(v *documentView, e wicore.EditorW) {
 	}
 }
 
+func cmdDocumentRedo(v *documentView, e wicore.EditorW) {
+	if v.document.large {
+		e.ExecuteCommand(nil, "alert", notInLargeFileMode.String())
+		return
+	}
+	offset, ok := v.document.redo()
+	if !ok {
+		e.ExecuteCommand(nil, "alert", newestChange.String())
+		return
+	}
+	// The secondary cursors and the selection can't be restored.
+	v.cursors = nil
+	v.setSelection(e, noSelection)
+	v.setCursorOffset(e, offset)
+	// TODO(maruel): Implement dirty instead.
+	e.TriggerTerminalResized()
+}
+
+func cmdDocumentUndo(v *documentView, e wicore.EditorW) {
+	if v.document.large {
+		e.ExecuteCommand(nil, "alert", notInLargeFileMode.String())
+		return
+	}
+	offset, ok := v.document.undo()
+	if !ok {
+		e.ExecuteCommand(nil, "alert", oldestChange.String())
+		return
+	}
+	v.cursors = nil
+	v.setSelection(e, noSelection)
+	v.setCursorOffset(e, offset)
+	// TODO(maruel): Implement dirty instead.
+	e.TriggerTerminalResized()
+}
+
+func cmdUndoList(v *documentView, e wicore.EditorW) {
+	args := append([]string{"0", "floating", "list", undoListTitle.Formatf(v.Title())}, v.document.history.list()...)
+	e.ExecuteCommand(nil, "window_new", args...)
+}
+
 func cmdDocumentCursorEnd(v *documentView, e wicore.EditorW) {
-	if v.cursorLine != len(v.document.content)-1 || v.cursorColumnMax != len(v.document.content[v.cursorLine])-1 {
-		v.cursorLine = len(v.document.content) - 1
-		v.cursorColumn = len(v.document.content[v.cursorLine]) - 1
+	last := v.document.lineCount() - 1
+	if v.cursorLine != last || v.cursorColumnMax != v.document.lineLength(last) {
+		v.cursorLine = last
+		v.cursorColumn = v.document.lineLength(last)
 		v.cursorColumnMax = v.cursorColumn
 		v.cursorMoved(e)
 	}
 }
 
+// documentViewFactory creates a View of a document. args can contain the ID of
+// an already loaded document; otherwise a new document is created.
 func documentViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	var doc *document
+	if len(args) != 0 {
+		for _, d := range e.AllDocuments() {
+			if d.ID() == args[0] {
+				doc, _ = d.(*document)
+				break
+			}
+		}
+	}
+	if doc == nil {
+		doc = e.(*editor).newDocument("")
+		// TODO(maruel): Obviously, no initial content.
+		doc.reset(text.NewString("Dummy content\nReally\n"))
+		doc.scanFileType(e.(*editor))
+	}
 	dispatcher := makeCommands()
 	cmds := []wicore.Command{
-		&wicore.CommandImpl{
+		&wicore.MotionImpl{
 			"document_cursor_left",
+			wicore.MotionExclusive,
+			false,
+			motionToDoc(forEachCursor(cmdDocumentCursorLeft)),
+			lang.Map{
+				lang.En: "Moves cursor left",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_left [count]\nMoves cursor left.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_right",
+			wicore.MotionExclusive,
+			false,
+			motionToDoc(forEachCursor(cmdDocumentCursorRight)),
+			lang.Map{
+				lang.En: "Moves cursor right",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_right [count]\nMoves cursor right.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_row_down",
+			wicore.MotionExclusive,
+			false,
+			motionToDoc(forEachCursor(cmdDocumentCursorRowDown)),
+			lang.Map{
+				lang.En: "Moves cursor down by one row of the View",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_row_down [count]\nMoves cursor down by one row of the View. It differs from document_cursor_down only for the long lines shown on several rows, see view_set_wrap.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_row_up",
+			wicore.MotionExclusive,
+			false,
+			motionToDoc(forEachCursor(cmdDocumentCursorRowUp)),
+			lang.Map{
+				lang.En: "Moves cursor up by one row of the View",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_row_up [count]\nMoves cursor up by one row of the View. It differs from document_cursor_up only for the long lines shown on several rows, see view_set_wrap.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_up",
+			wicore.MotionLinewise,
+			false,
+			motionToDoc(forEachCursor(cmdDocumentCursorUp)),
+			lang.Map{
+				lang.En: "Moves cursor up",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_up [count]\nMoves cursor up.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_down",
+			wicore.MotionLinewise,
+			false,
+			motionToDoc(forEachCursor(cmdDocumentCursorDown)),
+			lang.Map{
+				lang.En: "Moves cursor down",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_down [count]\nMoves cursor down.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_home",
+			wicore.MotionLinewise,
+			false,
+			motionToDoc(forEachCursor(cmdDocumentCursorHome)),
+			lang.Map{
+				lang.En: "Moves cursor to the beginning of the document",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_home [count]\nMoves cursor to the beginning of the document.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_end",
+			wicore.MotionLinewise,
+			false,
+			motionToDoc(forEachCursor(cmdDocumentCursorEnd)),
+			lang.Map{
+				lang.En: "Moves cursor to the end of the document",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_end [count]\nMoves cursor to the end of the document.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_cursor_add_above",
 			0,
-			cmdToDoc(cmdDocumentCursorLeft),
+			cmdToDoc(cmdDocumentCursorAddAbove),
 			wicore.WindowCategory,
 			lang.Map{
-				lang.En: "Moves cursor left",
+				lang.En: "Adds a cursor on the line above",
 			},
 			lang.Map{
-				lang.En: "Moves cursor left.",
+				lang.En: "Adds a cursor on the line above the topmost cursor, at the column of the primary cursor. Repeating it creates a block of cursors.",
 			},
 		},
 		&wicore.CommandImpl{
-			"document_cursor_right",
+			"document_cursor_add_below",
 			0,
-			cmdToDoc(cmdDocumentCursorRight),
+			cmdToDoc(cmdDocumentCursorAddBelow),
 			wicore.WindowCategory,
 			lang.Map{
-				lang.En: "Moves cursor right",
+				lang.En: "Adds a cursor on the line below",
 			},
 			lang.Map{
-				lang.En: "Moves cursor right.",
+				lang.En: "Adds a cursor on the line below the bottommost cursor, at the column of the primary cursor. Repeating it creates a block of cursors.",
 			},
 		},
 		&wicore.CommandImpl{
-			"document_cursor_up",
+			"document_cursor_add_next_match",
 			0,
-			cmdToDoc(cmdDocumentCursorUp),
+			cmdToDoc(cmdDocumentCursorAddNextMatch),
 			wicore.WindowCategory,
 			lang.Map{
-				lang.En: "Moves cursor up",
+				lang.En: "Adds a cursor at the next occurrence of the word under the cursor",
 			},
 			lang.Map{
-				lang.En: "Moves cursor up.",
+				lang.En: "Adds a cursor at the next occurrence of the whole word under the primary cursor, at the same position in the word, and makes it the primary cursor. The search wraps around the end of the document.",
 			},
 		},
 		&wicore.CommandImpl{
-			"document_cursor_down",
+			"document_cursors_add_regexp",
+			-1,
+			cmdDocumentCursorsAddRegexp,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Adds a cursor at every match of a regexp",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursors_add_regexp <regexp>\nAdds a cursor at the start of every match of a regexp in the document. The arguments are joined with a space.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_cursors_clear",
 			0,
-			cmdToDoc(cmdDocumentCursorDown),
+			cmdToDoc(cmdDocumentCursorsClear),
 			wicore.WindowCategory,
 			lang.Map{
-				lang.En: "Moves cursor down",
+				lang.En: "Removes the secondary cursors",
 			},
 			lang.Map{
-				lang.En: "Moves cursor down.",
+				lang.En: "Removes all the cursors except the primary one.",
 			},
 		},
 		&wicore.CommandImpl{
-			"document_cursor_home",
+			"document_delete_left",
 			0,
-			cmdToDoc(cmdDocumentCursorHome),
+			cmdToDoc(cmdDocumentDeleteLeft),
 			wicore.WindowCategory,
 			lang.Map{
-				lang.En: "Moves cursor to the beginning of the document",
+				lang.En: "Deletes the character before the cursors",
 			},
 			lang.Map{
-				lang.En: "Moves cursor to the beginning of the document.",
+				lang.En: "Deletes the character before every cursor.",
 			},
 		},
 		&wicore.CommandImpl{
-			"document_cursor_end",
+			"document_delete_right",
 			0,
-			cmdToDoc(cmdDocumentCursorEnd),
+			cmdToDoc(cmdDocumentDeleteRight),
 			wicore.WindowCategory,
 			lang.Map{
-				lang.En: "Moves cursor to the end of the document",
+				lang.En: "Deletes the character under the cursors",
 			},
 			lang.Map{
-				lang.En: "Moves cursor to the end of the document.",
+				lang.En: "Deletes the character under every cursor.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_redo",
+			0,
+			cmdToDoc(cmdDocumentRedo),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Redoes the last undone change",
+			},
+			lang.Map{
+				lang.En: "Redoes the last undone change. When multiple branches exist in the undo tree, the most recently visited one is followed.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_undo",
+			0,
+			cmdToDoc(cmdDocumentUndo),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Undoes the last change",
+			},
+			lang.Map{
+				lang.En: "Undoes the last change. A change is either a whole Insert mode session or the edits done by a single command. The history is shared by all the views of the document and is a tree, so editing after undoing creates a new branch instead of discarding the undone changes.",
+			},
+		},
+		&wicore.CommandImpl{
+			"selection_all",
+			0,
+			cmdToDoc(cmdSelectionAll),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the whole document",
+			},
+			lang.Map{
+				lang.En: "Selects the whole document, with the cursor at the end.",
+			},
+		},
+		&wicore.CommandImpl{
+			"selection_clear",
+			0,
+			cmdToDoc(cmdSelectionClear),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Removes the selection",
+			},
+			lang.Map{
+				lang.En: "Removes the selection. The text is not modified.",
+			},
+		},
+		&wicore.CommandImpl{
+			"selection_extend",
+			-1,
+			cmdSelectionExtend,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Extends the selection with a motion",
+			},
+			lang.Map{
+				lang.En: "Usage: selection_extend <command> <args...>\nRuns a motion command, like document_cursor_down, so the selection extends to the new cursor position. A character selection is started at the cursor if there is no selection.",
+			},
+		},
+		&wicore.CommandImpl{
+			"selection_start",
+			1,
+			cmdSelectionStart,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Starts a selection at the cursor",
+			},
+			lang.Map{
+				lang.En: "Usage: selection_start <char|line|block>\nStarts a character, line or block selection anchored at the cursor. The selection follows the cursor until it is cleared. If there is already a selection, only its kind is changed.",
+			},
+		},
+		&wicore.CommandImpl{
+			"selection_swap_anchor",
+			0,
+			cmdToDoc(cmdSelectionSwapAnchor),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Moves the cursor to the other end of the selection",
+			},
+			lang.Map{
+				lang.En: "Swaps the cursor and the anchor of the selection, so the other end of the selection can be moved.",
+			},
+		},
+		&wicore.CommandImpl{
+			"selection_to_cursors",
+			0,
+			cmdToDoc(cmdSelectionToCursors),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Adds a cursor on each line of the selection",
+			},
+			lang.Map{
+				lang.En: "Replaces the selection with a cursor on each of its lines, at the column of the cursor. It is meant to edit a block selection with multiple cursors.",
+			},
+		},
+		&wicore.CommandImpl{
+			"undo_list",
+			0,
+			cmdToDoc(cmdUndoList),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Lists the branches of the undo tree",
+			},
+			lang.Map{
+				lang.En: "Lists the leaves of the undo tree of the document, with their change number, the number of changes from the original content and the time of the last edit.",
 			},
 		},
 	}
+	cmds = append(cmds, documentMotions()...)
 	for _, cmd := range cmds {
 		dispatcher.Register(cmd)
 	}
@@ -246,35 +695,131 @@ func documentViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
 	bindings := makeKeyBindings()
 	bindings.Set(wicore.AllMode, key.Press{Key: key.Left}, "document_cursor_left")
 	bindings.Set(wicore.AllMode, key.Press{Key: key.Right}, "document_cursor_right")
-	bindings.Set(wicore.AllMode, key.Press{Key: key.Up}, "document_cursor_up")
-	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "document_cursor_down")
-	bindings.Set(wicore.AllMode, key.Press{Key: key.Home}, "document_cursor_home")
-	bindings.Set(wicore.AllMode, key.Press{Key: key.End}, "document_cursor_end")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Up}, "document_cursor_row_up")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "document_cursor_row_down")
+	bindings.Set(wicore.OperatorPending, key.Press{Key: key.Up}, "document_cursor_up")
+	bindings.Set(wicore.OperatorPending, key.Press{Key: key.Down}, "document_cursor_down")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Home}, "document_cursor_line_start")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.End}, "document_cursor_line_end")
+	bindings.Set(wicore.AllMode, key.Press{Ctrl: true, Key: key.Home}, "document_cursor_home")
+	bindings.Set(wicore.AllMode, key.Press{Ctrl: true, Key: key.End}, "document_cursor_end")
+	bindings.Set(wicore.AllMode, key.Press{Alt: true, Key: key.Up}, "document_cursor_add_above")
+	bindings.Set(wicore.AllMode, key.Press{Alt: true, Key: key.Down}, "document_cursor_add_below")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Delete}, "document_delete_right")
+	bindings.Set(wicore.Insert, key.Press{Key: key.Backspace}, "document_delete_left")
 	// vim style movement.
-	bindings.Set(wicore.Normal, key.Press{Ch: 'h'}, "document_cursor_left")
-	bindings.Set(wicore.Normal, key.Press{Ch: 'l'}, "document_cursor_right")
-	bindings.Set(wicore.Normal, key.Press{Ch: 'k'}, "document_cursor_up")
-	bindings.Set(wicore.Normal, key.Press{Ch: 'j'}, "document_cursor_down")
+	for _, mode := range []wicore.KeyboardMode{wicore.Normal, wicore.Visual, wicore.VisualLine, wicore.VisualBlock, wicore.OperatorPending} {
+		bindings.Set(mode, key.Press{Ch: 'h'}, "document_cursor_left")
+		bindings.Set(mode, key.Press{Ch: 'l'}, "document_cursor_right")
+		if mode == wicore.OperatorPending {
+			// The operators apply to whole lines, even when wrapped.
+			bindings.Set(mode, key.Press{Ch: 'k'}, "document_cursor_up")
+			bindings.Set(mode, key.Press{Ch: 'j'}, "document_cursor_down")
+		} else {
+			bindings.Set(mode, key.Press{Ch: 'k'}, "document_cursor_row_up")
+			bindings.Set(mode, key.Press{Ch: 'j'}, "document_cursor_row_down")
+		}
+		bindings.Set(mode, key.Press{Ch: 'w'}, "document_cursor_word_next")
+		bindings.Set(mode, key.Press{Ch: 'b'}, "document_cursor_word_prev")
+		bindings.Set(mode, key.Press{Ch: 'e'}, "document_cursor_word_end")
+		bindings.Set(mode, key.Press{Ch: 'W'}, "document_cursor_bigword_next")
+		bindings.Set(mode, key.Press{Ch: 'B'}, "document_cursor_bigword_prev")
+		bindings.Set(mode, key.Press{Ch: 'E'}, "document_cursor_bigword_end")
+		bindings.Set(mode, key.Press{Ch: '0'}, "document_cursor_line_start")
+		bindings.Set(mode, key.Press{Ch: '^'}, "document_cursor_line_first_nonblank")
+		bindings.Set(mode, key.Press{Ch: '$'}, "document_cursor_line_end")
+		bindings.SetSequence(mode, []key.Press{{Ch: 'g'}, {Ch: 'g'}}, "document_cursor_first_line")
+		bindings.Set(mode, key.Press{Ch: 'G'}, "document_cursor_last_line")
+		bindings.Set(mode, key.Press{Ch: '{'}, "document_cursor_paragraph_prev")
+		bindings.Set(mode, key.Press{Ch: '}'}, "document_cursor_paragraph_next")
+		bindings.Set(mode, key.Press{Ch: '('}, "document_cursor_sentence_prev")
+		bindings.Set(mode, key.Press{Ch: ')'}, "document_cursor_sentence_next")
+		bindings.Set(mode, key.Press{Ch: '%'}, "document_cursor_match_pair")
+		if mode != wicore.Normal {
+			// Text objects.
+			for _, o := range []struct {
+				keys string
+				name string
+			}{
+				{"w", "word"}, {"W", "bigword"}, {"p", "paragraph"},
+				{"\"", "double_quote"}, {"'", "single_quote"}, {"`", "backtick"},
+				{"()b", "paren"}, {"[]", "bracket"}, {"{}B", "brace"}, {"<>", "angle"},
+			} {
+				for _, k := range o.keys {
+					bindings.SetSequence(mode, []key.Press{{Ch: 'i'}, {Ch: k}}, "document_cursor_object_"+o.name+"_inner")
+					bindings.SetSequence(mode, []key.Press{{Ch: 'a'}, {Ch: k}}, "document_cursor_object_"+o.name+"_outer")
+				}
+			}
+		}
+		if mode == wicore.OperatorPending {
+			continue
+		}
+		// Operators, see key_parser.go.
+		bindings.Set(mode, key.Press{Ch: 'c'}, "operator_change")
+		bindings.Set(mode, key.Press{Ch: 'd'}, "operator_delete")
+		bindings.Set(mode, key.Press{Ch: 'y'}, "operator_yank")
+		bindings.Set(mode, key.Press{Ch: '>'}, "operator_indent")
+		bindings.Set(mode, key.Press{Ch: '<'}, "operator_dedent")
+		// Search, see search.go.
+		bindings.Set(mode, key.Press{Ch: '/'}, "search_prompt")
+		bindings.Set(mode, key.Press{Ch: '?'}, "search_prompt_backward")
+		bindings.Set(mode, key.Press{Ch: 'n'}, "search_next")
+		bindings.Set(mode, key.Press{Ch: 'N'}, "search_prev")
+		bindings.Set(mode, key.Press{Ch: '*'}, "search_word")
+		bindings.Set(mode, key.Press{Ch: '#'}, "search_word_backward")
+		// Marks, see marks.go.
+		bindings.Set(mode, key.Press{Ch: 'm'}, "mark_set")
+		bindings.Set(mode, key.Press{Ch: '\''}, "mark_jump_line")
+		bindings.Set(mode, key.Press{Ch: '`'}, "mark_jump")
+		if mode != wicore.Normal {
+			bindings.Set(mode, key.Press{Ch: 'o'}, "selection_swap_anchor")
+			bindings.Set(mode, key.Press{Ch: 'x'}, "operator_delete")
+			bindings.Set(mode, key.Press{Ch: '~'}, "operator_case_toggle")
+			bindings.Set(mode, key.Press{Ch: 'u'}, "operator_case_lower")
+			bindings.Set(mode, key.Press{Ch: 'U'}, "operator_case_upper")
+		}
+	}
+	bindings.SetSequence(wicore.Normal, []key.Press{{Ch: 'g'}, {Ch: '~'}}, "operator_case_toggle")
+	bindings.Set(wicore.Normal, key.Press{Ctrl: true, Ch: 'o'}, "jump_older")
+	bindings.Set(wicore.Normal, key.Press{Ctrl: true, Ch: 'i'}, "jump_newer")
+	bindings.Set(wicore.Normal, key.Press{Key: key.Tab}, "jump_newer")
+	bindings.SetSequence(wicore.Normal, []key.Press{{Ch: 'g'}, {Ch: ';'}}, "change_older")
+	bindings.SetSequence(wicore.Normal, []key.Press{{Ch: 'g'}, {Ch: ','}}, "change_newer")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'q'}, "macro_record")
+	bindings.Set(wicore.Normal, key.Press{Ch: '@'}, "macro_play")
+	bindings.SetSequence(wicore.Normal, []key.Press{{Ch: 'g'}, {Ch: 'u'}}, "operator_case_lower")
+	bindings.SetSequence(wicore.Normal, []key.Press{{Ch: 'g'}, {Ch: 'U'}}, "operator_case_upper")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'u'}, "document_undo")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'p'}, "register_put")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'P'}, "register_put_before")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'Y'}, "register_yank")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'x'}, "document_delete_right")
+	bindings.Set(wicore.Normal, key.Press{Ctrl: true, Ch: 'n'}, "document_cursor_add_next_match")
+	bindings.Set(wicore.Normal, key.Press{Ctrl: true, Ch: 'r'}, "document_redo")
+	bindings.Set(wicore.Normal, key.Press{Key: key.Escape}, "document_cursors_clear")
 
 	// TODO(maruel): Sort out "use max space".
 	// TODO(maruel): Load last cursor position from config.
 	v := &documentView{
-		view: view{
-			commands:      dispatcher,
-			keyBindings:   bindings,
-			id:            id,
-			title:         "<Empty document>", // TODO(maruel): Title == document.filePath ?
-			naturalX:      100,
-			naturalY:      100,
-			defaultFormat: raster.CellFormat{Fg: colors.BrightYellow, Bg: colors.Black},
+		docView: docView{
+			view: view{
+				commands:      dispatcher,
+				keyBindings:   bindings,
+				id:            id,
+				title:         "<Empty document>",
+				naturalX:      100,
+				naturalY:      100,
+				defaultFormat: raster.CellFormat{Fg: colors.BrightYellow, Bg: colors.Black},
+			},
+			document: doc,
 		},
-		document: makeDocument(),
 	}
+	if ed := e.(*editor); ed.search.highlight {
+		v.highlight = ed.search.last
+	}
+	doc.views++
 	v.onAttach = func(_ *view, w wicore.Window) {
 		v.cursorMoved(e)
 	}
-	v.events = append(v.events, e.RegisterTerminalKeyPressed(func(k key.Press) {
-		v.onKeyPress(e, k)
-	}))
 	return v
 }
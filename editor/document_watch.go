@@ -0,0 +1,197 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Handling of the files modified on disk by other programs.
+
+package editor
+
+import (
+	"io/ioutil"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// onFileChanged is called in the UI goroutine when a watched file may have
+// been modified on disk. stat is the state of the file after the
+// modification.
+func (e *editor) onFileChanged(filePath string, stat fileStat, err error) {
+	if err != nil {
+		// The file was deleted. The document is kept as is, so it can be saved
+		// again.
+		return
+	}
+	for _, d := range e.documents {
+		if doc, ok := d.(*document); ok && doc.filePath != "" && absPath(doc.filePath) == filePath {
+			doc.onDiskChanged(e, stat)
+		}
+	}
+}
+
+// watch starts watching the document's file, if it changed.
+func (d *document) watch(e *editor) {
+	if d.watched == d.filePath {
+		return
+	}
+	if d.watched != "" {
+		e.watcher.unwatch(d.watched)
+	}
+	d.watched = d.filePath
+	d.watcher = e.watcher
+	if d.watched != "" {
+		d.watcher.watch(d.watched)
+	}
+}
+
+// onDiskChanged reloads the document if it is not dirty, otherwise asks the
+// user what to do.
+func (d *document) onDiskChanged(e *editor, stat fileStat) {
+	if d.loading || d.saving || stat.equal(d.diskStat) {
+		// Changes done by this process are ignored.
+		return
+	}
+	d.diskStat = stat
+	// The file may have been atomically replaced, and its old inode reused by
+	// an unrelated file.
+	d.identity = getFileIdentity(d.filePath)
+	e.TriggerDocumentChangedOnDisk(d)
+	if !d.IsDirty() {
+		if d.large && stat.size > int64(len(d.format.encoding.bom())+d.content.Len()) {
+			// Assume it was appended to, like a log file, instead of indexing the
+			// whole file again.
+			d.size = stat.size
+			d.loadAppended(e)
+			return
+		}
+		d.reload(e)
+		return
+	}
+	e.ExecuteCommand(e.ActiveWindow(), "window_new", "0", "floating", "document_changed", d.ID())
+}
+
+// reload discards the content and loads the file again. The undo history is
+// lost. The FileType is scanned again from the new content.
+func (d *document) reload(e *editor) {
+	d.content = text.Buffer{}
+	_ = d.closeHandle()
+	d.identity = getFileIdentity(d.filePath)
+	d.setFileType(e, wicore.Scanning)
+	d.load(e)
+}
+
+// diffWithDisk asynchronously diffs the content with the file on disk. onDone
+// is called in the UI goroutine with the diff.
+func (d *document) diffWithDisk(e *editor, onDone func(diff []string)) {
+	filePath := d.filePath
+	d.diffWith(e, filePath, func() (text.Buffer, error) {
+		b, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return text.Buffer{}, err
+		}
+		return text.New(newDecoder(detectEncoding(b, true)).decode(b, true)), nil
+	}, onDone)
+}
+
+// diffWith asynchronously diffs the content with the content returned by
+// read, which is called in a background goroutine. name is the file read,
+// for error reporting. onDone is called in the UI goroutine with the diff.
+func (d *document) diffWith(e *editor, name string, read func() (text.Buffer, error), onDone func(diff []string)) {
+	content := d.content
+	wicore.Go("documentDiff", func() {
+		var diff []string
+		other, err := read()
+		if err != nil {
+			diff = []string{failedToOpen.Formatf(name, err)}
+		} else {
+			diff = diffLines(splitLines(content), splitLines(other))
+		}
+		d.runInUI(e, func() {
+			onDone(diff)
+		})
+	})
+}
+
+// documentChangedViewFactory asks what to do with a modified document whose
+// file was modified on disk. args[0] is the document ID, the remaining
+// arguments are the diff to show, if any.
+func documentChangedViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	var doc *document
+	for _, d := range e.AllDocuments() {
+		if d.ID() == args[0] {
+			doc, _ = d.(*document)
+			break
+		}
+	}
+	title := ""
+	if doc != nil {
+		title = doc.filePath
+	}
+	lines := append([]string{changedOnDisk.Formatf(title), changedOnDiskChoices.String()}, args[1:]...)
+	v := makeListView(id, title, lines)
+	if doc == nil {
+		return v
+	}
+
+	keep := func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+		e.ExecuteCommand(w, "window_close", w.ID())
+	}
+	reload := func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+		e.ExecuteCommand(w, "window_close", w.ID())
+		doc.reload(e.(*editor))
+	}
+	showDiff := func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+		e.ExecuteCommand(w, "window_close", w.ID())
+		doc.diffWithDisk(e.(*editor), func(diff []string) {
+			e.ExecuteCommand(nil, "window_new", append([]string{"0", "floating", "document_changed", doc.ID()}, diff...)...)
+		})
+	}
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"document_changed_diff",
+			0,
+			showDiff,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Shows the differences with the file on disk",
+			},
+			lang.Map{
+				lang.En: "Shows the differences between the document and the file modified on disk.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_changed_keep",
+			0,
+			keep,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Keeps the document as is",
+			},
+			lang.Map{
+				lang.En: "Keeps the document as is, ignoring the modification on disk. Saving the document overwrites the file.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_changed_reload",
+			0,
+			reload,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Reloads the document from disk",
+			},
+			lang.Map{
+				lang.En: "Reloads the document from disk, discarding the modifications.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		v.commands.Register(cmd)
+	}
+	v.keyBindings.Set(wicore.AllMode, key.Press{Key: key.Escape}, "document_changed_keep")
+	v.keyBindings.Set(wicore.AllMode, key.Press{Ch: 'd'}, "document_changed_diff")
+	v.keyBindings.Set(wicore.AllMode, key.Press{Ch: 'k'}, "document_changed_keep")
+	v.keyBindings.Set(wicore.AllMode, key.Press{Ch: 'r'}, "document_changed_reload")
+	return v
+}
@@ -7,6 +7,8 @@ package editor
 import (
 	"io"
 	"log"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/wi-ed/wi/wicore"
@@ -38,7 +40,8 @@ type Editor interface {
 // the Editor interface.
 type editor struct {
 	wicore.EventRegistry
-	deferred      chan func()
+	deferred      chan<- func()                 // Functions to run in the UI goroutine, see event_registry_impl.go.
+	queue         <-chan func()                 // Functions posted on deferred, read by the event loop.
 	terminal      Terminal                      // Abstract terminal interface to the real terminal.
 	rootWindow    *window                       // The rootWindow is always DockingFill and set to the size of the terminal.
 	lastActive    []wicore.Window               // Most recently used order of Window activatd.
@@ -47,15 +50,44 @@ type editor struct {
 	viewReady     chan bool                     // A View.Buffer() is ready to be drawn.
 	keyboardMode  wicore.KeyboardMode           // Global keyboard mode instead of per Window, it's more logical for users.
 	plugins       Plugins                       // All loaded plugin processes.
+	watcher       fileWatcher                   // Watches the files of the documents for modifications by other programs.
+	largeFileSize int64                         // Files at least this large are loaded lazily, see document.large.
+	swapDir       string                        // Directory of the swap files, see swapFile.
+	fileTypes     []fileTypeScanner             // Scanners determining the FileType of the documents. Replaced, never modified, so it can be used from any goroutine.
+	registers     map[rune]register             // Content of the writable registers, see registers.go.
+	lastCommand   string                        // Last command line run from the command window, the ":" register.
+	keyParser     keyParser                     // Keys typed in Normal and Visual modes, see key_parser.go.
+	search        searchState                   // Last search and search history, see search.go.
+	substitute    substituteState               // Last substitution, see substitute.go.
+	editGroup     int                           // > 0 while a command runs other commands as a single edit, like document_global.
+	globalMarks   map[rune]*document            // Document holding each global mark A-Z, see mark_set.
+	macro         macroState                    // Keyboard macro being recorded or played, see macros.go.
 	nextViewID    int
+	nextDocID     int
+	resizing      int32 // 1 while a TerminalResized event is queued, see TriggerTerminalResized.
 }
 
 func (e *editor) Close() error {
-	if e.plugins == nil {
-		return nil
+	var err error
+	// The swap files are kept; this is also called when panicking. They were
+	// already deleted for the documents saved or closed normally.
+	for _, doc := range e.documents {
+		if err2 := doc.Close(); err == nil {
+			err = err2
+		}
+	}
+	if e.watcher != nil {
+		if err2 := e.watcher.Close(); err == nil {
+			err = err2
+		}
+		e.watcher = nil
+	}
+	if e.plugins != nil {
+		if err2 := e.plugins.Close(); err == nil {
+			err = err2
+		}
+		e.plugins = nil
 	}
-	err := e.plugins.Close()
-	e.plugins = nil
 	return err
 }
 
@@ -75,16 +107,37 @@ func (e *editor) onTerminalMetaKeyPressed(k key.Press) {
 	if !k.IsMeta() {
 		panic("Unexpected non-meta")
 	}
+	if _, ok := e.ActiveWindow().View().(*commandView); ok {
+		// The command window handles all the keys by itself.
+		return
+	}
+	if e.KeyboardMode() != wicore.Insert {
+		e.keyParser.onKey(e, k)
+		return
+	}
 	cmdName := wicore.GetKeyBindingCommand(e, e.KeyboardMode(), k)
 	if cmdName != "" {
 		// The command is executed inline, since the key was already enqueued in
 		// the event queue.
 		e.ExecuteCommand(e.ActiveWindow(), cmdName)
+		e.sealEdits()
 	} else {
 		e.ExecuteCommand(e.ActiveWindow(), "alert", notMapped.Formatf(k))
 	}
 }
 
+// keyboardModeHandler is implemented by the Views reacting to the keyboard mode
+// of the editor, like a documentView selecting text in the Visual modes.
+type keyboardModeHandler interface {
+	onKeyboardModeChanged(e wicore.Editor, mode wicore.KeyboardMode)
+}
+
+// keyPressHandler is implemented by the Views handling the unmapped keys in
+// Insert mode.
+type keyPressHandler interface {
+	onKeyPress(e wicore.Editor, k key.Press)
+}
+
 func (e *editor) onTerminalKeyPressed(k key.Press) {
 	if !k.IsValid() {
 		panic("Unexpected non-key")
@@ -92,6 +145,24 @@ func (e *editor) onTerminalKeyPressed(k key.Press) {
 	if k.IsMeta() {
 		panic("Unexpected meta")
 	}
+	active := e.ActiveWindow()
+	if _, ok := active.View().(*commandView); ok {
+		// The command window handles all the keys by itself.
+		return
+	}
+	if e.KeyboardMode() != wicore.Insert {
+		// Normal and Visual modes parse counts, registers and operators.
+		e.keyParser.onKey(e, k)
+		return
+	}
+	cmdName := wicore.GetKeyBindingCommand(e, e.KeyboardMode(), k)
+	if cmdName != "" {
+		e.ExecuteCommand(active, cmdName)
+		e.sealEdits()
+	} else if v, ok := active.View().(keyPressHandler); ok {
+		// Unmapped keys are text to insert.
+		v.onKeyPress(e, k)
+	}
 }
 
 func (e *editor) ExecuteCommand(w wicore.Window, cmdName string, args ...string) {
@@ -107,10 +178,52 @@ func (e *editor) ExecuteCommand(w wicore.Window, cmdName string, args ...string)
 	}
 }
 
+// runCommandLine runs a command line typed in the command window. It is kept
+// in the ":" register. Ex command lines, like ":%s/a/b/", are converted, see
+// ex.go.
+func (e *editor) runCommandLine(line string) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return
+	}
+	e.lastCommand = line
+	e.executeLine(e.ActiveWindow(), line)
+	e.sealEdits()
+}
+
+// executeLine runs a command line. The arguments are separated by spaces,
+// except for the ex command lines.
+func (e *editor) executeLine(w wicore.Window, line string) {
+	args, ok := parseExCommand(line)
+	if !ok {
+		if args = strings.Fields(line); len(args) == 0 {
+			return
+		}
+	}
+	e.ExecuteCommand(w, args[0], args[1:]...)
+}
+
+// feedKeys processes keys as if they were typed, for "normal" in
+// document_global. See parseKeys for the syntax. Insert mode is left at the
+// end.
+func (e *editor) feedKeys(keys string) {
+	for _, k := range parseKeys(keys) {
+		if k.IsMeta() {
+			e.onTerminalMetaKeyPressed(k)
+		} else {
+			e.onTerminalKeyPressed(k)
+		}
+	}
+	e.keyParser.reset()
+	e.setKeyboardMode(wicore.Normal)
+}
+
 func (e *editor) onCommands(cmds wicore.EnqueuedCommands) {
 	for _, cmd := range cmds.Commands {
 		e.ExecuteCommand(e.ActiveWindow(), cmd[0], cmd[1:]...)
 	}
+	// All the edits done by a batch of commands are undone at once.
+	e.sealEdits()
 	if cmds.Callback != nil {
 		cmds.Callback()
 	}
@@ -120,6 +233,52 @@ func (e *editor) KeyboardMode() wicore.KeyboardMode {
 	return e.keyboardMode
 }
 
+func (e *editor) RegisterContent(name string) string {
+	if r, ok := registerArg([]string{name}); ok {
+		if reg, ok := e.register(r); ok {
+			return reg.text
+		}
+	}
+	return ""
+}
+
+func (e *editor) SelectedText() string {
+	if v, ok := e.ActiveWindow().View().(*documentView); ok && v.selection.kind != noSelection {
+		return v.selectionText()
+	}
+	return ""
+}
+
+// setKeyboardMode changes the global keyboard mode.
+func (e *editor) setKeyboardMode(mode wicore.KeyboardMode) {
+	if e.keyboardMode == mode {
+		return
+	}
+	e.keyboardMode = mode
+	e.keyParser.reset()
+	// Entering or leaving Insert mode delimits an undo group.
+	e.sealEdits()
+	if v, ok := e.ActiveWindow().View().(keyboardModeHandler); ok {
+		v.onKeyboardModeChanged(e, mode)
+	}
+	e.TriggerEditorKeyboardModeChanged(mode)
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+// sealEdits closes the current undo group of every document. It does nothing
+// in Insert mode, so the whole insert session is a single undo step, and while
+// a command groups the edits of the commands it runs.
+func (e *editor) sealEdits() {
+	if e.keyboardMode == wicore.Insert || e.editGroup != 0 {
+		return
+	}
+	for _, d := range e.documents {
+		if doc, ok := d.(*document); ok {
+			doc.history.seal()
+		}
+	}
+}
+
 // draw descends the whole Window tree and redraw Windows.
 func (e *editor) draw() {
 	log.Print("draw()")
@@ -138,6 +297,47 @@ func (e *editor) AllDocuments() []wicore.Document {
 	return out
 }
 
+// newDocument creates a new document and registers it. The document is empty
+// and filePath is not loaded.
+func (e *editor) newDocument(filePath string) *document {
+	doc := makeDocument(e.nextDocID)
+	e.nextDocID++
+	doc.filePath = filePath
+	e.documents = append(e.documents, doc)
+	doc.onClosed = func() {
+		e.removeDocument(doc)
+	}
+	e.TriggerDocumentCreated(doc)
+	return doc
+}
+
+// removeDocument unregisters a document once closed.
+func (e *editor) removeDocument(doc *document) {
+	for i, d := range e.documents {
+		if d == doc {
+			copy(e.documents[i:], e.documents[i+1:])
+			e.documents[len(e.documents)-1] = nil
+			e.documents = e.documents[:len(e.documents)-1]
+			return
+		}
+	}
+}
+
+// documentByIdentity returns the document of the file id, if it is opened.
+// Closed documents are ignored.
+func (e *editor) documentByIdentity(id fileIdentity) *document {
+	for _, d := range e.documents {
+		if doc, ok := d.(*document); ok && doc.identity.same(id) {
+			select {
+			case <-doc.done:
+			default:
+				return doc
+			}
+		}
+	}
+	return nil
+}
+
 func (e *editor) AllPlugins() []wicore.PluginDetails {
 	out := make([]wicore.PluginDetails, len(e.plugins))
 	for i, v := range e.plugins {
@@ -158,6 +358,11 @@ func (e *editor) activateWindow(w wicore.Window) {
 		return
 	}
 
+	if win, ok := w.(*window); ok {
+		win.raise()
+		wicore.PostCommand(e, nil, "editor_redraw")
+	}
+
 	// First remove w from e.lastActive, second add w as e.lastActive[0].
 	// This kind of manual list shuffling is really Go's achille heel.
 	// TODO(maruel): There's no way I got it right on the first try without a
@@ -165,7 +370,7 @@ func (e *editor) activateWindow(w wicore.Window) {
 	for i, v := range e.lastActive {
 		if v == w {
 			if i > 0 {
-				copy(e.lastActive[:i], e.lastActive[1:i+1])
+				copy(e.lastActive[1:i+1], e.lastActive[:i])
 				e.lastActive[0] = w
 			}
 			return
@@ -175,11 +380,34 @@ func (e *editor) activateWindow(w wicore.Window) {
 	// This Window has never been active.
 	l := len(e.lastActive)
 	e.lastActive = append(e.lastActive, nil)
-	copy(e.lastActive[:l], e.lastActive[1:l])
+	copy(e.lastActive[1:], e.lastActive[:l])
 	e.lastActive[0] = w
 	e.TriggerViewActivated(view)
 }
 
+// forgetWindow removes w and its children Windows from the list of recently
+// active Windows. It must be called before w is detached.
+func (e *editor) forgetWindow(w *window) {
+	isChild := func(c wicore.Window) bool {
+		for ; c != nil; c = c.Parent() {
+			if c == wicore.Window(w) {
+				return true
+			}
+		}
+		return false
+	}
+	out := e.lastActive[:0]
+	for _, v := range e.lastActive {
+		if !isChild(v) {
+			out = append(out, v)
+		}
+	}
+	e.lastActive = out
+	if len(e.lastActive) == 0 {
+		e.lastActive = append(e.lastActive, e.rootWindow)
+	}
+}
+
 func (e *editor) RegisterViewFactory(name string, viewFactory wicore.ViewFactory) bool {
 	_, present := e.viewFactories[name]
 	e.viewFactories[name] = viewFactory
@@ -194,7 +422,18 @@ func (e *editor) ViewFactoryNames() []string {
 	return names
 }
 
+// TriggerTerminalResized coalesces the events. The commands editing a
+// document trigger one per edit, to redraw the Windows, and only one is
+// needed until it is processed. It may be called from any goroutine.
+func (e *editor) TriggerTerminalResized() {
+	if atomic.CompareAndSwapInt32(&e.resizing, 0, 1) {
+		e.EventRegistry.TriggerTerminalResized()
+	}
+}
+
 func (e *editor) onTerminalResized() {
+	// The edits done from now on need another event.
+	atomic.StoreInt32(&e.resizing, 0)
 	// Resize the Windows. This also invalidates it, which will also force a
 	// redraw if the size changed.
 	w, h := e.terminal.Size()
@@ -230,7 +469,7 @@ func (e *editor) EventLoop() int {
 	var drawTimer <-chan time.Time = fakeChan
 	for {
 		select {
-		case i := <-e.deferred:
+		case i := <-e.queue:
 			if i == nil {
 				// Happens on exit. Drawing only happens to make unit tests happy.
 				// Should be removed eventually.
@@ -266,15 +505,6 @@ func (e *editor) EventLoop() int {
 	}
 }
 
-func (e *editor) isDirty() bool {
-	for _, doc := range e.documents {
-		if doc.IsDirty() {
-			return true
-		}
-	}
-	return false
-}
-
 func (e *editor) loadPlugins() {
 	paths, err := enumPlugins(getPluginsPaths())
 	if err != nil {
@@ -306,10 +536,11 @@ func (e *editor) loadPlugins() {
 // be used by the object created by this function.
 func MakeEditor(terminal Terminal, noPlugin bool) (Editor, error) {
 	lang.Set(lang.En)
-	reg, deferred := makeEventRegistry()
+	reg, deferred, queue := makeEventRegistry()
 	e := &editor{
 		EventRegistry: reg,
 		deferred:      deferred,
+		queue:         queue,
 		terminal:      terminal,
 		rootWindow:    nil,                         // It is set below due to circular reference.
 		lastActive:    make([]wicore.Window, 1, 8), // It is set below.
@@ -317,7 +548,13 @@ func MakeEditor(terminal Terminal, noPlugin bool) (Editor, error) {
 		viewFactories: make(map[string]wicore.ViewFactory),
 		viewReady:     make(chan bool),
 		keyboardMode:  wicore.Normal,
+		largeFileSize: defaultLargeFileSize,
+		swapDir:       swapDirectory(),
+		fileTypes:     defaultFileTypeScanners(),
+		registers:     make(map[rune]register),
+		globalMarks:   make(map[rune]*document),
 		nextViewID:    1,
+		nextDocID:     1,
 	}
 
 	// The root view is important, it defines all the global commands. It is
@@ -332,14 +569,29 @@ func MakeEditor(terminal Terminal, noPlugin bool) (Editor, error) {
 	RegisterViewCommands(cmds)
 	RegisterWindowCommands(cmds)
 	RegisterDocumentCommands(cmds)
+	RegisterOperatorCommands(cmds)
+	RegisterRegisterCommands(cmds)
+	RegisterSearchCommands(cmds)
+	RegisterMarkCommands(cmds)
+	RegisterMacroCommands(cmds)
 	RegisterEditorDefaults(rootView)
 
 	RegisterDefaultViewFactories(e)
 
+	e.watcher = newFileWatcher(func(filePath string) {
+		stat, err := statFile(filePath)
+		e.deferred <- func() {
+			e.onFileChanged(filePath, stat, err)
+		}
+	})
+
 	e.rootWindow = makeWindow(nil, rootView, wicore.DockingFill)
 	e.rootWindow.e = e
 	e.lastActive[0] = e.rootWindow
 
+	// The macros see the keys before anything else, see macros.go.
+	e.RegisterTerminalMetaKeyPressed(e.onMacroKey)
+	e.RegisterTerminalKeyPressed(e.onMacroKey)
 	e.RegisterTerminalMetaKeyPressed(e.onTerminalMetaKeyPressed)
 	e.RegisterTerminalKeyPressed(e.onTerminalKeyPressed)
 	e.RegisterTerminalResized(e.onTerminalResized)
@@ -363,6 +615,10 @@ func MakeEditor(terminal Terminal, noPlugin bool) (Editor, error) {
 // Commands
 
 func cmdAlert(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+	if ed, ok := e.(*editor); ok {
+		// Like in vim, an error stops the macro being played.
+		ed.stopMacro()
+	}
 	e.ExecuteCommand(w, "window_new", "0", "bottom", "infobar_alert", args[0])
 }
 
@@ -373,11 +629,17 @@ func cmdEditorBootstrapUI(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Wind
 func cmdEditorCommandWindow(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
 	// Create the Window with the command view and attach it to the currently
 	// focused Window.
+	if isVisualMode(e.KeyboardMode()) {
+		// Like in vim, the command applies to the lines selected.
+		e.ExecuteCommand(w, "key_set_normal")
+		e.ExecuteCommand(w, "window_new", w.ID(), "floating", "command", "", "'<,'>")
+		return
+	}
 	e.ExecuteCommand(w, "window_new", w.ID(), "floating", "command")
 }
 
 func cmdEditorQuit(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
-	if len(args) >= 1 {
+	if len(args) > 1 {
 		e.ExecuteCommand(w, "alert", c.LongDesc())
 		return
 	} else if len(args) == 1 {
@@ -386,10 +648,13 @@ func cmdEditorQuit(c *privilegedCommandImpl, e *editor, w *window, args ...strin
 			return
 		}
 	} else {
-		if e.isDirty() {
-			// TODO(maruel): For each dirty Document, "prompt" y/n to force quit. If
-			// 'n', stop there.
-			return
+		for _, doc := range e.documents {
+			if doc.IsDirty() {
+				// TODO(maruel): For each dirty Document, "prompt" y/n to force quit. If
+				// 'n', stop there.
+				e.ExecuteCommand(w, "alert", viewDirty.Formatf(doc))
+				return
+			}
 		}
 		// TODO(maruel):
 		// - Send a signal to each plugin.
@@ -406,6 +671,16 @@ func cmdEditorRedraw(c *privilegedCommandImpl, e *editor, w *window, args ...str
 	})
 }
 
+func cmdEditorSetLargeFileSize(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	size, ok := parseSize(args[0])
+	if !ok {
+		e.ExecuteCommand(w, "alert", invalidSize.Formatf(args[0]))
+		return
+	}
+	// It only affects the files loaded afterward.
+	e.largeFileSize = size
+}
+
 // RegisterEditorDefaults registers the top-level native commands and key
 // bindings.
 func RegisterEditorDefaults(view wicore.ViewW) {
@@ -470,6 +745,18 @@ func RegisterEditorDefaults(view wicore.ViewW) {
 				lang.En: "Forcibly redraws the terminal.",
 			},
 		},
+		&privilegedCommandImpl{
+			"editor_set_large_file_size",
+			1,
+			cmdEditorSetLargeFileSize,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Sets the size from which files are loaded lazily",
+			},
+			lang.Map{
+				lang.En: "Usage: editor_set_large_file_size <size>\nSets the size from which files are opened in large file mode, for example 64M. In this mode, only the displayed parts of the file are kept in memory, and the undo history and the file type detection are disabled. It affects the files opened afterward.",
+			},
+		},
 		&wicore.CommandAlias{"q", "editor_quit", nil},
 		&wicore.CommandAlias{"q!", "editor_quit", []string{"force"}},
 		&wicore.CommandAlias{"quit", "editor_quit", nil},
@@ -481,7 +768,30 @@ func RegisterEditorDefaults(view wicore.ViewW) {
 
 	bindings := view.KeyBindingsW()
 	bindings.Set(wicore.AllMode, key.Press{Key: key.F1}, "help")
-	bindings.Set(wicore.AllMode, key.Press{Ch: ':'}, "editor_command_window")
+	bindings.Set(wicore.Normal, key.Press{Ch: ':'}, "editor_command_window")
 	bindings.Set(wicore.AllMode, key.Press{Ctrl: true, Ch: 'c'}, "quit")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'i'}, "key_set_insert")
 	bindings.Set(wicore.Insert, key.Press{Key: key.Escape}, "key_set_normal")
+	// Pressing the key of the current Visual mode goes back to Normal mode.
+	visual := []struct {
+		mode    wicore.KeyboardMode
+		k       key.Press
+		cmdName string
+	}{
+		{wicore.Visual, key.Press{Ch: 'v'}, "key_set_visual"},
+		{wicore.VisualLine, key.Press{Ch: 'V'}, "key_set_visual_line"},
+		{wicore.VisualBlock, key.Press{Ctrl: true, Ch: 'v'}, "key_set_visual_block"},
+	}
+	for _, from := range visual {
+		bindings.Set(wicore.Normal, from.k, from.cmdName)
+		bindings.Set(from.mode, key.Press{Key: key.Escape}, "key_set_normal")
+		bindings.Set(from.mode, key.Press{Ch: ':'}, "editor_command_window")
+		for _, to := range visual {
+			if to.mode == from.mode {
+				bindings.Set(from.mode, to.k, "key_set_normal")
+			} else {
+				bindings.Set(from.mode, to.k, to.cmdName)
+			}
+		}
+	}
 }
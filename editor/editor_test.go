@@ -94,3 +94,25 @@ func TestMainInvalidThenQuit(t *testing.T) {
 	expected.DrawString("Status Name    Normal                                            Status Position", 0, 24, raster.CellFormat{Fg: colors.Red, Bg: colors.LightGray})
 	compareBuffers(t, expected, terminal.Buffer)
 }
+
+func TestDocumentClosed(t *testing.T) {
+	e, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	var doc *document
+	var docs []wicore.Document
+	wicore.PostCommand(e, nil, "editor_bootstrap_ui")
+	wicore.PostCommand(e, func() {
+		w := e.ActiveWindow()
+		doc = w.View().(*documentView).document
+		docs = e.AllDocuments()
+		e.ExecuteCommand(w, "window_close", w.ID())
+	}, "new")
+	wicore.PostCommand(e, nil, "editor_quit")
+	ut.AssertEqual(t, 0, e.EventLoop())
+	ut.AssertEqual(t, []wicore.Document{doc}, docs)
+	ut.AssertEqual(t, true, doc.isClosed())
+	ut.AssertEqual(t, []wicore.Document{}, e.AllDocuments())
+}
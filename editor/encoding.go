@@ -0,0 +1,405 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Character encodings. The content of a document is always UTF-8 in memory;
+// it is converted from the file encoding on load and back on save.
+
+package editor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// encoding is the character encoding of a document on disk.
+type encoding int
+
+const (
+	utf8Encoding encoding = iota
+	utf8BOMEncoding
+	utf16LEEncoding
+	utf16BEEncoding
+	latin1Encoding
+	windows1252Encoding
+	binaryEncoding // Not text; the bytes are kept as is, without line ending conversion.
+)
+
+var encodingNames = []string{
+	"utf-8",
+	"utf-8-bom",
+	"utf-16le",
+	"utf-16be",
+	"latin1",
+	"windows-1252",
+	"binary",
+}
+
+// encodingAliases are the other accepted names for document_set_encoding.
+var encodingAliases = map[string]encoding{
+	"utf8":       utf8Encoding,
+	"utf-16":     utf16LEEncoding,
+	"iso-8859-1": latin1Encoding,
+	"latin-1":    latin1Encoding,
+	"cp1252":     windows1252Encoding,
+}
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// windows1252 maps the bytes 0x80 to 0x9F, which differ from Latin-1. The 5
+// undefined bytes are mapped to the C1 control character, like Latin-1, so
+// they survive a round trip.
+var windows1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+func (e encoding) String() string {
+	if e < 0 || int(e) >= len(encodingNames) {
+		return fmt.Sprintf("encoding(%d)", int(e))
+	}
+	return encodingNames[e]
+}
+
+// bom returns the byte order mark written at the start of the file, if any.
+func (e encoding) bom() []byte {
+	switch e {
+	case utf8BOMEncoding:
+		return utf8BOM
+	case utf16LEEncoding:
+		return utf16LEBOM
+	case utf16BEEncoding:
+		return utf16BEBOM
+	default:
+		return nil
+	}
+}
+
+// stringToEncoding returns the encoding named s.
+func stringToEncoding(s string) (encoding, bool) {
+	s = strings.ToLower(s)
+	for i, n := range encodingNames {
+		if n == s {
+			return encoding(i), true
+		}
+	}
+	e, ok := encodingAliases[s]
+	return e, ok
+}
+
+// detectEncoding guesses the encoding of a file from its first bytes. eof is
+// true if head is the whole file.
+//
+// The BOM is trusted first. Then a valid UTF-8 head is considered UTF-8, as
+// it is very unlikely that legacy 8 bits text is valid UTF-8. A head with NUL
+// bytes that is not UTF-16 is binary. Otherwise, heuristics are used.
+func detectEncoding(head []byte, eof bool) encoding {
+	switch {
+	case bytes.HasPrefix(head, utf8BOM):
+		return utf8BOMEncoding
+	case bytes.HasPrefix(head, utf16LEBOM):
+		return utf16LEEncoding
+	case bytes.HasPrefix(head, utf16BEBOM):
+		return utf16BEEncoding
+	}
+	if e, ok := detectUTF16(head); ok {
+		return e
+	}
+	if bytes.IndexByte(head, 0) != -1 {
+		return binaryEncoding
+	}
+	if !eof {
+		// The head may end in the middle of a multi-bytes sequence.
+		i := len(head) - 1
+		for i > 0 && i > len(head)-utf8.UTFMax && !utf8.RuneStart(head[i]) {
+			i--
+		}
+		if i >= 0 && !utf8.FullRune(head[i:]) {
+			head = head[:i]
+		}
+	}
+	if utf8.Valid(head) {
+		return utf8Encoding
+	}
+	// Bytes in 0x80-0x9F are control characters in Latin-1 that are basically
+	// never used in text, so they are a strong hint for Windows-1252 unless an
+	// undefined Windows-1252 character is used.
+	c1 := false
+	for _, b := range head {
+		switch b {
+		case 0x81, 0x8D, 0x8F, 0x90, 0x9D:
+			return latin1Encoding
+		}
+		if b >= 0x80 && b <= 0x9F {
+			c1 = true
+		}
+	}
+	if c1 {
+		return windows1252Encoding
+	}
+	return latin1Encoding
+}
+
+// detectUTF16 detects UTF-16 text without a BOM by looking at the NUL bytes.
+// ASCII text encoded in UTF-16 has a NUL byte every other byte.
+func detectUTF16(head []byte) (encoding, bool) {
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if len(head) < 4 {
+		return utf8Encoding, false
+	}
+	even := 0
+	odd := 0
+	for i, b := range head {
+		if b == 0 {
+			if i&1 == 0 {
+				even++
+			} else {
+				odd++
+			}
+		}
+	}
+	half := len(head) / 2
+	if odd > half/2 && even == 0 {
+		return utf16LEEncoding, true
+	}
+	if even > half/2 && odd == 0 {
+		return utf16BEEncoding, true
+	}
+	return utf8Encoding, false
+}
+
+// decoder converts a file into UTF-8 chunk by chunk.
+type decoder struct {
+	enc   encoding
+	start bool   // true until the BOM, if any, was skipped.
+	carry []byte // Incomplete sequence at the end of the previous chunk.
+}
+
+func newDecoder(enc encoding) *decoder {
+	return &decoder{enc: enc, start: true}
+}
+
+// decode converts the next chunk into UTF-8. Unless eof is true, an
+// incomplete sequence at the end of buf is kept for the next call.
+func (d *decoder) decode(buf []byte, eof bool) []byte {
+	if len(d.carry) != 0 {
+		buf = append(d.carry, buf...)
+		d.carry = nil
+	}
+	if d.start {
+		bom := d.enc.bom()
+		if !eof && len(buf) < len(bom) && bytes.HasPrefix(bom, buf) {
+			// Wait to have the whole BOM.
+			d.carry = append([]byte{}, buf...)
+			return nil
+		}
+		d.start = false
+		buf = bytes.TrimPrefix(buf, bom)
+	}
+
+	switch d.enc {
+	case binaryEncoding:
+		return buf
+
+	case latin1Encoding, windows1252Encoding:
+		out := make([]byte, 0, len(buf)+len(buf)/2)
+		for _, b := range buf {
+			r := rune(b)
+			if d.enc == windows1252Encoding && b >= 0x80 && b <= 0x9F {
+				r = windows1252[b-0x80]
+			}
+			out = appendRune(out, r)
+		}
+		return out
+
+	case utf16LEEncoding, utf16BEEncoding:
+		if !eof {
+			// Keep an odd byte or a high surrogate for the next chunk.
+			n := len(buf) &^ 1
+			if n >= 2 {
+				if u := d.unit(buf[n-2:]); u >= 0xD800 && u < 0xDC00 {
+					n -= 2
+				}
+			}
+			d.carry = append([]byte{}, buf[n:]...)
+			buf = buf[:n]
+		}
+		units := make([]uint16, 0, len(buf)/2)
+		for i := 0; i+1 < len(buf); i += 2 {
+			units = append(units, d.unit(buf[i:]))
+		}
+		out := make([]byte, 0, len(buf))
+		for _, r := range utf16.Decode(units) {
+			out = appendRune(out, r)
+		}
+		if len(buf)&1 != 0 {
+			out = appendRune(out, utf8.RuneError)
+		}
+		return out
+
+	default:
+		if !eof {
+			// Do not cut a multi-bytes UTF-8 sequence in half, so the rune count
+			// stays accurate.
+			i := len(buf) - 1
+			for i > 0 && i > len(buf)-utf8.UTFMax && !utf8.RuneStart(buf[i]) {
+				i--
+			}
+			if i >= 0 && !utf8.FullRune(buf[i:]) {
+				d.carry = append(d.carry, buf[i:]...)
+				buf = buf[:i]
+			}
+		}
+		return buf
+	}
+}
+
+// unit returns the UTF-16 code unit at the start of b.
+func (d *decoder) unit(b []byte) uint16 {
+	if d.enc == utf16BEEncoding {
+		return uint16(b[0])<<8 | uint16(b[1])
+	}
+	return uint16(b[1])<<8 | uint16(b[0])
+}
+
+func appendRune(out []byte, r rune) []byte {
+	if r < utf8.RuneSelf {
+		return append(out, byte(r))
+	}
+	var tmp [utf8.UTFMax]byte
+	n := utf8.EncodeRune(tmp[:], r)
+	return append(out, tmp[:n]...)
+}
+
+// encodeRune appends r encoded in enc to out. Returns false if r can't be
+// represented in enc.
+func encodeRune(out []byte, r rune, enc encoding) ([]byte, bool) {
+	switch enc {
+	case latin1Encoding:
+		if r > 0xFF {
+			return out, false
+		}
+		return append(out, byte(r)), true
+
+	case windows1252Encoding:
+		if r < 0x80 || (r > 0x9F && r <= 0xFF) {
+			return append(out, byte(r)), true
+		}
+		for i, c := range windows1252 {
+			if c == r {
+				return append(out, byte(0x80+i)), true
+			}
+		}
+		return out, false
+
+	case utf16LEEncoding, utf16BEEncoding:
+		units := []uint16{uint16(r)}
+		if r >= 0x10000 {
+			r1, r2 := utf16.EncodeRune(r)
+			units = []uint16{uint16(r1), uint16(r2)}
+		}
+		for _, u := range units {
+			if enc == utf16BEEncoding {
+				out = append(out, byte(u>>8), byte(u))
+			} else {
+				out = append(out, byte(u), byte(u>>8))
+			}
+		}
+		return out, true
+
+	default:
+		return appendRune(out, r), true
+	}
+}
+
+// encodedContent is the content of a document converted to its file format
+// for writing to disk. It implements io.WriterTo.
+type encodedContent struct {
+	content text.Buffer
+	format  fileFormat
+}
+
+// WriteTo writes the encoded content. It fails without writing anything past
+// the first character that can't be represented in the encoding.
+//
+// With CRLF line endings, "\n" is always written as "\r\n": the content has no
+// "\r\n" left, see stripCR, so a "\r" before it is part of the line. Binary
+// content is written as is.
+func (c encodedContent) WriteTo(w io.Writer) (int64, error) {
+	enc := c.format.encoding
+	crlf := c.format.lineEnding == crlfEnding
+	n, err := w.Write(enc.bom())
+	total := int64(n)
+	if err != nil {
+		return total, err
+	}
+	if enc == utf8Encoding || enc == utf8BOMEncoding || enc == binaryEncoding {
+		if !crlf || enc == binaryEncoding {
+			// Fast path, the content is written as is.
+			n64, err := c.content.WriteTo(w)
+			return total + n64, err
+		}
+		// Only the "\r" are added. The bytes are not decoded so invalid UTF-8
+		// sequences are kept as is.
+		c.content.Walk(0, c.content.Len(), func(b []byte) bool {
+			out := make([]byte, 0, len(b)+len(b)/16)
+			for _, c := range b {
+				if c == '\n' {
+					out = append(out, '\r')
+				}
+				out = append(out, c)
+			}
+			n, err = w.Write(out)
+			total += int64(n)
+			return err == nil
+		})
+		return total, err
+	}
+
+	var carry []byte
+	c.content.Walk(0, c.content.Len(), func(b []byte) bool {
+		if len(carry) != 0 {
+			b = append(carry, b...)
+			carry = nil
+		}
+		out := make([]byte, 0, len(b)*2)
+		for len(b) != 0 {
+			if !utf8.FullRune(b) {
+				carry = append([]byte{}, b...)
+				break
+			}
+			r, size := utf8.DecodeRune(b)
+			if crlf && r == '\n' {
+				out, _ = encodeRune(out, '\r', enc)
+			}
+			var ok bool
+			if out, ok = encodeRune(out, r, enc); !ok {
+				err = fmt.Errorf("character %q can't be encoded in %s", r, enc)
+				return false
+			}
+			b = b[size:]
+		}
+		var n int
+		n, err = w.Write(out)
+		total += int64(n)
+		return err == nil
+	})
+	if err == nil && len(carry) != 0 {
+		err = fmt.Errorf("invalid UTF-8 sequence can't be encoded in %s", enc)
+	}
+	return total, err
+}
@@ -0,0 +1,65 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	data := []struct {
+		in       string
+		expected encoding
+	}{
+		{"", utf8Encoding},
+		{"héllo", utf8Encoding},
+		{"\xEF\xBB\xBFhello", utf8BOMEncoding},
+		{"\xFF\xFEh\x00i\x00", utf16LEEncoding},
+		{"\xFE\xFF\x00h\x00i", utf16BEEncoding},
+		{"h\x00e\x00l\x00l\x00o\x00", utf16LEEncoding},
+		{"h\xE9llo", latin1Encoding},
+		{"\x93quoted\x94 \x80", windows1252Encoding},
+		{"\x7FELF\x02\x01\x01\x00\x00", binaryEncoding},
+	}
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, line.expected, detectEncoding([]byte(line.in), true))
+	}
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	data := []struct {
+		enc     encoding
+		encoded string
+		decoded string
+	}{
+		{utf8BOMEncoding, "\xEF\xBB\xBFh\xC3\xA9", "hé"},
+		{utf16LEEncoding, "\xFF\xFEh\x00\xE9\x00=\xD8\x00\xDE", "hé\U0001F600"},
+		{utf16BEEncoding, "\xFE\xFF\x00h\x00\xE9", "hé"},
+		{latin1Encoding, "h\xE9", "hé"},
+		{windows1252Encoding, "\x80 \x93h\xE9\x94", "€ “hé”"},
+		{binaryEncoding, "\x00\xFF\r\n", "\x00\xFF\r\n"},
+	}
+	for i, line := range data {
+		// Decode one byte at a time to exercise the carry.
+		d := newDecoder(line.enc)
+		out := []byte{}
+		for j := 0; j < len(line.encoded); j++ {
+			out = append(out, d.decode([]byte(line.encoded[j:j+1]), j == len(line.encoded)-1)...)
+		}
+		ut.AssertEqualIndex(t, i, line.decoded, string(out))
+
+		b := &bytes.Buffer{}
+		_, err := encodedContent{text.NewString(line.decoded), fileFormat{line.enc, lfEnding}}.WriteTo(b)
+		ut.AssertEqualIndex(t, i, nil, err)
+		ut.AssertEqualIndex(t, i, line.encoded, b.String())
+	}
+
+	_, err := encodedContent{text.NewString("€"), fileFormat{latin1Encoding, lfEnding}}.WriteTo(&bytes.Buffer{})
+	ut.AssertEqual(t, true, err != nil)
+}
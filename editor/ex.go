@@ -0,0 +1,270 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Ex-style command lines, like ":%s/foo/bar/g". They start with an optional
+// line range followed by a short command name whose arguments are not split
+// on spaces.
+
+package editor
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// addressSearchTimeout bounds the search of a /pattern/ or ?pattern? address.
+const addressSearchTimeout = time.Second
+
+// exCommands maps the ex command names to the command run with the range and
+// the rest of the line as arguments.
+var exCommands = map[string]string{
+	"d":          "document_delete_lines",
+	"delete":     "document_delete_lines",
+	"g":          "document_global",
+	"g!":         "document_vglobal",
+	"global":     "document_global",
+	"global!":    "document_vglobal",
+	"j":          "document_join",
+	"join":       "document_join",
+	"s":          "document_substitute",
+	"sor":        "document_sort",
+	"sort":       "document_sort",
+	"substitute": "document_substitute",
+	"uniq":       "document_uniq",
+	"v":          "document_vglobal",
+	"vglobal":    "document_vglobal",
+}
+
+// parseExCommand converts an ex command line to a command and its arguments.
+// Returns false if the line is not an ex command.
+func parseExCommand(line string) ([]string, bool) {
+	rng, rest := splitRange(line)
+	i := 0
+	for i < len(rest) && rest[i] >= 'a' && rest[i] <= 'z' {
+		i++
+	}
+	if i < len(rest) && rest[i] == '!' {
+		// Like ":g!", a variant of the command.
+		if _, ok := exCommands[rest[:i+1]]; ok {
+			i++
+		}
+	}
+	cmdName, ok := exCommands[rest[:i]]
+	if !ok {
+		return nil, false
+	}
+	return []string{cmdName, strings.TrimSpace(rng), strings.TrimLeft(rest[i:], " ")}, true
+}
+
+// splitRange splits the range at the start of an ex command line from the
+// rest of the line. The range is not validated.
+func splitRange(line string) (string, string) {
+	i := 0
+	for i < len(line) {
+		c := line[i]
+		switch {
+		case strings.IndexByte(".$%+-,; 0123456789", c) != -1:
+			i++
+		case c == '\'' && i+1 < len(line):
+			i += 2
+		case c == '/' || c == '?':
+			i += len(scanDelimited(line[i+1:], c)) + 1
+			if i < len(line) {
+				// Skip the closing delimiter.
+				i++
+			}
+		default:
+			return line[:i], line[i:]
+		}
+	}
+	return line, ""
+}
+
+// scanDelimited returns the prefix of s up to the first delim not escaped with
+// a backslash.
+func scanDelimited(s string, delim byte) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == delim {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// unescapeDelimiter replaces the escaped delimiters with the delimiter, so
+// "\/" is "/" in a pattern delimited by "/".
+func unescapeDelimiter(s string, delim byte) string {
+	return strings.Replace(s, "\\"+string(delim), string(delim), -1)
+}
+
+// lineRange is a range of lines, both included, 0-based.
+type lineRange struct {
+	start int
+	end   int
+}
+
+// errBadRange is returned for a range with an invalid syntax.
+var errBadRange = errors.New("bad range")
+
+// parseRange evaluates a range relative to the primary cursor. An empty
+// range is the cursor line and "%" is the whole document. A backward range is
+// swapped.
+//
+// The addresses are a line number, "." for the cursor line, "$" for the last
+// line, "'<" and "'>" for the bounds of the last selection, "/regexp/" and
+// "?regexp?" for the next and the previous line matching a regexp, each
+// followed by optional "+N" and "-N" offsets. With ";" instead of "," as
+// separator, the second address is relative to the first one.
+func (v *documentView) parseRange(s string) (lineRange, error) {
+	if s == "%" {
+		return lineRange{0, lastLine(v.document)}, nil
+	}
+	cur := v.cursorLine
+	start, rest, err := v.parseAddress(s, cur)
+	if err != nil {
+		return lineRange{}, err
+	}
+	end := start
+	if rest != "" && (rest[0] == ',' || rest[0] == ';') {
+		if rest[0] == ';' {
+			cur = start
+		}
+		if end, rest, err = v.parseAddress(rest[1:], cur); err != nil {
+			return lineRange{}, err
+		}
+	}
+	if rest != "" {
+		return lineRange{}, errBadRange
+	}
+	if start > end {
+		start, end = end, start
+	}
+	if start < 0 || end >= v.document.lineCount() {
+		return lineRange{}, errors.New("out of bounds")
+	}
+	return lineRange{start, end}, nil
+}
+
+// parseAddress evaluates the address at the start of s. An empty address is
+// cur. Returns the rest of s.
+func (v *documentView) parseAddress(s string, cur int) (int, string, error) {
+	line := cur
+	switch {
+	case s == "":
+		return cur, "", nil
+	case s[0] == '.':
+		s = s[1:]
+	case s[0] == '$':
+		line = lastLine(v.document)
+		s = s[1:]
+	case s[0] >= '0' && s[0] <= '9':
+		n, rest := leadingNumber(s)
+		line, s = n-1, rest
+	case s[0] == '\'':
+		if len(s) < 2 {
+			return 0, "", errBadRange
+		}
+		c, ok := v.mark(rune(s[1]))
+		if !ok {
+			return 0, "", errors.New(markNotSet.Formatf(s[:2]))
+		}
+		line, s = c.line, s[2:]
+	case s[0] == '/' || s[0] == '?':
+		delim := s[0]
+		pattern := scanDelimited(s[1:], delim)
+		s = s[1+len(pattern):]
+		if s != "" {
+			s = s[1:]
+		}
+		p, err := compileSearch(unescapeDelimiter(pattern, delim), false)
+		if err != nil {
+			return 0, "", err
+		}
+		// The search starts on the next line, or the previous one.
+		col := v.document.lineLength(cur)
+		if delim == '?' {
+			col = 0
+		}
+		// The search runs in the UI goroutine, so it is bounded in time.
+		cancel := make(chan struct{})
+		t := time.AfterFunc(addressSearchTimeout, func() {
+			close(cancel)
+		})
+		l, _, ok := findMatch(v.document.content, p, cur, col, delim == '?', cancel)
+		t.Stop()
+		if !ok {
+			select {
+			case <-cancel:
+				return 0, "", errors.New(searchTimedOut.Formatf(p.text))
+			default:
+			}
+			return 0, "", errors.New(patternNotFound.Formatf(p.text))
+		}
+		line = l
+	}
+	for s != "" && (s[0] == '+' || s[0] == '-') {
+		sign := 1
+		if s[0] == '-' {
+			sign = -1
+		}
+		n, rest := leadingNumber(s[1:])
+		if rest == s[1:] {
+			n = 1
+		}
+		line += sign * n
+		s = rest
+	}
+	return line, strings.TrimLeft(s, " "), nil
+}
+
+// lastLine returns the last line of a document. The empty line after the
+// terminator of the last line doesn't count, like in vim.
+func lastLine(d *document) int {
+	last := d.lineCount() - 1
+	if last > 0 && d.lineLength(last) == 0 {
+		last--
+	}
+	return last
+}
+
+// leadingNumber parses the decimal number at the start of s. Returns the rest
+// of s.
+func leadingNumber(s string) (int, string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, _ := strconv.Atoi(s[:i])
+	return n, s[i:]
+}
+
+// mark returns the position of a mark usable in a range. "<" and ">" are the
+// bounds of the current selection, otherwise the last one. The marks a-z and
+// the marks A-Z set in this document are set with mark_set.
+func (v *documentView) mark(name rune) (cursor, bool) {
+	if isLocalMark(name) || isGlobalMark(name) {
+		if a, ok := v.document.marks[name]; ok && !a.deleted {
+			return position{v.document, a}.cursor(), true
+		}
+		return cursor{}, false
+	}
+	if name != '<' && name != '>' {
+		return cursor{}, false
+	}
+	bounds := v.lastSelection
+	if v.selection.kind != noSelection {
+		start, end := v.selectionBounds()
+		bounds = [2]cursor{start, end}
+	} else if v.lastSelectionKind == noSelection {
+		return cursor{}, false
+	}
+	if name == '<' {
+		return bounds[0], true
+	}
+	return bounds[1], true
+}
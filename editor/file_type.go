@@ -0,0 +1,294 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// File type detection. The scanners are run in a background goroutine once a
+// document is loaded or saved.
+
+package editor
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// scanHeadSize is the number of bytes at the beginning of a document used for
+// the shebang, the modelines and the content sniffing.
+const scanHeadSize = 4096
+
+// scanTailSize is the number of bytes at the end of a document searched for
+// modelines.
+const scanTailSize = 1024
+
+// modelineLines is the number of lines at the beginning and the end of a
+// document searched for modelines.
+const modelineLines = 5
+
+// scannerKind is the kind of information a fileTypeScanner matches. The
+// kinds are listed by increasing priority.
+type scannerKind int
+
+const (
+	contentScanner  scannerKind = iota // Regexp matched against the beginning of the content.
+	shebangScanner                     // Glob matched against the interpreter of the "#!" line.
+	nameScanner                        // Glob matched against the file name.
+	modelineScanner                    // Glob matched against the type set in a vim or emacs modeline.
+)
+
+var scannerKindNames = []string{"content", "shebang", "name", "modeline"}
+
+func (s scannerKind) String() string {
+	if s < 0 || int(s) >= len(scannerKindNames) {
+		return fmt.Sprintf("scannerKind(%d)", int(s))
+	}
+	return scannerKindNames[s]
+}
+
+func stringToScannerKind(s string) (scannerKind, bool) {
+	for i, n := range scannerKindNames {
+		if n == s {
+			return scannerKind(i), true
+		}
+	}
+	return contentScanner, false
+}
+
+// fileTypeScanner determines a FileType from one kind of information about a
+// document.
+type fileTypeScanner struct {
+	kind     scannerKind
+	pattern  string
+	re       *regexp.Regexp // Only for contentScanner.
+	fileType wicore.FileType
+}
+
+func makeFileTypeScanner(kind scannerKind, pattern string, fileType wicore.FileType) (fileTypeScanner, error) {
+	s := fileTypeScanner{kind: kind, pattern: pattern, fileType: fileType}
+	var err error
+	if kind == contentScanner {
+		s.re, err = regexp.Compile(pattern)
+	} else {
+		_, err = filepath.Match(pattern, "")
+	}
+	return s, err
+}
+
+// scanInput is the information about a document the scanners match against.
+type scanInput struct {
+	name     string // Base name of the file.
+	shebang  string // Base name of the interpreter.
+	modeline string // File type set in a modeline.
+	head     []byte
+}
+
+func (s *fileTypeScanner) match(in *scanInput) bool {
+	var value string
+	switch s.kind {
+	case contentScanner:
+		return s.re.Match(in.head)
+	case shebangScanner:
+		value = in.shebang
+	case nameScanner:
+		value = in.name
+	case modelineScanner:
+		value = in.modeline
+	}
+	if value == "" {
+		return false
+	}
+	ok, _ := filepath.Match(s.pattern, value)
+	return ok
+}
+
+// defaultFileTypeScanners returns the built-in scanners.
+func defaultFileTypeScanners() []fileTypeScanner {
+	data := []struct {
+		kind     scannerKind
+		fileType wicore.FileType
+		patterns []string
+	}{
+		{contentScanner, wicore.Binary, []string{`\x00`}},
+		{contentScanner, wicore.CodeCC, []string{`(?m)^#include\s*[<"]`}},
+		{contentScanner, wicore.CodeGo, []string{`(?m)^package \w+$`}},
+		{shebangScanner, wicore.CodeMake, []string{"make"}},
+		{shebangScanner, wicore.CodePython, []string{"python*"}},
+		{shebangScanner, wicore.CodeShell, []string{"sh", "bash", "dash", "ksh", "zsh"}},
+		{nameScanner, wicore.CodeCCHeader, []string{"*.h"}},
+		{nameScanner, wicore.CodeCCPPHeader, []string{"*.hh", "*.hpp", "*.hxx", "*.h++"}},
+		{nameScanner, wicore.CodeCCPPSource, []string{"*.cc", "*.cpp", "*.cxx", "*.c++"}},
+		{nameScanner, wicore.CodeCCSource, []string{"*.c"}},
+		{nameScanner, wicore.CodeGo, []string{"*.go"}},
+		{nameScanner, wicore.CodeMake, []string{"Makefile", "makefile", "GNUmakefile", "*.mk"}},
+		{nameScanner, wicore.CodePython, []string{"*.py"}},
+		{nameScanner, wicore.CodeShell, []string{"*.sh", "*.bash"}},
+		{nameScanner, wicore.Text, []string{"*.txt"}},
+		{nameScanner, wicore.TextMarkdown, []string{"*.md", "*.markdown"}},
+		{modelineScanner, wicore.CodeCC, []string{"c"}},
+		{modelineScanner, wicore.CodeCCPP, []string{"cpp", "c++"}},
+		{modelineScanner, wicore.CodeGo, []string{"go"}},
+		{modelineScanner, wicore.CodeMake, []string{"make", "makefile"}},
+		{modelineScanner, wicore.CodePython, []string{"python"}},
+		{modelineScanner, wicore.CodeShell, []string{"sh", "bash", "zsh", "shell-script"}},
+		{modelineScanner, wicore.Text, []string{"text"}},
+		{modelineScanner, wicore.TextMarkdown, []string{"markdown"}},
+	}
+	var out []fileTypeScanner
+	for _, d := range data {
+		for _, p := range d.patterns {
+			s, err := makeFileTypeScanner(d.kind, p, d.fileType)
+			if err != nil {
+				panic(err)
+			}
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+var (
+	vimModeline   = regexp.MustCompile(`\b(?:vi|vim|ex):.*\b(?:ft|filetype|syntax)=([\w+.-]+)`)
+	emacsModeline = regexp.MustCompile(`-\*-(.*)-\*-`)
+)
+
+// parseModeline returns the file type set by a vim or emacs modeline in line.
+func parseModeline(line string) string {
+	if m := vimModeline.FindStringSubmatch(line); m != nil {
+		return m[1]
+	}
+	if m := emacsModeline.FindStringSubmatch(line); m != nil {
+		// Either "-*- python -*-" or "-*- mode: python; coding: utf-8 -*-".
+		for _, v := range strings.Split(m[1], ";") {
+			v = strings.TrimSpace(v)
+			if strings.HasPrefix(v, "mode:") {
+				return strings.ToLower(strings.TrimSpace(v[len("mode:"):]))
+			}
+			if !strings.Contains(v, ":") && v != "" {
+				return strings.ToLower(v)
+			}
+		}
+	}
+	return ""
+}
+
+// parseShebang returns the base name of the interpreter of a "#!" line.
+func parseShebang(line string) string {
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		// "#!/usr/bin/env python3", skipping the flags.
+		interpreter = ""
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") && !strings.Contains(f, "=") {
+				interpreter = filepath.Base(f)
+				break
+			}
+		}
+	}
+	return interpreter
+}
+
+// makeScanInput extracts the information to match from a document. It is run
+// in a background goroutine.
+func makeScanInput(filePath string, content text.Buffer) *scanInput {
+	in := &scanInput{head: content.Range(0, scanHeadSize)}
+	if filePath != "" {
+		in.name = filepath.Base(filePath)
+	}
+	lines := strings.Split(string(in.head), "\n")
+	if len(lines) > 1 {
+		// The last line may be incomplete.
+		lines = lines[:len(lines)-1]
+	}
+	in.shebang = parseShebang(strings.TrimSuffix(lines[0], "\r"))
+	if len(lines) > modelineLines {
+		lines = lines[:modelineLines]
+	}
+	if content.Len() > scanHeadSize {
+		tail := content.Range(content.Len()-scanTailSize, content.Len())
+		tailLines := strings.Split(string(tail), "\n")
+		if len(tailLines) > modelineLines {
+			tailLines = tailLines[len(tailLines)-modelineLines:]
+		}
+		lines = append(lines, tailLines...)
+	} else if all := strings.Split(string(in.head), "\n"); len(all) > modelineLines {
+		lines = append(lines, all[len(all)-modelineLines:]...)
+	}
+	for _, l := range lines {
+		if in.modeline = parseModeline(l); in.modeline != "" {
+			break
+		}
+	}
+	return in
+}
+
+// scanFileType returns the FileType of a document. The scanners with the
+// highest priority kind win; for the same kind, the last registered one wins
+// so it can override the built-in ones. It is run in a background goroutine.
+func scanFileType(scanners []fileTypeScanner, in *scanInput) wicore.FileType {
+	for kind := modelineScanner; kind >= contentScanner; kind-- {
+		for i := len(scanners) - 1; i >= 0; i-- {
+			if s := &scanners[i]; s.kind == kind && s.match(in) {
+				return s.fileType
+			}
+		}
+	}
+	if bytes.IndexByte(in.head, 0) != -1 {
+		return wicore.Binary
+	}
+	return wicore.Text
+}
+
+// scanFileType asynchronously determines the FileType of the document. It must
+// be called from the UI goroutine.
+func (d *document) scanFileType(e *editor) {
+	if d.large {
+		d.setFileType(e, wicore.Large)
+		return
+	}
+	scanners := e.fileTypes
+	filePath := d.filePath
+	content := d.content
+	wicore.Go("fileTypeScan", func() {
+		fileType := scanFileType(scanners, makeScanInput(filePath, content))
+		d.runInUI(e, func() {
+			d.setFileType(e, fileType)
+		})
+	})
+}
+
+func (d *document) setFileType(e *editor, fileType wicore.FileType) {
+	if d.fileType != fileType {
+		d.fileType = fileType
+		e.TriggerDocumentFileTypeChanged(d, fileType)
+		wicore.PostCommand(e, nil, "editor_redraw")
+	}
+}
+
+func cmdFileTypeRegister(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	kind, ok := stringToScannerKind(args[1])
+	if !ok {
+		e.ExecuteCommand(w, "alert", invalidScannerKind.Formatf(args[1]))
+		return
+	}
+	s, err := makeFileTypeScanner(kind, args[2], wicore.FileType(args[0]))
+	if err != nil {
+		e.ExecuteCommand(w, "alert", invalidPattern.Formatf(args[2], err))
+		return
+	}
+	// The slice is copied so the scans in progress are not affected.
+	scanners := make([]fileTypeScanner, len(e.fileTypes), len(e.fileTypes)+1)
+	copy(scanners, e.fileTypes)
+	e.fileTypes = append(scanners, s)
+}
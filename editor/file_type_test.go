@@ -0,0 +1,86 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+func TestScanFileType(t *testing.T) {
+	rust, err := makeFileTypeScanner(nameScanner, "*.rs", wicore.FileType("Code.Rust"))
+	ut.AssertEqual(t, nil, err)
+	// Overrides the builtin scanner.
+	header, err := makeFileTypeScanner(nameScanner, "*.h", wicore.CodeCCPPHeader)
+	ut.AssertEqual(t, nil, err)
+	scanners := append(defaultFileTypeScanners(), rust, header)
+	long := strings.Repeat("foo\n", scanHeadSize)
+	data := []struct {
+		filePath string
+		content  string
+		expected wicore.FileType
+	}{
+		{"", "", wicore.Text},
+		{"/a/b.go", "", wicore.CodeGo},
+		{"/a/Makefile", "all:\n", wicore.CodeMake},
+		{"/a/b.rs", "fn main() {}\n", wicore.FileType("Code.Rust")},
+		{"/a/b.h", "", wicore.CodeCCPPHeader},
+		{"/a/b.c", "", wicore.CodeCCSource},
+		{"/a/run", "#!/bin/bash\necho\n", wicore.CodeShell},
+		{"/a/run", "#!/usr/bin/env -S python3 -u\n", wicore.CodePython},
+		{"", "package foo\n", wicore.CodeGo},
+		{"", "#include <stdio.h>\n", wicore.CodeCC},
+		{"", "a\x00b", wicore.Binary},
+		// The modeline wins over the file name.
+		{"/a/b.txt", "foo\n# vim: set ft=python:\n", wicore.CodePython},
+		{"/a/b", "# -*- mode: markdown; coding: utf-8 -*-\n", wicore.TextMarkdown},
+		{"/a/b", "# -*- sh -*-\n", wicore.CodeShell},
+		{"/a/b", long + "// vi: ft=go\n", wicore.CodeGo},
+		{"/a/b", "foo\n", wicore.Text},
+	}
+	for i, line := range data {
+		in := makeScanInput(line.filePath, text.NewString(line.content))
+		ut.AssertEqualIndex(t, i, line.expected, scanFileType(scanners, in))
+	}
+}
+
+func TestReloadScansFileType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "run")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(p, []byte("#!/bin/sh\necho\n"), 0600))
+
+	e, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	var doc *document
+	var types []wicore.FileType
+	e.RegisterDocumentFileTypeChanged(func(d wicore.Document, fileType wicore.FileType) {
+		types = append(types, fileType)
+		switch fileType {
+		case wicore.CodeShell:
+			ut.AssertEqual(t, nil, ioutil.WriteFile(p, []byte("#!/usr/bin/env python\n"), 0600))
+			doc.reload(e.(*editor))
+		case wicore.CodePython:
+			wicore.PostCommand(e, nil, "editor_quit")
+		}
+	})
+	wicore.PostCommand(e, nil, "editor_bootstrap_ui")
+	wicore.PostCommand(e, func() {
+		doc = activeDocument(e.ActiveWindow())
+	}, "open", p)
+	ut.AssertEqual(t, 0, e.EventLoop())
+	ut.AssertEqual(t, []wicore.FileType{wicore.CodeShell, wicore.Scanning, wicore.CodePython}, types)
+}
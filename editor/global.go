@@ -0,0 +1,109 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Ex-style global commands, like ":g/^$/d". The matching lines are marked
+// first with anchors, then the command is run on each marked line still
+// present. All the edits are a single undo step.
+
+package editor
+
+import (
+	"fmt"
+	"strings"
+)
+
+func cmdDocumentGlobal(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	global(e, w, args[0], args[1], false)
+}
+
+func cmdDocumentVGlobal(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	global(e, w, args[0], args[1], true)
+}
+
+// global runs a command on the lines of a range matching a pattern, or not
+// matching it if invert. expr is "/pattern/command"; without command, the
+// lines are listed.
+func global(e *editor, w *window, rng, expr string, invert bool) {
+	v, ok := w.View().(*documentView)
+	if !ok {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	if v.document.loading {
+		e.ExecuteCommand(w, "alert", stillLoading.String())
+		return
+	}
+	if e.editGroup != 0 {
+		// It would mess up the marked lines.
+		e.ExecuteCommand(w, "alert", globalRecursive.String())
+		return
+	}
+	if rng == "" {
+		rng = "%"
+	}
+	r, err := v.parseRange(rng)
+	if err != nil {
+		e.ExecuteCommand(w, "alert", invalidRange.Formatf(rng, err))
+		return
+	}
+	if expr == "" || isWordRune(rune(expr[0])) || expr[0] == '\\' || expr[0] == '"' {
+		e.ExecuteCommand(w, "alert", invalidGlobal.Formatf(expr))
+		return
+	}
+	delim := expr[0]
+	pattern := scanDelimited(expr[1:], delim)
+	cmd := expr[1+len(pattern):]
+	if cmd != "" {
+		cmd = strings.TrimSpace(cmd[1:])
+	}
+	p := e.search.last
+	if pattern != "" {
+		pattern = unescapeDelimiter(pattern, delim)
+		if p, err = compileSearch(pattern, false); err != nil {
+			e.ExecuteCommand(w, "alert", invalidPattern.Formatf(pattern, err))
+			return
+		}
+	} else if p == nil {
+		e.ExecuteCommand(w, "alert", noPreviousSearch.String())
+		return
+	}
+
+	d := v.document
+	var anchors []*anchor
+	var listed []string
+	for l := r.start; l <= r.end; l++ {
+		if line := d.line(l); p.re.MatchString(line) != invert {
+			anchors = append(anchors, d.addAnchor(d.content.LineStart(l)))
+			listed = append(listed, fmt.Sprintf("%5d  %s", l+1, line))
+		}
+	}
+	if len(anchors) == 0 {
+		e.ExecuteCommand(w, "alert", patternNotFound.Formatf(p.text))
+		return
+	}
+	if cmd == "" {
+		d.removeAnchors(anchors)
+		e.ExecuteCommand(w, "window_new", append([]string{"0", "floating", "list", globalTitle.Formatf(p.text)}, listed...)...)
+		return
+	}
+
+	e.editGroup++
+	v.cursors = nil
+	for _, a := range anchors {
+		if !a.deleted {
+			v.setPrimary(cursor{d.content.LineAt(a.offset), 0, 0})
+			if strings.HasPrefix(cmd, "normal ") {
+				e.feedKeys(strings.TrimLeft(cmd[len("normal "):], " "))
+			} else {
+				e.executeLine(w, cmd)
+			}
+		}
+	}
+	d.removeAnchors(anchors)
+	e.editGroup--
+	v.clampCursor()
+	v.cursorMoved(e)
+	// TODO(maruel): Implement dirty instead.
+	e.TriggerTerminalResized()
+}
@@ -0,0 +1,65 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestGlobal(t *testing.T) {
+	data := []struct {
+		content  string
+		keys     string
+		expected string
+	}{
+		{"a\n\nb\n\n\nc\n", ":g/^$/d\n", "a\nb\nc\n"},
+		{"a\n\nb\n\n\nc\n", ":v/^$/d\n", "\n\n\n"},
+		{"a\n\nb\n\n\nc\n", ":g!/^$/d\n", "\n\n\n"},
+		{"TODO a\nb\nTODO c\n", ":g/TODO/normal $x\n", "TODO \nb\nTODO \n"},
+		{"a\nb\nc\n", ":g/./normal ix<Escape>\n", "xa\nxb\nxc\n"},
+		{"a1\nb\na2\n", ":g/a/s/\\d/N/\n", "aN\nb\naN\n"},
+		// The lines deleted by a previous line are skipped.
+		{"a\na\nb\na\n", ":g/a/normal jdd\n", "a\nb\na\n"},
+		{"a\nb\na\nb\n", ":2,3g/a/d\n", "a\nb\nb\n"},
+		// The whole operation is a single undo step.
+		{"a\n\nb\n\n\nc\n", ":g/^$/d\nu", "a\n\nb\n\n\nc\n"},
+		{"a\nb\n", ":g/x/d\n", "a\nb\n"},
+		{"a\nb\n", ":g/(/d\n", "a\nb\n"},
+	}
+	for i, line := range data {
+		_, v := typeKeys(t, line.content, line.keys)
+		ut.AssertEqualIndex(t, i, line.expected, v.document.content.String())
+	}
+}
+
+func TestAnchors(t *testing.T) {
+	_, v := typeKeys(t, "ab\ncd\nef\n", "")
+	d := v.document
+	a := d.addAnchor(3)
+	b := d.addAnchor(6)
+	d.insert(0, "x\n")
+	ut.AssertEqual(t, anchor{5, false}, *a)
+	d.delete(4, 5)
+	ut.AssertEqual(t, anchor{4, false}, *a)
+	d.delete(4, 7)
+	ut.AssertEqual(t, anchor{4, true}, *a)
+	ut.AssertEqual(t, anchor{4, false}, *b)
+	d.removeAnchor(a)
+	d.removeAnchor(b)
+	// Only the change list is left.
+	ut.AssertEqual(t, len(d.changes), len(d.anchors))
+}
+
+func TestGlobalLarge(t *testing.T) {
+	// Thousands of marked lines, each deletion posting events to the UI
+	// goroutine and moving the anchors after it.
+	content := strings.Repeat("a\n\n", 5000)
+	_, v := typeKeys(t, content, ":g/^$/d\n")
+	ut.AssertEqual(t, strings.Repeat("a\n", 5000), v.document.content.String())
+	ut.AssertEqual(t, len(v.document.changes), len(v.document.anchors))
+}
@@ -0,0 +1,602 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Hex view of a document, to look at and edit binary files.
+
+package editor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// hexOffsetWidth is the width of the offset column, including the separator.
+const hexOffsetWidth = 10
+
+// hexView shows the bytes of a document as rows of an offset, the bytes in
+// hexadecimal and the bytes in ASCII. The bytes are the content as kept in
+// memory, which is the file content for binary files; see binaryEncoding.
+//
+// In Insert mode, typing overwrites the bytes instead of inserting. Typing
+// past the end appends bytes.
+type hexView struct {
+	docView
+	cursor     int    // Byte offset of the cursor. It can be at the end of the document to append.
+	lowNibble  bool   // true if the next hex digit typed replaces the low nibble of the byte.
+	ascii      bool   // true if the cursor is in the ASCII column instead of the hexadecimal one.
+	offsetRow  int    // First row shown.
+	lastSearch []byte // Pattern of the last search, for hex_search_next.
+}
+
+// bytesPerRow returns the number of bytes that fit on a row. It is a power of
+// 2 to keep the offsets readable.
+func (v *hexView) bytesPerRow() int {
+	n := 16
+	for n > 4 && hexOffsetWidth+4*n+1 > v.buffer.Width {
+		n /= 2
+	}
+	return n
+}
+
+func (v *hexView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{' ', v.defaultFormat})
+	size := v.document.content.Len()
+	if v.cursor > size {
+		// The document may have been modified through another View.
+		v.cursor = size
+	}
+	n := v.bytesPerRow()
+	row := v.cursor / n
+	if row < v.offsetRow {
+		v.offsetRow = row
+	} else if h := v.buffer.Height; h != 0 && row >= v.offsetRow+h {
+		v.offsetRow = row - h + 1
+	}
+	for y := 0; y < v.buffer.Height; y++ {
+		start := (v.offsetRow + y) * n
+		if start > size || (start == size && start != 0 && v.cursor != size) {
+			break
+		}
+		v.buffer.DrawString(formatHexRow(start, v.document.content.Range(start, start+n), n), 0, y, v.defaultFormat)
+	}
+	if v.buffer.Width != 0 && v.buffer.Height != 0 {
+		i := v.cursor % n
+		y := row - v.offsetRow
+		hexCell := v.buffer.Cell(hexOffsetWidth+3*i, y)
+		asciiCell := v.buffer.Cell(hexOffsetWidth+3*n+1+i, y)
+		if v.lowNibble {
+			hexCell = v.buffer.Cell(hexOffsetWidth+3*i+1, y)
+		}
+		active, inactive := hexCell, asciiCell
+		if v.ascii {
+			active, inactive = asciiCell, hexCell
+		}
+		active.F.Bg = colors.White
+		active.F.Fg = colors.Black
+		inactive.F.Bg = colors.LightGray
+		inactive.F.Fg = colors.Black
+	}
+	v.drawLoading()
+	return v.buffer
+}
+
+// formatHexRow formats the bytes b starting at offset start, on a row of n
+// bytes.
+func formatHexRow(start int, b []byte, n int) string {
+	out := make([]byte, 0, hexOffsetWidth+4*n+1)
+	out = append(out, fmt.Sprintf("%08x  ", start)...)
+	for i := 0; i < n; i++ {
+		if i < len(b) {
+			out = append(out, hex.EncodeToString(b[i:i+1])...)
+			out = append(out, ' ')
+		} else {
+			out = append(out, "   "...)
+		}
+	}
+	out = append(out, ' ')
+	for _, c := range b {
+		if c < 0x20 || c > 0x7E {
+			c = '.'
+		}
+		out = append(out, c)
+	}
+	return string(out)
+}
+
+// setCursor moves the cursor to a byte offset, clamped to the document.
+func (v *hexView) setCursor(e wicore.Editor, offset int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if size := v.document.content.Len(); offset > size {
+		offset = size
+	}
+	v.cursor = offset
+	v.lowNibble = false
+	n := v.bytesPerRow()
+	e.TriggerDocumentCursorMoved(v.document, offset%n, offset/n)
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+// overwrite replaces the byte at the cursor with c, or appends it if the
+// cursor is at the end.
+func (v *hexView) overwrite(c byte) {
+	d := v.document
+	if v.cursor < d.content.Len() {
+		d.delete(v.cursor, v.cursor+1)
+	}
+	d.insert(v.cursor, string([]byte{c}))
+}
+
+// onKeyPress overwrites the byte at the cursor. It is called by the editor in
+// Insert mode when the View is active and the key is not mapped to a command.
+func (v *hexView) onKeyPress(e wicore.Editor, k key.Press) {
+	if v.document.loading {
+		// TODO(maruel): Beep.
+		return
+	}
+	ch := k.Ch
+	if k.Key == key.Space {
+		ch = ' '
+	}
+	if v.ascii {
+		if ch < 0x20 || ch > 0x7E {
+			return
+		}
+		v.overwrite(byte(ch))
+		v.setCursor(e, v.cursor+1)
+		return
+	}
+	digit, err := strconv.ParseUint(string(ch), 16, 8)
+	if err != nil {
+		return
+	}
+	var old byte
+	if b := v.document.content.Range(v.cursor, v.cursor+1); len(b) != 0 {
+		old = b[0]
+	}
+	if v.lowNibble {
+		v.overwrite(old&0xF0 | byte(digit))
+		v.setCursor(e, v.cursor+1)
+		return
+	}
+	v.overwrite(byte(digit)<<4 | old&0x0F)
+	v.lowNibble = true
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+// search asynchronously searches for pattern after the cursor, wrapping around
+// the end of the document.
+func (v *hexView) search(e wicore.EditorW, pattern []byte) {
+	if len(pattern) == 0 {
+		return
+	}
+	v.lastSearch = pattern
+	content := v.document.snapshot()
+	from := v.cursor + 1
+	wicore.Go("hexSearch", func() {
+		i := indexBuffer(content, from, pattern)
+		if i == -1 {
+			i = indexBuffer(content, 0, pattern)
+		}
+		v.document.runInUI(e.(*editor), func() {
+			if i == -1 {
+				e.ExecuteCommand(nil, "alert", patternNotFound.Formatf(hex.EncodeToString(pattern)))
+				return
+			}
+			v.setCursor(e, i)
+		})
+	})
+}
+
+// indexBuffer returns the offset of the first occurrence of pattern in b at or
+// after start, or -1. It is run in a background goroutine.
+func indexBuffer(b text.Buffer, start int, pattern []byte) int {
+	found := -1
+	keep := len(pattern) - 1
+	// carry holds the end of the previous chunks, for an occurrence spanning
+	// multiple chunks.
+	var carry []byte
+	offset := start
+	b.Walk(start, b.Len(), func(chunk []byte) bool {
+		if len(carry) != 0 {
+			head := chunk
+			if len(head) > keep {
+				head = head[:keep]
+			}
+			if i := bytes.Index(append(carry, head...), pattern); i != -1 {
+				found = offset - len(carry) + i
+				return false
+			}
+		}
+		if i := bytes.Index(chunk, pattern); i != -1 {
+			found = offset + i
+			return false
+		}
+		offset += len(chunk)
+		if len(chunk) >= keep {
+			carry = append(carry[:0], chunk[len(chunk)-keep:]...)
+		} else if carry = append(carry, chunk...); len(carry) > keep {
+			carry = carry[len(carry)-keep:]
+		}
+		return true
+	})
+	return found
+}
+
+func cmdToHex(handler func(v *hexView, e wicore.EditorW, args ...string)) wicore.CommandImplHandler {
+	return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+		v, ok := w.View().(*hexView)
+		if !ok {
+			e.ExecuteCommand(w, "alert", "Internal error")
+			return
+		}
+		handler(v, e, args...)
+	}
+}
+
+func cmdHexCursorLeft(v *hexView, e wicore.EditorW, args ...string) {
+	v.setCursor(e, v.cursor-1)
+}
+
+func cmdHexCursorRight(v *hexView, e wicore.EditorW, args ...string) {
+	v.setCursor(e, v.cursor+1)
+}
+
+func cmdHexCursorUp(v *hexView, e wicore.EditorW, args ...string) {
+	if n := v.bytesPerRow(); v.cursor >= n {
+		v.setCursor(e, v.cursor-n)
+	}
+}
+
+func cmdHexCursorDown(v *hexView, e wicore.EditorW, args ...string) {
+	v.setCursor(e, v.cursor+v.bytesPerRow())
+}
+
+func cmdHexCursorHome(v *hexView, e wicore.EditorW, args ...string) {
+	v.setCursor(e, 0)
+}
+
+func cmdHexCursorEnd(v *hexView, e wicore.EditorW, args ...string) {
+	v.setCursor(e, v.document.content.Len())
+}
+
+func cmdHexUndo(v *hexView, e wicore.EditorW, args ...string) {
+	if v.document.large {
+		e.ExecuteCommand(nil, "alert", notInLargeFileMode.String())
+		return
+	}
+	offset, ok := v.document.undo()
+	if !ok {
+		e.ExecuteCommand(nil, "alert", oldestChange.String())
+		return
+	}
+	v.setCursor(e, offset)
+}
+
+func cmdHexRedo(v *hexView, e wicore.EditorW, args ...string) {
+	if v.document.large {
+		e.ExecuteCommand(nil, "alert", notInLargeFileMode.String())
+		return
+	}
+	offset, ok := v.document.redo()
+	if !ok {
+		e.ExecuteCommand(nil, "alert", newestChange.String())
+		return
+	}
+	v.setCursor(e, offset)
+}
+
+func cmdHexGoto(v *hexView, e wicore.EditorW, args ...string) {
+	// Accepts decimal, 0x prefixed hexadecimal and 0 prefixed octal.
+	offset, err := strconv.ParseInt(args[0], 0, 64)
+	if err != nil || offset < 0 || offset > int64(v.document.content.Len()) {
+		e.ExecuteCommand(nil, "alert", invalidOffset.Formatf(args[0]))
+		return
+	}
+	v.setCursor(e, int(offset))
+}
+
+func cmdHexSearch(v *hexView, e wicore.EditorW, args ...string) {
+	pattern, err := hex.DecodeString(strings.Join(args, ""))
+	if err != nil || len(pattern) == 0 {
+		e.ExecuteCommand(nil, "alert", invalidHexPattern.Formatf(strings.Join(args, " ")))
+		return
+	}
+	v.search(e, pattern)
+}
+
+func cmdHexSearchText(v *hexView, e wicore.EditorW, args ...string) {
+	v.search(e, []byte(strings.Join(args, " ")))
+}
+
+func cmdHexSearchNext(v *hexView, e wicore.EditorW, args ...string) {
+	if v.lastSearch == nil {
+		e.ExecuteCommand(nil, "alert", noPreviousSearch.String())
+		return
+	}
+	v.search(e, v.lastSearch)
+}
+
+func cmdHexToggleColumn(v *hexView, e wicore.EditorW, args ...string) {
+	v.ascii = !v.ascii
+	v.lowNibble = false
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+// hexViewFactory creates a hexView of a document. args can contain the ID of
+// an already loaded document; otherwise a new empty document is created.
+func hexViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	var doc *document
+	if len(args) != 0 {
+		for _, d := range e.AllDocuments() {
+			if d.ID() == args[0] {
+				doc, _ = d.(*document)
+				break
+			}
+		}
+	}
+	if doc == nil {
+		doc = e.(*editor).newDocument("")
+		doc.scanFileType(e.(*editor))
+	}
+	dispatcher := makeCommands()
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"document_cursor_left",
+			0,
+			cmdToHex(cmdHexCursorLeft),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Moves cursor to the previous byte",
+			},
+			lang.Map{
+				lang.En: "Moves cursor to the previous byte.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_cursor_right",
+			0,
+			cmdToHex(cmdHexCursorRight),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Moves cursor to the next byte",
+			},
+			lang.Map{
+				lang.En: "Moves cursor to the next byte.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_cursor_up",
+			0,
+			cmdToHex(cmdHexCursorUp),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Moves cursor up one row",
+			},
+			lang.Map{
+				lang.En: "Moves cursor up one row.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_cursor_down",
+			0,
+			cmdToHex(cmdHexCursorDown),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Moves cursor down one row",
+			},
+			lang.Map{
+				lang.En: "Moves cursor down one row.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_cursor_home",
+			0,
+			cmdToHex(cmdHexCursorHome),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Moves cursor to the first byte",
+			},
+			lang.Map{
+				lang.En: "Moves cursor to the first byte.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_cursor_end",
+			0,
+			cmdToHex(cmdHexCursorEnd),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Moves cursor past the last byte",
+			},
+			lang.Map{
+				lang.En: "Moves cursor past the last byte, where typing appends bytes.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_redo",
+			0,
+			cmdToHex(cmdHexRedo),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Redoes the last undone change",
+			},
+			lang.Map{
+				lang.En: "Redoes the last undone change.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_undo",
+			0,
+			cmdToHex(cmdHexUndo),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Undoes the last change",
+			},
+			lang.Map{
+				lang.En: "Undoes the last change. The history is shared with the text views of the document.",
+			},
+		},
+		&wicore.CommandImpl{
+			"hex_goto",
+			1,
+			cmdToHex(cmdHexGoto),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Moves cursor to an offset",
+			},
+			lang.Map{
+				lang.En: "Usage: hex_goto <offset>\nMoves cursor to a byte offset. The offset is decimal, or hexadecimal when prefixed with 0x.",
+			},
+		},
+		&wicore.CommandImpl{
+			"hex_search",
+			-1,
+			cmdToHex(cmdHexSearch),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Searches for bytes",
+			},
+			lang.Map{
+				lang.En: "Usage: hex_search <hex bytes>\nSearches for bytes written in hexadecimal, for example \"7f 45 4c 46\", after the cursor. The search wraps around the end of the document.",
+			},
+		},
+		&wicore.CommandImpl{
+			"hex_search_next",
+			0,
+			cmdToHex(cmdHexSearchNext),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Repeats the last search",
+			},
+			lang.Map{
+				lang.En: "Searches for the next occurrence of the pattern of the last hex_search or hex_search_text.",
+			},
+		},
+		&wicore.CommandImpl{
+			"hex_search_text",
+			-1,
+			cmdToHex(cmdHexSearchText),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Searches for ASCII text",
+			},
+			lang.Map{
+				lang.En: "Usage: hex_search_text <text>\nSearches for the bytes of a text after the cursor. The search wraps around the end of the document.",
+			},
+		},
+		&wicore.CommandImpl{
+			"hex_toggle_column",
+			0,
+			cmdToHex(cmdHexToggleColumn),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Switches between the hexadecimal and ASCII columns",
+			},
+			lang.Map{
+				lang.En: "Switches the cursor between the hexadecimal and the ASCII columns. In Insert mode, hex digits are typed in the hexadecimal column and characters in the ASCII column.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+
+	bindings := makeKeyBindings()
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Left}, "document_cursor_left")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Right}, "document_cursor_right")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Up}, "document_cursor_up")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "document_cursor_down")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Home}, "document_cursor_home")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.End}, "document_cursor_end")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Tab}, "hex_toggle_column")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'h'}, "document_cursor_left")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'l'}, "document_cursor_right")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'k'}, "document_cursor_up")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'j'}, "document_cursor_down")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'n'}, "hex_search_next")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'u'}, "document_undo")
+	bindings.Set(wicore.Normal, key.Press{Ctrl: true, Ch: 'r'}, "document_redo")
+
+	v := &hexView{
+		docView: docView{
+			view: view{
+				commands:      dispatcher,
+				keyBindings:   bindings,
+				id:            id,
+				title:         "<Empty document>",
+				naturalX:      100,
+				naturalY:      100,
+				defaultFormat: raster.CellFormat{Fg: colors.BrightYellow, Bg: colors.Black},
+			},
+			document: doc,
+		},
+	}
+	doc.views++
+	v.onAttach = func(_ *view, w wicore.Window) {
+		v.setCursor(e, v.cursor)
+	}
+	return v
+}
+
+// onFormatDetected is called in the UI goroutine once the file format of a
+// file being opened is known. Binary files are shown in a hex view.
+func (d *document) onFormatDetected(e *editor) {
+	if !d.autoHex {
+		return
+	}
+	d.autoHex = false
+	if d.format.encoding == binaryEncoding {
+		e.showDocumentAs(d, "hex")
+	}
+}
+
+// showDocumentAs replaces all the views of a document with views created by
+// viewFactoryName.
+func (e *editor) showDocumentAs(d *document, viewFactoryName string) {
+	walkWindows(e.rootWindow, func(w *window) {
+		if documentOf(w.view) == d && !isViewFrom(w.view, viewFactoryName) {
+			if v := e.newView(viewFactoryName, d.ID()); v != nil {
+				w.setView(v)
+			}
+		}
+	})
+}
+
+// isViewFrom returns true if v was created by viewFactoryName.
+func isViewFrom(v wicore.View, viewFactoryName string) bool {
+	switch v.(type) {
+	case *hexView:
+		return viewFactoryName == "hex"
+	case *documentView:
+		return viewFactoryName == "new_document"
+	}
+	return false
+}
+
+func cmdDocumentHex(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	doc := activeDocument(w)
+	if doc == nil {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	viewFactoryName := "hex"
+	if _, ok := w.view.(*hexView); ok {
+		viewFactoryName = "new_document"
+	}
+	if v := e.newView(viewFactoryName, doc.ID()); v != nil {
+		w.setView(v)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+func TestFormatHexRow(t *testing.T) {
+	ut.AssertEqual(t, "00000010  7f 45 4c 46  .ELF", formatHexRow(16, []byte("\x7fELF"), 4))
+	ut.AssertEqual(t, "00000000  41 00        A.", formatHexRow(0, []byte("A\x00"), 4))
+}
+
+func TestIndexBuffer(t *testing.T) {
+	// The content is split in leaves of 4096 bytes, so "abcdef" spans two
+	// leaves.
+	b := text.NewString(strings.Repeat("-", 4094) + "abcdef" + strings.Repeat("-", 5000) + "xyz")
+	data := []struct {
+		start    int
+		pattern  string
+		expected int
+	}{
+		{0, "-", 0},
+		{0, "abcdef", 4094},
+		{0, "-abcdef-", 4093},
+		{0, "f", 4099},
+		{4095, "abc", -1},
+		{4095, "bcd", 4095},
+		{0, "xyz", 9100},
+		{0, "xyz!", -1},
+	}
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, line.expected, indexBuffer(b, line.start, []byte(line.pattern)))
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// fileIdentity identifies a file independently of the path used to access
+// it, so a file opened through a symlink or a hardlink maps to the same
+// document.
+type fileIdentity struct {
+	path string // Canonical path: absolute with the symlinks resolved.
+	dev  uint64 // Device and inode, when supported by the OS and the file exists.
+	ino  uint64
+}
+
+// getFileIdentity returns the identity of filePath. The file doesn't need to
+// exist.
+func getFileIdentity(filePath string) fileIdentity {
+	id := fileIdentity{path: absPath(filePath)}
+	if p, err := filepath.EvalSymlinks(id.path); err == nil {
+		id.path = p
+	}
+	if fi, err := os.Stat(id.path); err == nil {
+		id.dev, id.ino = fileDevIno(fi)
+	}
+	return id
+}
+
+// same returns true if both identities refer to the same file. The same
+// canonical path is always the same file, even if it was atomically replaced
+// by another inode since.
+func (f fileIdentity) same(o fileIdentity) bool {
+	if f.path != "" && f.path == o.path {
+		return true
+	}
+	return f.ino != 0 && o.ino != 0 && f.dev == o.dev && f.ino == o.ino
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+)
+
+func TestFileIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.txt")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(a, []byte("a\n"), 0600))
+	b := filepath.Join(dir, "b.txt")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(b, []byte("b\n"), 0600))
+
+	id := getFileIdentity(a)
+	ut.AssertEqual(t, true, id.same(getFileIdentity(filepath.Join(dir, ".", "a.txt"))))
+	ut.AssertEqual(t, false, id.same(getFileIdentity(b)))
+	// Files not yet created are compared by path.
+	missing := filepath.Join(dir, "missing.txt")
+	ut.AssertEqual(t, true, getFileIdentity(missing).same(getFileIdentity(missing)))
+	ut.AssertEqual(t, false, id.same(getFileIdentity(missing)))
+	ut.AssertEqual(t, false, fileIdentity{}.same(fileIdentity{}))
+
+	// A file atomically replaced by another one is still the same file.
+	tmp := filepath.Join(dir, "a.tmp")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(tmp, []byte("c\n"), 0600))
+	ut.AssertEqual(t, nil, os.Rename(tmp, a))
+	ut.AssertEqual(t, true, id.same(getFileIdentity(a)))
+	id = getFileIdentity(a)
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	symlink := filepath.Join(dir, "symlink.txt")
+	ut.AssertEqual(t, nil, os.Symlink(a, symlink))
+	ut.AssertEqual(t, true, id.same(getFileIdentity(symlink)))
+	hardlink := filepath.Join(dir, "hardlink.txt")
+	ut.AssertEqual(t, nil, os.Link(a, hardlink))
+	ut.AssertEqual(t, true, id.same(getFileIdentity(hardlink)))
+}
+
+func TestDiskChangedIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "run")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(p, []byte("#!/bin/sh\necho\n"), 0600))
+
+	e, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	var doc *document
+	var before, after fileIdentity
+	e.RegisterDocumentFileTypeChanged(func(d wicore.Document, fileType wicore.FileType) {
+		if fileType != wicore.CodeShell {
+			return
+		}
+		// Atomically replaced by another program while the document is
+		// modified.
+		doc.insert(0, "# ")
+		before = doc.identity
+		tmp := filepath.Join(dir, "run.tmp")
+		ut.AssertEqual(t, nil, ioutil.WriteFile(tmp, []byte("#!/bin/sh\nexit\n"), 0600))
+		ut.AssertEqual(t, nil, os.Rename(tmp, p))
+		stat, err := statFile(p)
+		ut.AssertEqual(t, nil, err)
+		doc.onDiskChanged(e.(*editor), stat)
+		after = doc.identity
+		wicore.PostCommand(e, nil, "editor_quit", "force")
+	})
+	wicore.PostCommand(e, nil, "editor_bootstrap_ui")
+	wicore.PostCommand(e, func() {
+		doc = activeDocument(e.ActiveWindow())
+	}, "open", p)
+	ut.AssertEqual(t, 0, e.EventLoop())
+	ut.AssertEqual(t, getFileIdentity(p), after)
+	if runtime.GOOS != "windows" {
+		ut.AssertEqual(t, false, before == after)
+	}
+}
@@ -0,0 +1,17 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"os"
+)
+
+// fileDevIno returns 0, 0 since os.FileInfo doesn't expose the file index on
+// Windows. Files are then only compared by their canonical path.
+//
+// TODO(maruel): Use GetFileInformationByHandle.
+func fileDevIno(fi os.FileInfo) (uint64, uint64) {
+	return 0, 0
+}
@@ -0,0 +1,230 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Operator-pending input layer of the Normal and Visual modes. It parses the
+// vim grammar [count]["register]operator[count]motion on top of the key
+// bindings, where operator is an operatorCommand and motion a wicore.Motion.
+
+package editor
+
+import (
+	"strconv"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+// maxCount is the largest count that can be typed.
+const maxCount = 999999
+
+// keyArgCommand is a privileged command that keyParser runs with the next key
+// typed as argument, like mark_set with "ma". It implements
+// wicore.KeyArgCommand.
+type keyArgCommand struct {
+	privilegedCommandImpl
+	waitsForKey func(e *editor) bool // Returns false to run the command without argument; nil to always wait.
+}
+
+func (c *keyArgCommand) WaitsForKey(e wicore.Editor) bool {
+	return c.waitsForKey == nil || c.waitsForKey(e.(*editor))
+}
+
+// keyParser holds the keys typed so far in Normal and Visual modes.
+type keyParser struct {
+	keys         []key.Press // Keys of a sequence being typed, like "g" in "gg".
+	count        int         // Count typed before the operator, 0 if none.
+	readRegister bool        // '"' was typed, the next key is a register name.
+	register     rune        // Register typed after '"', 0 if none.
+	operator     string      // Operator waiting for a motion.
+	operatorKeys []key.Press // Keys of the operator; repeating the operator, like "dd", applies it to whole lines.
+	motionCount  int         // Count typed after the operator, 0 if none.
+	argCommand   string      // Command waiting for a key as argument, see wicore.KeyArgCommand.
+}
+
+func (p *keyParser) reset() {
+	*p = keyParser{}
+}
+
+// totalCount returns the count to use for the motion, 0 if none was typed.
+// Like in vim, "2d3w" deletes 6 words.
+func (p *keyParser) totalCount() int {
+	if p.count == 0 {
+		return p.motionCount
+	}
+	if p.motionCount == 0 {
+		return p.count
+	}
+	if n := p.count * p.motionCount; n < maxCount {
+		return n
+	}
+	return maxCount
+}
+
+// registerName returns the register to use, the unnamed register by default.
+func (p *keyParser) registerName() string {
+	if p.register == 0 {
+		return "\""
+	}
+	return string(p.register)
+}
+
+// onKey processes a key typed in Normal or Visual mode.
+func (p *keyParser) onKey(e *editor, k key.Press) {
+	if p.argCommand != "" {
+		cmdName, n := p.argCommand, p.count
+		p.reset()
+		if k.Ch == 0 || k.Ctrl || k.Alt {
+			// Escape, or any other key that is not a character, cancels the
+			// command.
+			return
+		}
+		defer e.sealEdits()
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			e.ExecuteCommand(e.ActiveWindow(), cmdName, string(k.Ch))
+		}
+		return
+	}
+	if p.readRegister {
+		p.readRegister = false
+		if !isRegisterName(k.Ch) || k.Ctrl || k.Alt {
+			e.ExecuteCommand(e.ActiveWindow(), "alert", invalidRegister.Formatf(k))
+			p.reset()
+			return
+		}
+		p.register = k.Ch
+		return
+	}
+	if len(p.keys) == 0 && !k.Ctrl && !k.Alt && k.Ch >= '0' && k.Ch <= '9' {
+		// "0" alone is a key, not a count.
+		count := &p.count
+		if p.operator != "" {
+			count = &p.motionCount
+		}
+		if k.Ch != '0' || *count != 0 {
+			if *count < maxCount/10 {
+				*count = *count*10 + int(k.Ch-'0')
+			}
+			return
+		}
+	}
+	if len(p.keys) == 0 && p.operator == "" && k.Ch == '"' && !k.Ctrl && !k.Alt {
+		p.readRegister = true
+		return
+	}
+	mode := e.KeyboardMode()
+	if p.operator != "" {
+		mode = wicore.OperatorPending
+	}
+	if k.Key == key.Escape && (len(p.keys) != 0 || p.count != 0 || p.register != 0 || p.operator != "") {
+		// Escape cancels the pending command.
+		p.reset()
+		return
+	}
+	p.keys = append(p.keys, k)
+	cmdName, more := wicore.GetKeyBindingSequence(e, mode, p.keys)
+	if more {
+		// Wait for the rest of the sequence.
+		// TODO(maruel): Timeout, like vim's timeoutlen.
+		return
+	}
+	keys := p.keys
+	p.keys = nil
+	if cmdName != "" {
+		p.dispatch(e, cmdName, keys)
+		return
+	}
+	if n := len(p.operatorKeys); n != 0 && (sequenceName(keys) == sequenceName(p.operatorKeys) || (n > 1 && len(keys) == 1 && k == p.operatorKeys[n-1])) {
+		// Repeating the operator applies it to whole lines, like "dd". Repeating
+		// only the last key of an operator sequence, like "gUU", is the same as
+		// "gUgU".
+		p.dispatch(e, p.operator, p.operatorKeys)
+		return
+	}
+	if len(keys) > 1 {
+		if prefix, _ := wicore.GetKeyBindingSequence(e, mode, keys[:len(keys)-1]); prefix != "" {
+			// A shorter binding was waiting for a longer sequence that was not
+			// typed. Run it and process the last key on its own.
+			p.dispatch(e, prefix, keys[:len(keys)-1])
+			p.onKey(e, k)
+			return
+		}
+	}
+	e.ExecuteCommand(e.ActiveWindow(), "alert", notMapped.Formatf(sequenceName(keys)))
+	p.reset()
+}
+
+// dispatch runs the command bound to the keys typed.
+func (p *keyParser) dispatch(e *editor, cmdName string, keys []key.Press) {
+	w := e.ActiveWindow()
+	defer e.sealEdits()
+	cmd := wicore.GetCommand(e, w, cmdName)
+	if _, ok := cmd.(*operatorCommand); ok {
+		if p.operator == "" && !isVisualMode(e.KeyboardMode()) {
+			// Wait for the motion.
+			p.operator = cmdName
+			p.operatorKeys = keys
+			return
+		}
+		if p.operator != "" && p.operator != cmdName {
+			e.ExecuteCommand(w, "alert", notAMotion.Formatf(cmdName))
+			p.reset()
+			return
+		}
+		// In Visual mode, the operator applies to the selection. Repeating the
+		// operator, like "3dd", applies it to count lines.
+		args := []string{p.registerName()}
+		if n := p.totalCount(); p.operator != "" && n > 1 {
+			args = append(args, "document_cursor_down", strconv.Itoa(n-1))
+		}
+		p.reset()
+		e.ExecuteCommand(w, cmdName, args...)
+		return
+	}
+	if _, ok := cmd.(wicore.Motion); ok {
+		var args []string
+		if n := p.totalCount(); n != 0 {
+			args = []string{strconv.Itoa(n)}
+		}
+		operator, register := p.operator, p.registerName()
+		p.reset()
+		if operator != "" {
+			e.ExecuteCommand(w, operator, append([]string{register, cmdName}, args...)...)
+		} else {
+			e.ExecuteCommand(w, cmdName, args...)
+		}
+		return
+	}
+	if p.operator != "" {
+		e.ExecuteCommand(w, "alert", notAMotion.Formatf(cmdName))
+		p.reset()
+		return
+	}
+	if c, ok := cmd.(wicore.KeyArgCommand); ok && c.WaitsForKey(e) {
+		// Wait for the key.
+		p.argCommand = cmdName
+		return
+	}
+	// Other commands are run count times. The register, if typed, is their
+	// argument, like for register_put.
+	var args []string
+	if p.register != 0 {
+		args = []string{string(p.register)}
+	}
+	n := p.count
+	if n == 0 {
+		n = 1
+	}
+	p.reset()
+	for i := 0; i < n; i++ {
+		e.ExecuteCommand(w, cmdName, args...)
+	}
+}
+
+// isVisualMode returns true for the Visual, VisualLine and VisualBlock modes.
+func isVisualMode(mode wicore.KeyboardMode) bool {
+	return mode == wicore.Visual || mode == wicore.VisualLine || mode == wicore.VisualBlock
+}
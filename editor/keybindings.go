@@ -5,14 +5,60 @@
 package editor
 
 import (
+	"strings"
+
 	"github.com/wi-ed/wi/wicore"
 	"github.com/wi-ed/wi/wicore/key"
 	"github.com/wi-ed/wi/wicore/lang"
 )
 
 type keyBindings struct {
-	normalMappings map[key.Press]string
-	insertMappings map[key.Press]string
+	normalMappings      *keyMappings
+	insertMappings      *keyMappings
+	visualMappings      *keyMappings
+	visualLineMappings  *keyMappings
+	visualBlockMappings *keyMappings
+	operatorMappings    *keyMappings
+}
+
+// keyMappings is the table of a keyboard mode.
+type keyMappings struct {
+	keys      map[key.Press]string // Single keys.
+	sequences map[string]string    // Sequences of two keys or more, see sequenceName().
+}
+
+func makeKeyMappings() *keyMappings {
+	return &keyMappings{make(map[key.Press]string), make(map[string]string)}
+}
+
+// sequenceName returns the key used in keyMappings.sequences, like "g g".
+func sequenceName(keys []key.Press) string {
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = k.String()
+	}
+	return strings.Join(out, " ")
+}
+
+// mappings returns the tables used for a mode. AllMode uses all of them.
+func (k *keyBindings) mappings(mode wicore.KeyboardMode) []*keyMappings {
+	switch mode {
+	case wicore.Normal:
+		return []*keyMappings{k.normalMappings}
+	case wicore.Insert:
+		return []*keyMappings{k.insertMappings}
+	case wicore.Visual:
+		return []*keyMappings{k.visualMappings}
+	case wicore.VisualLine:
+		return []*keyMappings{k.visualLineMappings}
+	case wicore.VisualBlock:
+		return []*keyMappings{k.visualBlockMappings}
+	case wicore.OperatorPending:
+		return []*keyMappings{k.operatorMappings}
+	case wicore.AllMode:
+		return []*keyMappings{k.normalMappings, k.insertMappings, k.visualMappings, k.visualLineMappings, k.visualBlockMappings, k.operatorMappings}
+	}
+	return nil
 }
 
 func (k *keyBindings) Set(mode wicore.KeyboardMode, key key.Press, cmdName string) bool {
@@ -20,13 +66,30 @@ func (k *keyBindings) Set(mode wicore.KeyboardMode, key key.Press, cmdName strin
 		return false
 	}
 	var ok bool
-	if mode == wicore.AllMode || mode == wicore.Normal {
-		_, ok = k.normalMappings[key]
-		k.normalMappings[key] = cmdName
+	for _, m := range k.mappings(mode) {
+		_, ok = m.keys[key]
+		m.keys[key] = cmdName
+	}
+	return !ok
+}
+
+func (k *keyBindings) SetSequence(mode wicore.KeyboardMode, keys []key.Press, cmdName string) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	if len(keys) == 1 {
+		return k.Set(mode, keys[0], cmdName)
+	}
+	for _, p := range keys {
+		if !p.IsValid() {
+			return false
+		}
 	}
-	if mode == wicore.AllMode || mode == wicore.Insert {
-		_, ok = k.insertMappings[key]
-		k.insertMappings[key] = cmdName
+	name := sequenceName(keys)
+	var ok bool
+	for _, m := range k.mappings(mode) {
+		_, ok = m.sequences[name]
+		m.sequences[name] = cmdName
 	}
 	return !ok
 }
@@ -35,28 +98,42 @@ func (k *keyBindings) Get(mode wicore.KeyboardMode, key key.Press) string {
 	if !key.IsValid() {
 		return ""
 	}
-	if mode == wicore.Normal || mode == wicore.AllMode {
-		if v, ok := k.normalMappings[key]; ok {
+	for _, m := range k.mappings(mode) {
+		if v, ok := m.keys[key]; ok {
 			return v
 		}
 	}
-	if mode == wicore.Insert || mode == wicore.AllMode {
-		if v, ok := k.insertMappings[key]; ok {
-			return v
+	return ""
+}
+
+func (k *keyBindings) GetSequence(mode wicore.KeyboardMode, keys []key.Press) (string, bool) {
+	if len(keys) == 0 {
+		return "", false
+	}
+	cmdName := ""
+	if len(keys) == 1 {
+		cmdName = k.Get(mode, keys[0])
+	}
+	name := sequenceName(keys)
+	prefix := name + " "
+	more := false
+	for _, m := range k.mappings(mode) {
+		if v, ok := m.sequences[name]; ok && cmdName == "" {
+			cmdName = v
+		}
+		for s, v := range m.sequences {
+			if v != "" && strings.HasPrefix(s, prefix) {
+				more = true
+			}
 		}
 	}
-	return ""
+	return cmdName, more
 }
 
 func (k *keyBindings) GetAssigned(mode wicore.KeyboardMode) []key.Press {
 	out := []key.Press{}
-	if mode == wicore.Normal || mode == wicore.AllMode {
-		for k := range k.normalMappings {
-			out = append(out, k)
-		}
-	}
-	if mode == wicore.Insert || mode == wicore.AllMode {
-		for k := range k.insertMappings {
+	for _, m := range k.mappings(mode) {
+		for k := range m.keys {
 			out = append(out, k)
 		}
 	}
@@ -64,7 +141,14 @@ func (k *keyBindings) GetAssigned(mode wicore.KeyboardMode) []key.Press {
 }
 
 func makeKeyBindings() wicore.KeyBindingsW {
-	return &keyBindings{make(map[key.Press]string), make(map[key.Press]string)}
+	return &keyBindings{
+		makeKeyMappings(),
+		makeKeyMappings(),
+		makeKeyMappings(),
+		makeKeyMappings(),
+		makeKeyMappings(),
+		makeKeyMappings(),
+	}
 }
 
 // Commands.
@@ -88,6 +172,14 @@ func cmdKeyBind(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args .
 		mode = wicore.Normal
 	} else if modeName == "edit" {
 		mode = wicore.Normal
+	} else if modeName == "visual" {
+		mode = wicore.Visual
+	} else if modeName == "visual_line" {
+		mode = wicore.VisualLine
+	} else if modeName == "visual_block" {
+		mode = wicore.VisualBlock
+	} else if modeName == "operator_pending" {
+		mode = wicore.OperatorPending
 	} else if modeName == "all" {
 		mode = wicore.AllMode
 	} else {
@@ -106,6 +198,26 @@ func cmdKeyBind(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args .
 	viewW.KeyBindingsW().Set(mode, k, cmdName)
 }
 
+func cmdKeySetInsert(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	e.setKeyboardMode(wicore.Insert)
+}
+
+func cmdKeySetNormal(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	e.setKeyboardMode(wicore.Normal)
+}
+
+func cmdKeySetVisual(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	e.setKeyboardMode(wicore.Visual)
+}
+
+func cmdKeySetVisualBlock(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	e.setKeyboardMode(wicore.VisualBlock)
+}
+
+func cmdKeySetVisualLine(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	e.setKeyboardMode(wicore.VisualLine)
+}
+
 // RegisterKeyBindingCommands registers the keyboard mapping related commands.
 func RegisterKeyBindingCommands(dispatcher wicore.CommandsW) {
 	cmds := []wicore.Command{
@@ -118,7 +230,67 @@ func RegisterKeyBindingCommands(dispatcher wicore.CommandsW) {
 				lang.En: "Binds a keyboard mapping to a command",
 			},
 			lang.Map{
-				lang.En: "Usage: key_bind [window|global] [command|edit|all] <key> <command>\nBinds a keyboard mapping to a command. The binding can be to the active view for view-specific key binding or to the root view for global key bindings.",
+				lang.En: "Usage: key_bind [window|global] [command|edit|visual|visual_line|visual_block|operator_pending|all] <key> <command>\nBinds a keyboard mapping to a command. The binding can be to the active view for view-specific key binding or to the root view for global key bindings.",
+			},
+		},
+		&privilegedCommandImpl{
+			"key_set_insert",
+			0,
+			cmdKeySetInsert,
+			wicore.CommandsCategory,
+			lang.Map{
+				lang.En: "Switches to Insert mode",
+			},
+			lang.Map{
+				lang.En: "Switches the keyboard to Insert mode, where typing inserts text in the document. All the text typed until going back to Normal mode is undone at once.",
+			},
+		},
+		&privilegedCommandImpl{
+			"key_set_normal",
+			0,
+			cmdKeySetNormal,
+			wicore.CommandsCategory,
+			lang.Map{
+				lang.En: "Switches to Normal mode",
+			},
+			lang.Map{
+				lang.En: "Switches the keyboard to Normal mode, where keys are mapped to commands.",
+			},
+		},
+		&privilegedCommandImpl{
+			"key_set_visual",
+			0,
+			cmdKeySetVisual,
+			wicore.CommandsCategory,
+			lang.Map{
+				lang.En: "Switches to Visual mode",
+			},
+			lang.Map{
+				lang.En: "Switches the keyboard to Visual mode, where the motions extend a character selection started at the cursor. Leaving the Visual modes removes the selection.",
+			},
+		},
+		&privilegedCommandImpl{
+			"key_set_visual_block",
+			0,
+			cmdKeySetVisualBlock,
+			wicore.CommandsCategory,
+			lang.Map{
+				lang.En: "Switches to Visual Block mode",
+			},
+			lang.Map{
+				lang.En: "Switches the keyboard to Visual Block mode, where the motions extend a block selection started at the cursor. Leaving the Visual modes removes the selection.",
+			},
+		},
+		&privilegedCommandImpl{
+			"key_set_visual_line",
+			0,
+			cmdKeySetVisualLine,
+			wicore.CommandsCategory,
+			lang.Map{
+				lang.En: "Switches to Visual Line mode",
+			},
+			lang.Map{
+				lang.En: "Switches the keyboard to Visual Line mode, where the motions extend a line selection started at the cursor. Leaving the Visual modes removes the selection.",
 			},
 		},
 	}
@@ -0,0 +1,47 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestKeyBindingsModes(t *testing.T) {
+	b := makeKeyBindings()
+	v := key.Press{Ch: 'v'}
+	ut.AssertEqual(t, true, b.Set(wicore.AllMode, v, "all"))
+	ut.AssertEqual(t, false, b.Set(wicore.VisualLine, v, "line"))
+	ut.AssertEqual(t, "all", b.Get(wicore.Normal, v))
+	ut.AssertEqual(t, "all", b.Get(wicore.Visual, v))
+	ut.AssertEqual(t, "line", b.Get(wicore.VisualLine, v))
+	ut.AssertEqual(t, 1, len(b.GetAssigned(wicore.VisualBlock)))
+	ut.AssertEqual(t, 6, len(b.GetAssigned(wicore.AllMode)))
+	ut.AssertEqual(t, "VisualBlock", wicore.VisualBlock.String())
+}
+
+func TestKeyBindingsSequences(t *testing.T) {
+	b := makeKeyBindings()
+	g := key.Press{Ch: 'g'}
+	ut.AssertEqual(t, true, b.SetSequence(wicore.Normal, []key.Press{g, g}, "top"))
+	ut.AssertEqual(t, true, b.SetSequence(wicore.Normal, []key.Press{g}, "single"))
+	ut.AssertEqual(t, false, b.SetSequence(wicore.Normal, nil, "none"))
+	name, more := b.GetSequence(wicore.Normal, []key.Press{g})
+	ut.AssertEqual(t, "single", name)
+	ut.AssertEqual(t, true, more)
+	name, more = b.GetSequence(wicore.Normal, []key.Press{g, g})
+	ut.AssertEqual(t, "top", name)
+	ut.AssertEqual(t, false, more)
+	name, more = b.GetSequence(wicore.Visual, []key.Press{g, g})
+	ut.AssertEqual(t, "", name)
+	ut.AssertEqual(t, false, more)
+	// Unbinding the sequence.
+	b.SetSequence(wicore.Normal, []key.Press{g, g}, "")
+	_, more = b.GetSequence(wicore.Normal, []key.Press{g})
+	ut.AssertEqual(t, false, more)
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// lineEnding is the line terminator style of a file.
+//
+// The content of a document only contains "\n" when the file consistently
+// uses one style. A file with mixed line endings is kept verbatim so it is
+// written back unchanged; the "\r" are then hidden from the user.
+type lineEnding int
+
+const (
+	lfEnding lineEnding = iota
+	crlfEnding
+	mixedEnding
+)
+
+var lineEndingNames = []string{"LF", "CRLF", "Mixed"}
+
+func (l lineEnding) String() string {
+	if l < 0 || int(l) >= len(lineEndingNames) {
+		return fmt.Sprintf("lineEnding(%d)", int(l))
+	}
+	return lineEndingNames[l]
+}
+
+// stringToLineEnding returns the line ending named s. mixedEnding is not a
+// valid target.
+func stringToLineEnding(s string) (lineEnding, bool) {
+	switch strings.ToLower(s) {
+	case "lf", "unix":
+		return lfEnding, true
+	case "crlf", "dos":
+		return crlfEnding, true
+	default:
+		return lfEnding, false
+	}
+}
+
+// nameToLineEnding is the reverse of lineEnding.String(). Unlike
+// stringToLineEnding, it accepts mixedEnding.
+func nameToLineEnding(s string) (lineEnding, bool) {
+	for i, n := range lineEndingNames {
+		if n == s {
+			return lineEnding(i), true
+		}
+	}
+	return lfEnding, false
+}
+
+// lineEndingCounter counts the line terminators of a file as it is loaded.
+type lineEndingCounter struct {
+	lf   int
+	crlf int
+	cr   bool // true if the previous chunk ended with "\r".
+}
+
+func (l *lineEndingCounter) count(b []byte) {
+	for _, c := range b {
+		if c == '\n' {
+			if l.cr {
+				l.crlf++
+			} else {
+				l.lf++
+			}
+		}
+		l.cr = c == '\r'
+	}
+}
+
+func (l *lineEndingCounter) lineEnding() lineEnding {
+	if l.crlf == 0 {
+		return lfEnding
+	}
+	if l.lf == 0 {
+		return crlfEnding
+	}
+	return mixedEnding
+}
+
+// stripCR returns b with all the "\r\n" replaced with "\n".
+func stripCR(b text.Buffer) text.Buffer {
+	out := make([]byte, 0, b.Len())
+	b.Walk(0, b.Len(), func(chunk []byte) bool {
+		for _, c := range chunk {
+			if c == '\n' && len(out) != 0 && out[len(out)-1] == '\r' {
+				out[len(out)-1] = '\n'
+				continue
+			}
+			out = append(out, c)
+		}
+		return true
+	})
+	return text.New(out)
+}
@@ -0,0 +1,87 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+func TestLineEndingCounter(t *testing.T) {
+	data := []struct {
+		chunks   []string
+		expected lineEnding
+	}{
+		{[]string{"no newline"}, lfEnding},
+		{[]string{"a\nb\n"}, lfEnding},
+		{[]string{"a\r\nb\r", "\n"}, crlfEnding},
+		{[]string{"a\r\nb\n"}, mixedEnding},
+	}
+	for i, line := range data {
+		c := lineEndingCounter{}
+		for _, chunk := range line.chunks {
+			c.count([]byte(chunk))
+		}
+		ut.AssertEqualIndex(t, i, line.expected, c.lineEnding())
+	}
+}
+
+func TestLineEndingRoundTrip(t *testing.T) {
+	content := stripCR(text.NewString("a\r\nb\r\n"))
+	ut.AssertEqual(t, "a\nb\n", content.String())
+	b := &bytes.Buffer{}
+	_, err := encodedContent{content, fileFormat{utf8Encoding, crlfEnding}}.WriteTo(b)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "a\r\nb\r\n", b.String())
+
+	// A "\r" at the end of a line is kept.
+	content = stripCR(text.NewString("a\r\r\n"))
+	ut.AssertEqual(t, "a\r\n", content.String())
+	for _, enc := range []encoding{utf8Encoding, utf16LEEncoding} {
+		b.Reset()
+		_, err = encodedContent{content, fileFormat{enc, crlfEnding}}.WriteTo(b)
+		ut.AssertEqual(t, nil, err)
+		decoded := newDecoder(enc).decode(b.Bytes(), true)
+		ut.AssertEqual(t, "a\r\r\n", string(decoded))
+	}
+
+	// Mixed line endings are written unchanged.
+	b.Reset()
+	_, err = encodedContent{text.NewString("a\r\nb\n"), fileFormat{utf8Encoding, mixedEnding}}.WriteTo(b)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "a\r\nb\n", b.String())
+}
+
+func TestLineTrailingCR(t *testing.T) {
+	d := makeDocument(0)
+	d.reset(text.NewString("a\r\nb\n"))
+	// With "\n" terminators, the "\r" is part of the line.
+	ut.AssertEqual(t, "a\r", d.line(0))
+	ut.AssertEqual(t, 2, d.lineLength(0))
+	d.format.lineEnding = mixedEnding
+	ut.AssertEqual(t, "a", d.line(0))
+	ut.AssertEqual(t, "b", d.line(1))
+}
+
+func TestSetLineEndingUndo(t *testing.T) {
+	d := makeDocument(0)
+	d.reset(text.NewString("a\r\nb\n"))
+	d.format.lineEnding = mixedEnding
+	d.insert(5, "c\r\n")
+	a := d.addAnchor(d.content.Len())
+	d.setLineEnding(crlfEnding)
+	ut.AssertEqual(t, "a\nb\nc\n", d.content.String())
+	ut.AssertEqual(t, d.content.Len(), a.offset)
+	// The conversion is undone on its own, before the insertion.
+	_, ok := d.undo()
+	ut.AssertEqual(t, true, ok)
+	ut.AssertEqual(t, "a\r\nb\nc\r\n", d.content.String())
+	_, ok = d.undo()
+	ut.AssertEqual(t, true, ok)
+	ut.AssertEqual(t, "a\r\nb\n", d.content.String())
+}
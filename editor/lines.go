@@ -0,0 +1,245 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Commands working on the lines of a range, like ":sort". See ex.go for the
+// ranges.
+
+package editor
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// lineCommand runs f on the lines of the range in args[0] with the options in
+// the other arguments. An empty range is defaultRange.
+func lineCommand(e *editor, w *window, args []string, defaultRange string, f func(v *documentView, r lineRange, options string)) {
+	v, ok := w.View().(*documentView)
+	if !ok {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	if v.document.loading {
+		e.ExecuteCommand(w, "alert", stillLoading.String())
+		return
+	}
+	rng := defaultRange
+	if len(args) != 0 && args[0] != "" {
+		rng = args[0]
+	}
+	r, err := v.parseRange(rng)
+	if err != nil {
+		e.ExecuteCommand(w, "alert", invalidRange.Formatf(rng, err))
+		return
+	}
+	options := ""
+	if len(args) > 1 {
+		options = strings.Join(args[1:], "")
+	}
+	v.cursors = nil
+	f(v, r, options)
+	v.clampCursor()
+	v.cursorMoved(e)
+	// TODO(maruel): Implement dirty instead.
+	e.TriggerTerminalResized()
+}
+
+// rangeLines returns the lines of a range, without terminator.
+func rangeLines(d *document, r lineRange) []string {
+	lines := make([]string, 0, r.end-r.start+1)
+	for l := r.start; l <= r.end; l++ {
+		lines = append(lines, d.line(l))
+	}
+	return lines
+}
+
+// replaceLines replaces the lines of a range.
+func replaceLines(d *document, r lineRange, lines []string) {
+	start := d.content.LineStart(r.start)
+	end := d.content.LineEnd(r.end)
+	s := strings.Join(lines, "\n")
+	if string(d.content.Range(start, end)) == s {
+		return
+	}
+	d.delete(start, end)
+	d.insert(start, s)
+}
+
+// lineSorter sorts lines for document_sort.
+type lineSorter struct {
+	lines   []string
+	keys    []string // Compared instead of the lines, when not nil.
+	numbers []int    // Compared instead of the lines in numeric mode, when not nil.
+	hasNum  []bool   // The line has a number, in numeric mode.
+	reverse bool
+}
+
+func (s *lineSorter) Len() int { return len(s.lines) }
+
+func (s *lineSorter) Less(i, j int) bool {
+	if s.reverse {
+		i, j = j, i
+	}
+	if s.numbers != nil {
+		// The lines without number come first.
+		if s.hasNum[i] != s.hasNum[j] {
+			return !s.hasNum[i]
+		}
+		return s.numbers[i] < s.numbers[j]
+	}
+	if s.keys != nil {
+		return s.keys[i] < s.keys[j]
+	}
+	return s.lines[i] < s.lines[j]
+}
+
+func (s *lineSorter) Swap(i, j int) {
+	s.lines[i], s.lines[j] = s.lines[j], s.lines[i]
+	if s.keys != nil {
+		s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	}
+	if s.numbers != nil {
+		s.numbers[i], s.numbers[j] = s.numbers[j], s.numbers[i]
+		s.hasNum[i], s.hasNum[j] = s.hasNum[j], s.hasNum[i]
+	}
+}
+
+// firstNumber returns the first decimal number of a line, with its sign.
+func firstNumber(line string) (int, bool) {
+	for i := 0; i < len(line); i++ {
+		if line[i] >= '0' && line[i] <= '9' {
+			n, _ := leadingNumber(line[i:])
+			if i > 0 && line[i-1] == '-' {
+				n = -n
+			}
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// uniqueLines removes the consecutive duplicate lines.
+func uniqueLines(lines []string, ignoreCase bool) []string {
+	out := lines[:0]
+	for i, l := range lines {
+		if i != 0 {
+			prev := out[len(out)-1]
+			if l == prev || (ignoreCase && strings.EqualFold(l, prev)) {
+				continue
+			}
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+func cmdDocumentSort(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	lineCommand(e, w, args, "%", func(v *documentView, r lineRange, options string) {
+		s := &lineSorter{lines: rangeLines(v.document, r)}
+		ignoreCase, unique := false, false
+		for _, o := range options {
+			switch o {
+			case '!':
+				s.reverse = true
+			case 'i':
+				ignoreCase = true
+			case 'n':
+				s.numbers = make([]int, len(s.lines))
+				s.hasNum = make([]bool, len(s.lines))
+				for i, l := range s.lines {
+					s.numbers[i], s.hasNum[i] = firstNumber(l)
+				}
+			case 'u':
+				unique = true
+			default:
+				e.ExecuteCommand(w, "alert", invalidOption.Formatf(string(o)))
+				return
+			}
+		}
+		if ignoreCase && s.numbers == nil {
+			s.keys = make([]string, len(s.lines))
+			for i, l := range s.lines {
+				s.keys[i] = strings.ToLower(l)
+			}
+		}
+		sort.Stable(s)
+		lines := s.lines
+		if unique {
+			lines = uniqueLines(lines, ignoreCase)
+		}
+		replaceLines(v.document, r, lines)
+		v.setPrimary(cursor{r.start, 0, 0})
+	})
+}
+
+func cmdDocumentUniq(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	lineCommand(e, w, args, "%", func(v *documentView, r lineRange, options string) {
+		ignoreCase := false
+		for _, o := range options {
+			if o != 'i' {
+				e.ExecuteCommand(w, "alert", invalidOption.Formatf(string(o)))
+				return
+			}
+			ignoreCase = true
+		}
+		replaceLines(v.document, r, uniqueLines(rangeLines(v.document, r), ignoreCase))
+		v.setPrimary(cursor{r.start, 0, 0})
+	})
+}
+
+func cmdDocumentJoin(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	lineCommand(e, w, args, ".", func(v *documentView, r lineRange, options string) {
+		keep := false
+		for _, o := range options {
+			if o != '!' {
+				e.ExecuteCommand(w, "alert", invalidOption.Formatf(string(o)))
+				return
+			}
+			keep = true
+		}
+		if r.start == r.end {
+			// A single line is joined with the next one.
+			if r.end++; r.end == v.document.lineCount() {
+				return
+			}
+		}
+		lines := rangeLines(v.document, r)
+		joined := lines[0]
+		col := 0
+		for _, l := range lines[1:] {
+			if keep {
+				col = utf8.RuneCountInString(joined)
+				joined += l
+				continue
+			}
+			// Like in vim, the leading whitespace is replaced with a space, except
+			// before ')' and when a line ends with whitespace.
+			l = strings.TrimLeft(l, " \t")
+			col = utf8.RuneCountInString(joined)
+			if l != "" && l[0] != ')' && joined != "" && !strings.HasSuffix(joined, " ") && !strings.HasSuffix(joined, "\t") {
+				joined += " "
+			}
+			joined += l
+		}
+		replaceLines(v.document, r, []string{joined})
+		v.setPrimary(cursor{r.start, col, col})
+	})
+}
+
+func cmdDocumentDeleteLines(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	lineCommand(e, w, args, ".", func(v *documentView, r lineRange, options string) {
+		if options == "" {
+			options = "\""
+		}
+		// Deleting lines is the same as "dd".
+		v.setPrimary(cursor{r.start, 0, 0})
+		deleteArgs := []string{options}
+		if r.end > r.start {
+			deleteArgs = append(deleteArgs, "document_cursor_down", strconv.Itoa(r.end-r.start))
+		}
+		e.ExecuteCommand(w, "operator_delete", deleteArgs...)
+	})
+}
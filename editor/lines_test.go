@@ -0,0 +1,42 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestLineCommands(t *testing.T) {
+	data := []struct {
+		content  string
+		keys     string
+		expected string
+		line     int
+		column   int
+	}{
+		{"c\nB\na\n", ":sort\n", "B\na\nc\n", 0, 0},
+		{"c\nB\na\n", ":sort i\n", "a\nB\nc\n", 0, 0},
+		{"c\nB\na\n", ":sort!\n", "c\na\nB\n", 0, 0},
+		{"x10\nx9\ny\nx-1\n", ":sort n\n", "y\nx-1\nx9\nx10\n", 0, 0},
+		{"b\na\nb\na\n", ":sort u\n", "a\nb\n", 0, 0},
+		{"d\nc\nb\na\n", "j:.,+1sort\n", "d\nb\nc\na\n", 1, 0},
+		{"a\na\nb\na\n", ":uniq\n", "a\nb\na\n", 0, 0},
+		{"a\nA\n", ":uniq i\n", "a\n", 0, 0},
+		{"a\n  b\n\tc\n", ":j\n", "a b\n\tc\n", 0, 1},
+		{"a\n  b\n\tc\n", ":%j\n", "a b c\n", 0, 3},
+		{"a\n  b\n", ":j!\n", "a  b\n", 0, 1},
+		{"f(\n)\n", ":j\n", "f()\n", 0, 2},
+		{"a\nb\nc\n", ":2,$d\n", "a\n", 1, 0},
+		{"a\nb\nc\n", ":d a\n\"ap", "b\na\nc\n", 1, 0},
+		{"a\nb\n", ":sort x\n", "a\nb\n", 0, 0},
+	}
+	for i, line := range data {
+		_, v := typeKeys(t, line.content, line.keys)
+		ut.AssertEqualIndex(t, i, line.expected, v.document.content.String())
+		ut.AssertEqualIndex(t, i, cursor{line.line, line.column, line.column}, v.primary())
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Keyboard macros. The keys are recorded as they are pressed, before any
+// processing, and stored as text in a register so a macro can be edited and
+// set with register_set. On playback, the keys are triggered again one at a
+// time so they go through the same processing as when they were typed.
+
+package editor
+
+import (
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+)
+
+// maxMacroKeys is the maximum number of keys waiting to be played, to stop a
+// runaway recursive macro.
+const maxMacroKeys = 1000000
+
+// macroState is the state of the macro recording and playback.
+type macroState struct {
+	recording rune        // Register being recorded, 0 if not recording.
+	keys      []key.Press // Keys recorded so far.
+	last      rune        // Last register played, for "@@".
+	pending   []key.Press // Keys left to play.
+	playing   key.Press   // Key triggered by the playback, not yet processed.
+	active    bool        // true while playNextKey is scheduled.
+}
+
+// parseKeys converts text to key presses. A key name between angle brackets,
+// like <Escape> or <Ctrl-v>, is a single key and <lt> is "<". A space, a tab
+// and a line feed are the Space, Tab and Enter keys.
+func parseKeys(keys string) []key.Press {
+	var out []key.Press
+	rs := []rune(keys)
+	for i := 0; i < len(rs); i++ {
+		k := key.Press{Ch: rs[i]}
+		if rs[i] == '<' {
+			for j := i + 1; j < len(rs); j++ {
+				if rs[j] == '>' {
+					if name := string(rs[i+1 : j]); name == "lt" {
+						i = j
+					} else if p := key.StringToPress(name); j > i+2 && p.IsValid() {
+						k = p
+						i = j
+					}
+					break
+				}
+			}
+		}
+		switch k.Ch {
+		case ' ':
+			k = key.Press{Key: key.Space}
+		case '\t':
+			k = key.Press{Key: key.Tab}
+		case '\n':
+			k = key.Press{Key: key.Enter}
+		}
+		out = append(out, k)
+	}
+	return out
+}
+
+// formatKeys converts key presses to text, the reverse of parseKeys.
+func formatKeys(keys []key.Press) string {
+	out := ""
+	for _, k := range keys {
+		switch {
+		case k == key.Press{Ch: '<'}:
+			out += "<lt>"
+		case k == key.Press{Key: key.Space}:
+			out += " "
+		case k.Key == key.None && !k.Ctrl && !k.Alt:
+			out += string(k.Ch)
+		default:
+			out += "<" + k.String() + ">"
+		}
+	}
+	return out
+}
+
+// onMacroKey is called for each key pressed, before it is processed. It
+// records the key. A key typed during a playback stops it.
+func (e *editor) onMacroKey(k key.Press) {
+	if e.macro.playing.IsValid() && e.macro.playing == k {
+		// Played, not typed. Like in vim, recording "@a" records only these two
+		// keys.
+		e.macro.playing = key.Press{}
+		return
+	}
+	if e.macro.playing.IsValid() || len(e.macro.pending) != 0 {
+		e.stopMacro()
+	}
+	if e.macro.recording != 0 {
+		e.macro.keys = append(e.macro.keys, k)
+	}
+}
+
+// playNextKey triggers the next key of the playback, then schedules itself
+// after the processing of the key.
+func (e *editor) playNextKey() {
+	if len(e.macro.pending) == 0 {
+		e.macro.active = false
+		return
+	}
+	if e.search.cancel != nil {
+		// Wait for the search started by the previous key, so the next keys
+		// apply at the match.
+		e.deferred <- e.playNextKey
+		return
+	}
+	k := e.macro.pending[0]
+	e.macro.pending = e.macro.pending[1:]
+	e.macro.playing = k
+	if k.IsMeta() {
+		e.TriggerTerminalMetaKeyPressed(k)
+	} else {
+		e.TriggerTerminalKeyPressed(k)
+	}
+	e.deferred <- e.playNextKey
+}
+
+// stopMacro stops the playback. The keys already triggered are still
+// processed.
+func (e *editor) stopMacro() {
+	e.macro.pending = nil
+	e.macro.playing = key.Press{}
+}
+
+func cmdMacroPlay(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	name, ok := registerArg(args)
+	if !ok && args[0] != "@" {
+		e.ExecuteCommand(w, "alert", invalidRegister.Formatf(args[0]))
+		return
+	}
+	if args[0] == "@" {
+		if name = e.macro.last; name == 0 {
+			e.ExecuteCommand(w, "alert", noPreviousMacro.String())
+			return
+		}
+	}
+	e.macro.last = name
+	if name == ':' {
+		// Repeats the last command line instead of typing it again.
+		if e.lastCommand == "" {
+			e.ExecuteCommand(w, "alert", emptyRegister.Formatf(":"))
+			return
+		}
+		e.executeLine(w, e.lastCommand)
+		return
+	}
+	reg, ok := e.register(name)
+	if !ok || reg.text == "" {
+		e.ExecuteCommand(w, "alert", emptyRegister.Formatf(string(name)))
+		return
+	}
+	keys := parseKeys(reg.text)
+	if len(keys)+len(e.macro.pending) > maxMacroKeys {
+		e.stopMacro()
+		e.ExecuteCommand(w, "alert", macroTooLong.String())
+		return
+	}
+	// A macro played by a macro is played before the rest of the outer one.
+	e.macro.pending = append(keys, e.macro.pending...)
+	if !e.macro.active {
+		// Scheduled instead of run now, so a count plays the whole macro count
+		// times.
+		e.macro.active = true
+		e.deferred <- e.playNextKey
+	}
+}
+
+// isNotRecording returns true when no macro is being recorded. "q" only waits
+// for a register when it starts a recording; it stops one right away.
+func isNotRecording(e *editor) bool {
+	return e.macro.recording == 0
+}
+
+func cmdMacroRecord(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	if len(args) > 1 {
+		e.ExecuteCommand(w, "alert", c.LongDesc())
+		return
+	}
+	if e.macro.recording != 0 {
+		keys := e.macro.keys
+		if n := len(keys); n != 0 && keys[n-1] == (key.Press{Ch: 'q'}) {
+			// Drop the "q" that stopped the recording.
+			keys = keys[:n-1]
+		}
+		name := e.macro.recording
+		e.macro.recording = 0
+		e.macro.keys = nil
+		e.setRegister(name, register{formatKeys(keys), charSelection})
+		wicore.PostCommand(e, nil, "editor_redraw")
+		return
+	}
+	if len(args) == 0 {
+		e.ExecuteCommand(w, "alert", notRecording.String())
+		return
+	}
+	name, ok := registerArg(args)
+	if !ok || name == '%' || name == ':' {
+		e.ExecuteCommand(w, "alert", invalidRegister.Formatf(args[0]))
+		return
+	}
+	e.macro.recording = name
+	e.macro.keys = nil
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+// RegisterMacroCommands registers the commands to record and play keyboard
+// macros.
+func RegisterMacroCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&keyArgCommand{privilegedCommandImpl{
+			"macro_play",
+			1,
+			cmdMacroPlay,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Plays a keyboard macro",
+			},
+			lang.Map{
+				lang.En: "Usage: macro_play <register>\nTypes again the keys stored in a register, usually recorded with macro_record. @ plays the last register played and : runs the last command line again. A key typed during the playback stops it.",
+			},
+		}, nil},
+		&keyArgCommand{privilegedCommandImpl{
+			"macro_record",
+			-1,
+			cmdMacroRecord,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Records a keyboard macro",
+			},
+			lang.Map{
+				lang.En: "Usage: macro_record [register]\nStarts recording the keys typed in a register, or stops the recording without argument. An uppercase register appends to the register. The keys are stored as text: a key name between angle brackets, like <Escape> or <Ctrl-v>, is a single key and <lt> is \"<\".",
+			},
+		}, isNotRecording},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestParseKeys(t *testing.T) {
+	data := []struct {
+		text string
+		keys []key.Press
+	}{
+		{"", nil},
+		{"ab", []key.Press{{Ch: 'a'}, {Ch: 'b'}}},
+		{"a b\n", []key.Press{{Ch: 'a'}, {Key: key.Space}, {Ch: 'b'}, {Key: key.Enter}}},
+		{"<Escape><Ctrl-v>", []key.Press{{Key: key.Escape}, {Ctrl: true, Ch: 'v'}}},
+		{"<lt>a>", []key.Press{{Ch: '<'}, {Ch: 'a'}, {Ch: '>'}}},
+		{"<>", []key.Press{{Ch: '<'}, {Ch: '>'}}},
+	}
+	for i, line := range data {
+		keys := parseKeys(line.text)
+		ut.AssertEqualIndex(t, i, line.keys, keys)
+		ut.AssertEqualIndex(t, i, keys, parseKeys(formatKeys(keys)))
+	}
+	ut.AssertEqual(t, "a <lt>b><Enter><Escape><Ctrl-v>", formatKeys(parseKeys("a <lt>b>\n<Escape><Ctrl-v>")))
+}
+
+func TestMacros(t *testing.T) {
+	data := []struct {
+		content  string
+		keys     string
+		expected string
+		line     int
+		column   int
+	}{
+		{"a\nb\nc\nd\n", "qaxjq@a", "\n\nc\nd\n", 2, 0},
+		{"a\nb\nc\nd\n", "qaxjq2@a", "\n\n\nd\n", 3, 0},
+		{"a\nb\nc\nd\n", "qaxjq@a@@", "\n\n\nd\n", 3, 0},
+		// Insert mode and Escape are replayed.
+		{"a\nb\n", "qa0i-\x1b0jq@a", "-a\n-b\n", 2, 0},
+		// The command window too.
+		{"a a\nb a\n", "qa:s/a/x/\njq@a", "x a\nb x\n", 2, 0},
+		// Searches complete before the next key.
+		{"x\nfoo\nfoo\n", "qa/foo\nxq@a", "x\noo\noo\n", 2, 0},
+		// A macro is stored in a register and can be set as text.
+		{"ab\n", "qaxq\"ap", "bx\n", 0, 1},
+		{"abc\n", ":register_set b x<Escape>x\n@b", "c\n", 0, 0},
+		// An uppercase register appends.
+		{"abcd\n", "qaxqqAxq@a", "\n", 0, 0},
+		// A macro can play a macro.
+		{"abcdefg\n", "qbxqqa@bxq@a", "fg\n", 0, 0},
+		// @: repeats the last command line.
+		{"a\na\na\n", ":s/a/b/\nj@:j@@", "b\nb\nb\n", 2, 0},
+		// Errors.
+		{"ab\n", "@z", "ab\n", 0, 0},
+		{"ab\n", "@@", "ab\n", 0, 0},
+		{"ab\n", "q%x", "b\n", 0, 0},
+	}
+	for i, line := range data {
+		e, v := typeKeys(t, line.content, line.keys)
+		ut.AssertEqualIndex(t, i, line.expected, v.document.content.String())
+		ut.AssertEqualIndex(t, i, cursor{line.line, line.column, line.column}, v.primary())
+		ut.AssertEqualIndex(t, i, rune(0), e.macro.recording)
+	}
+}
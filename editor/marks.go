@@ -0,0 +1,469 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Marks, jump list and change list. They are all anchors, see anchor.go, so
+// they move with the edits.
+//
+// Like in vim, the local marks a-z belong to a document and the global marks
+// A-Z to the editor. Each Window has its own jump list, filled by the large
+// motions, the searches and the mark jumps. Each document has a change list
+// of the position of its last modifications.
+
+package editor
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/lang"
+)
+
+// maxJumps is the number of positions kept in a jump list or a change list.
+const maxJumps = 100
+
+// position is a position in a document that moves with the edits.
+type position struct {
+	doc *document
+	a   *anchor
+}
+
+// cursor returns the position as a cursor.
+func (p position) cursor() cursor {
+	line, col := p.doc.position(p.a.offset)
+	return cursor{line, col, col}
+}
+
+// isClosed returns true if the document was closed.
+func (d *document) isClosed() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// isLocalMark returns true for the marks a-z of a document.
+func isLocalMark(name rune) bool {
+	return name >= 'a' && name <= 'z'
+}
+
+// isGlobalMark returns true for the marks A-Z of the editor.
+func isGlobalMark(name rune) bool {
+	return name >= 'A' && name <= 'Z'
+}
+
+// setMark sets a mark at the primary cursor. The global marks are kept in the
+// marks of their document like the local marks, e.globalMarks tells which
+// document has each one.
+func (e *editor) setMark(v *documentView, name rune) {
+	d := v.document
+	holder := d
+	if isGlobalMark(name) {
+		if old, ok := e.globalMarks[name]; ok {
+			holder = old
+		}
+		e.globalMarks[name] = d
+	}
+	if old, ok := holder.marks[name]; ok {
+		holder.removeAnchor(old)
+		delete(holder.marks, name)
+	}
+	d.marks[name] = d.addAnchor(d.offset(v.cursorLine, v.cursorColumn))
+}
+
+// getMark returns the position of a mark, if set and not deleted.
+func (e *editor) getMark(v *documentView, name rune) (position, bool) {
+	d := v.document
+	if isGlobalMark(name) {
+		var ok bool
+		if d, ok = e.globalMarks[name]; !ok || d.isClosed() {
+			return position{}, false
+		}
+	}
+	if a, ok := d.marks[name]; ok && !a.deleted {
+		return position{d, a}, true
+	}
+	return position{}, false
+}
+
+// showDocument activates a Window showing a document, creating one if
+// needed, and returns its documentView.
+func (e *editor) showDocument(d *document) *documentView {
+	var found wicore.Window
+	var view *documentView
+	forEachDocumentWindow(e.rootWindow, func(w wicore.Window, v *documentView) {
+		if found == nil && v.document == d {
+			found, view = w, v
+		}
+	})
+	if found != nil {
+		e.activateWindow(found)
+		return view
+	}
+	e.ExecuteCommand(e.ActiveWindow(), "window_new", e.rootWindow.ID(), "fill", "new_document", d.ID())
+	view, _ = e.ActiveWindow().View().(*documentView)
+	return view
+}
+
+// forEachDocumentWindow calls f for each Window showing a documentView.
+func forEachDocumentWindow(w wicore.Window, f func(w wicore.Window, v *documentView)) {
+	if v, ok := w.View().(*documentView); ok {
+		f(w, v)
+	}
+	for _, c := range w.ChildrenWindows() {
+		forEachDocumentWindow(c, f)
+	}
+}
+
+// goTo moves the primary cursor to a position, switching to its document if
+// needed. Returns the documentView.
+func (e *editor) goTo(v *documentView, p position) *documentView {
+	if p.doc != v.document {
+		if v = e.showDocument(p.doc); v == nil {
+			return nil
+		}
+	}
+	v.cursors = nil
+	v.moveTo(e, p.cursor())
+	wicore.PostCommand(e, nil, "editor_redraw")
+	return v
+}
+
+// jumpList is the list of the positions before the jumps in a Window.
+type jumpList struct {
+	entries []position
+	index   int // Position in entries when going back with jump_older, len(entries) when not going back.
+}
+
+// push adds a position at the end of the jump list. A previous entry on the
+// same line is removed.
+func (j *jumpList) push(p position) {
+	line := p.doc.content.LineAt(p.a.offset)
+	for i := 0; i < len(j.entries); i++ {
+		if o := j.entries[i]; o.doc == p.doc && o.doc.content.LineAt(o.a.offset) == line {
+			o.doc.removeAnchor(o.a)
+			j.entries = append(j.entries[:i], j.entries[i+1:]...)
+			i--
+		}
+	}
+	j.entries = append(j.entries, p)
+	if len(j.entries) > maxJumps {
+		j.entries[0].doc.removeAnchor(j.entries[0].a)
+		j.entries = j.entries[1:]
+	}
+	j.index = len(j.entries)
+}
+
+// jumpListOf returns the jump list of a Window, nil if it has none.
+func jumpListOf(w wicore.Window) *jumpList {
+	if win, ok := w.(*window); ok {
+		return &win.jumps
+	}
+	return nil
+}
+
+// recordJump adds the primary cursor to the jump list of a Window, before a
+// jump.
+func recordJump(w wicore.Window, v *documentView) {
+	if j := jumpListOf(w); j != nil {
+		d := v.document
+		j.push(position{d, d.addAnchor(d.offset(v.cursorLine, v.cursorColumn))})
+	}
+}
+
+// jumpMotion records the position in the jump list before a large motion.
+func jumpMotion(handler wicore.MotionImplHandler) wicore.MotionImplHandler {
+	return func(c *wicore.MotionImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+		if v, ok := w.View().(*documentView); ok {
+			recordJump(w, v)
+		}
+		handler(c, e, w, args...)
+	}
+}
+
+// recordChange adds the position of a modification to the change list. A
+// modification on the same line as the last one replaces it.
+func (d *document) recordChange(offset int) {
+	if n := len(d.changes); n != 0 {
+		if last := d.changes[n-1]; !last.deleted && d.content.LineAt(last.offset) == d.content.LineAt(offset) {
+			d.moveAnchor(last, offset)
+			d.changeIndex = n
+			return
+		}
+	}
+	d.changes = append(d.changes, d.addAnchor(offset))
+	if len(d.changes) > maxJumps {
+		d.removeAnchor(d.changes[0])
+		d.changes = d.changes[1:]
+	}
+	d.changeIndex = len(d.changes)
+}
+
+// countArg returns the optional count argument, 1 by default.
+func countArg(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 1, true
+	}
+	n, err := strconv.Atoi(args[0])
+	return n, err == nil && n > 0
+}
+
+// Commands
+
+func cmdMarkSet(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	v, ok := searchView(e, w)
+	if !ok {
+		return
+	}
+	name := []rune(args[0])
+	if len(name) != 1 || (!isLocalMark(name[0]) && !isGlobalMark(name[0])) {
+		e.ExecuteCommand(w, "alert", invalidMark.Formatf(args[0]))
+		return
+	}
+	e.setMark(v, name[0])
+}
+
+func cmdMarkJump(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	markJump(e, w, args[0], false)
+}
+
+func cmdMarkJumpLine(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	markJump(e, w, args[0], true)
+}
+
+// markJump moves the cursor to a mark, or to the first non-blank of its line.
+func markJump(e *editor, w *window, name string, firstNonBlankCol bool) {
+	v, ok := searchView(e, w)
+	if !ok {
+		return
+	}
+	var p position
+	if r := []rune(name); len(r) == 1 {
+		p, ok = e.getMark(v, r[0])
+	}
+	if !ok {
+		e.ExecuteCommand(w, "alert", markNotSet.Formatf(name))
+		return
+	}
+	recordJump(w, v)
+	if v = e.goTo(v, p); v != nil && firstNonBlankCol {
+		col := firstNonBlank(v.document, v.cursorLine)
+		v.moveTo(e, cursor{v.cursorLine, col, col})
+	}
+}
+
+func cmdMarks(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	v, ok := searchView(e, w)
+	if !ok {
+		return
+	}
+	items := []string{marksHeader.String()}
+	add := func(name rune, p position) {
+		c := p.cursor()
+		text := p.doc.line(c.line)
+		if p.doc != v.document {
+			text = p.doc.filePath
+		}
+		items = append(items, fmt.Sprintf(" %c  %6d %4d  %s", name, c.line+1, c.column, text))
+	}
+	for name := 'a'; name <= 'z'; name++ {
+		if p, ok := e.getMark(v, name); ok {
+			add(name, p)
+		}
+	}
+	for name := 'A'; name <= 'Z'; name++ {
+		if p, ok := e.getMark(v, name); ok {
+			add(name, p)
+		}
+	}
+	for _, name := range "<>" {
+		if c, ok := v.mark(name); ok {
+			items = append(items, fmt.Sprintf(" %c  %6d %4d  %s", name, c.line+1, c.column, v.document.line(c.line)))
+		}
+	}
+	e.ExecuteCommand(w, "window_new", append([]string{"0", "floating", "list", marksTitle.String()}, items...)...)
+}
+
+func cmdJumpOlder(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	jump(e, w, args, -1)
+}
+
+func cmdJumpNewer(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	jump(e, w, args, 1)
+}
+
+// jump moves count entries in the jump list of a Window, in the direction of
+// dir.
+func jump(e *editor, w *window, args []string, dir int) {
+	v, ok := searchView(e, w)
+	if !ok {
+		return
+	}
+	n, ok := countArg(args)
+	if !ok {
+		e.ExecuteCommand(w, "alert", invalidCount.Formatf(args[0]))
+		return
+	}
+	j := &w.jumps
+	if dir < 0 && j.index == len(j.entries) {
+		// Going back for the first time, so the current position can be reached
+		// again with jump_newer.
+		recordJump(w, v)
+		j.index = len(j.entries) - 1
+	}
+	target := j.index + dir*n
+	if target < 0 || target >= len(j.entries) {
+		// TODO(maruel): Beep.
+		return
+	}
+	j.index = target
+	p := j.entries[target]
+	if p.doc.isClosed() {
+		// TODO(maruel): Reopen the file.
+		return
+	}
+	e.goTo(v, p)
+}
+
+func cmdChangeOlder(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	change(e, w, args, -1)
+}
+
+func cmdChangeNewer(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	change(e, w, args, 1)
+}
+
+// change moves count entries in the change list of the document, in the
+// direction of dir.
+func change(e *editor, w *window, args []string, dir int) {
+	v, ok := searchView(e, w)
+	if !ok {
+		return
+	}
+	n, ok := countArg(args)
+	if !ok {
+		e.ExecuteCommand(w, "alert", invalidCount.Formatf(args[0]))
+		return
+	}
+	d := v.document
+	target := d.changeIndex + dir*n
+	if target < 0 {
+		e.ExecuteCommand(w, "alert", changeListStart.String())
+		return
+	}
+	if target >= len(d.changes) {
+		e.ExecuteCommand(w, "alert", changeListEnd.String())
+		return
+	}
+	d.changeIndex = target
+	e.goTo(v, position{d, d.changes[target]})
+}
+
+// RegisterMarkCommands registers the commands for the marks, the jump list
+// and the change list.
+func RegisterMarkCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"change_newer",
+			-1,
+			cmdChangeNewer,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Goes to a newer position in the change list",
+			},
+			lang.Map{
+				lang.En: "Usage: change_newer [count]\nMoves the cursor to a newer position in the change list of the document, after change_older.",
+			},
+		},
+		&privilegedCommandImpl{
+			"change_older",
+			-1,
+			cmdChangeOlder,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Goes to an older position in the change list",
+			},
+			lang.Map{
+				lang.En: "Usage: change_older [count]\nMoves the cursor to an older position in the change list of the document. The change list holds the position of the last modifications of the document, one per line.",
+			},
+		},
+		&privilegedCommandImpl{
+			"jump_newer",
+			-1,
+			cmdJumpNewer,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Goes to a newer position in the jump list",
+			},
+			lang.Map{
+				lang.En: "Usage: jump_newer [count]\nMoves the cursor to a newer position in the jump list of the Window, after jump_older.",
+			},
+		},
+		&privilegedCommandImpl{
+			"jump_older",
+			-1,
+			cmdJumpOlder,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Goes to an older position in the jump list",
+			},
+			lang.Map{
+				lang.En: "Usage: jump_older [count]\nMoves the cursor to an older position in the jump list of the Window. The jump list holds the positions before the large motions, like document_cursor_last_line, the searches and the mark jumps.",
+			},
+		},
+		&keyArgCommand{privilegedCommandImpl{
+			"mark_jump",
+			1,
+			cmdMarkJump,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Moves the cursor to a mark",
+			},
+			lang.Map{
+				lang.En: "Usage: mark_jump <mark>\nMoves the cursor to a mark set with mark_set. A global mark switches to its document.",
+			},
+		}, nil},
+		&keyArgCommand{privilegedCommandImpl{
+			"mark_jump_line",
+			1,
+			cmdMarkJumpLine,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Moves the cursor to the line of a mark",
+			},
+			lang.Map{
+				lang.En: "Usage: mark_jump_line <mark>\nMoves the cursor to the first non-blank character of the line of a mark set with mark_set. A global mark switches to its document.",
+			},
+		}, nil},
+		&keyArgCommand{privilegedCommandImpl{
+			"mark_set",
+			1,
+			cmdMarkSet,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Sets a mark at the cursor",
+			},
+			lang.Map{
+				lang.En: "Usage: mark_set <mark>\nSets a mark at the cursor. The marks a to z are local to the document, the marks A to Z are global. A mark moves with the edits and is removed when its line is deleted. The marks can be used in the ranges, like 'a,'b.",
+			},
+		}, nil},
+		&privilegedCommandImpl{
+			"marks",
+			0,
+			cmdMarks,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Lists the marks",
+			},
+			lang.Map{
+				lang.En: "Lists the marks of the active document and the global marks.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestMarks(t *testing.T) {
+	data := []struct {
+		content  string
+		keys     string
+		expected string
+		line     int
+		column   int
+	}{
+		{"a\n  b\nc\n", "jllmagg'a", "a\n  b\nc\n", 1, 2},
+		{"ab\ncd\n", "jlmagg`a", "ab\ncd\n", 1, 1},
+		{"ab\ncd\n", "jlmAgg`A", "ab\ncd\n", 1, 1},
+		// The marks move with the edits.
+		{"a\nb\nc\n", "jjmaggdd'a", "b\nc\n", 1, 0},
+		{"ab\ncd\n", "jlmagg0x`a", "b\ncd\n", 1, 1},
+		// A mark is removed with its line.
+		{"a\nb\nc\n", "jjmaddgg'a", "a\nb\n", 0, 0},
+		{"a\nb\n", "'z", "a\nb\n", 0, 0},
+		// The marks can be used in the ranges.
+		{"a\nb\nc\nd\n", "jmajjmb:'a,'bd\n", "a\n", 1, 0},
+		// The jump list.
+		{"a\nb\nc\nd\n", "jG\x0f", "a\nb\nc\nd\n", 1, 0},
+		{"a\nb\nc\nd\n", "jG\x0f\x0f", "a\nb\nc\nd\n", 1, 0},
+		{"a\nb\nc\nd\n", "jGgg\x0f\x0f", "a\nb\nc\nd\n", 1, 0},
+		{"a\nb\nc\nd\n", "jGgg\x0f\x0f\t", "a\nb\nc\nd\n", 4, 0},
+		{"a\nb\nc\nd\n", "jGgg\x0f\x0f\t\t", "a\nb\nc\nd\n", 0, 0},
+		{"a\nb\nc\nd\n", "jGgg2\x0f", "a\nb\nc\nd\n", 1, 0},
+		{"a\nfoo\nb\n", "/foo\n\x0f", "a\nfoo\nb\n", 0, 0},
+		{"a\nb\nc\n", "jjmagg'a\x0f", "a\nb\nc\n", 0, 0},
+		// The change list.
+		{"ab\nc\nde\nf\n", "xjjxGg;", "b\nc\ne\nf\n", 2, 0},
+		{"ab\nc\nde\nf\n", "xjjxGg;g;", "b\nc\ne\nf\n", 0, 0},
+		{"ab\nc\nde\nf\n", "xjjxGg;g;g,", "b\nc\ne\nf\n", 2, 0},
+		{"ab\nc\nde\nf\n", "xjjxG2g;", "b\nc\ne\nf\n", 0, 0},
+		{"ab\nc\nde\nf\n", "xjjxGg,", "b\nc\ne\nf\n", 4, 0},
+	}
+	for i, line := range data {
+		_, v := typeKeys(t, line.content, line.keys)
+		ut.AssertEqualIndex(t, i, line.expected, v.document.content.String())
+		ut.AssertEqualIndex(t, i, cursor{line.line, line.column, line.column}, v.primary())
+	}
+}
+
+func TestMarksList(t *testing.T) {
+	e, _ := typeKeys(t, "a\nb\n", "jmamB:marks\n")
+	lines := e.ActiveWindow().View().(*listView).lines
+	ut.AssertEqual(t, []string{marksHeader.String(), " a       2    0  b", " B       2    0  b"}, lines)
+}
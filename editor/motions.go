@@ -0,0 +1,853 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Motions and text objects of a documentView. They are wicore.Motion so they
+// can follow an operator, see key_parser.go. A text object selects the text
+// instead of moving the cursor.
+
+package editor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/lang"
+)
+
+// runeClass classifies the runes for the word motions.
+type runeClass int
+
+const (
+	spaceClass runeClass = iota // Whitespace and line terminators.
+	wordClass                   // Letters, digits, marks and '_'.
+	punctClass                  // Everything else.
+)
+
+// classOf returns the class of a rune. A WORD is any run of non-whitespace
+// runes.
+func classOf(r rune, bigWord bool) runeClass {
+	switch {
+	case unicode.IsSpace(r):
+		return spaceClass
+	case bigWord || isWordRune(r):
+		return wordClass
+	}
+	return punctClass
+}
+
+// textWalker walks the runes of a document. The column past the end of a line
+// stands for the line terminator, read as '\n'.
+type textWalker struct {
+	d     *document
+	line  int
+	col   int
+	runes []rune // Runes of the line.
+}
+
+func makeTextWalker(d *document, line, col int) textWalker {
+	t := textWalker{d: d}
+	t.setLine(line)
+	if col < len(t.runes) {
+		t.col = col
+	} else {
+		t.col = len(t.runes)
+	}
+	return t
+}
+
+func (t *textWalker) setLine(line int) {
+	t.line = line
+	t.runes = []rune(t.d.line(line))
+}
+
+// rune returns the rune at the position.
+func (t *textWalker) rune() rune {
+	if t.col >= len(t.runes) {
+		return '\n'
+	}
+	return t.runes[t.col]
+}
+
+func (t *textWalker) class(bigWord bool) runeClass {
+	return classOf(t.rune(), bigWord)
+}
+
+// emptyLine returns true if the position is on an empty line.
+func (t *textWalker) emptyLine() bool {
+	return len(t.runes) == 0
+}
+
+// next moves to the next rune. Returns false at the end of the document.
+func (t *textWalker) next() bool {
+	if t.col < len(t.runes) {
+		t.col++
+		return true
+	}
+	if t.line+1 >= t.d.lineCount() {
+		return false
+	}
+	t.setLine(t.line + 1)
+	t.col = 0
+	return true
+}
+
+// prev moves to the previous rune. Returns false at the start of the document.
+func (t *textWalker) prev() bool {
+	if t.col > 0 {
+		t.col--
+		return true
+	}
+	if t.line == 0 {
+		return false
+	}
+	t.setLine(t.line - 1)
+	t.col = len(t.runes)
+	return true
+}
+
+func (t *textWalker) cursor() cursor {
+	return cursor{t.line, t.col, t.col}
+}
+
+// wordNext moves to the start of the next word. An empty line is a word.
+func wordNext(t *textWalker, bigWord bool) {
+	line := t.line
+	if c := t.class(bigWord); c != spaceClass {
+		for t.class(bigWord) == c {
+			if !t.next() {
+				return
+			}
+		}
+	}
+	for t.class(bigWord) == spaceClass && !(t.emptyLine() && t.line != line) {
+		if !t.next() {
+			return
+		}
+	}
+}
+
+// wordEnd moves to the end of the word, or of the next one if already at the
+// end of a word.
+func wordEnd(t *textWalker, bigWord bool) {
+	if !t.next() {
+		return
+	}
+	for t.class(bigWord) == spaceClass {
+		if !t.next() {
+			return
+		}
+	}
+	wordLast(t, bigWord)
+}
+
+// wordLast moves to the last rune of the word at the position.
+func wordLast(t *textWalker, bigWord bool) {
+	c := t.class(bigWord)
+	for {
+		u := *t
+		if !u.next() || u.class(bigWord) != c {
+			return
+		}
+		*t = u
+	}
+}
+
+// wordPrev moves to the start of the word, or of the previous one if already
+// at the start of a word.
+func wordPrev(t *textWalker, bigWord bool) {
+	if !t.prev() {
+		return
+	}
+	for t.class(bigWord) == spaceClass && !t.emptyLine() {
+		if !t.prev() {
+			return
+		}
+	}
+	if t.emptyLine() {
+		return
+	}
+	c := t.class(bigWord)
+	for {
+		u := *t
+		if !u.prev() || u.class(bigWord) != c {
+			return
+		}
+		*t = u
+	}
+}
+
+// sentenceStart returns true if a sentence starts at the position. A sentence
+// ends with '.', '!' or '?', optionally followed by closing quotes or
+// brackets, then by whitespace. Empty lines are sentence boundaries.
+func sentenceStart(t textWalker) bool {
+	u := t
+	if t.emptyLine() {
+		return !u.prev() || !u.emptyLine()
+	}
+	if unicode.IsSpace(t.rune()) {
+		return false
+	}
+	if !u.prev() {
+		return true
+	}
+	if !unicode.IsSpace(u.rune()) {
+		return false
+	}
+	for unicode.IsSpace(u.rune()) {
+		if u.emptyLine() || !u.prev() {
+			return true
+		}
+	}
+	for strings.ContainsRune(")]\"'", u.rune()) {
+		if !u.prev() {
+			return false
+		}
+	}
+	return strings.ContainsRune(".!?", u.rune())
+}
+
+// matchPair moves from the bracket at or after the position on the line to
+// the matching one. Returns false if there is none.
+func matchPair(t *textWalker) bool {
+	const pairs = "()[]{}"
+	u := *t
+	for u.col < len(u.runes) && strings.IndexRune(pairs, u.runes[u.col]) < 0 {
+		u.col++
+	}
+	if u.col >= len(u.runes) {
+		return false
+	}
+	i := strings.IndexRune(pairs, u.runes[u.col])
+	if i%2 == 0 {
+		if !u.next() || !findClose(&u, rune(pairs[i]), rune(pairs[i+1])) {
+			return false
+		}
+	} else if !u.prev() || !findOpen(&u, rune(pairs[i-1]), rune(pairs[i])) {
+		return false
+	}
+	*t = u
+	return true
+}
+
+// findClose moves to the first close rune not matched by an open rune, like
+// the end of the brackets around the position.
+func findClose(t *textWalker, open, close rune) bool {
+	u := *t
+	depth := 0
+	for {
+		switch u.rune() {
+		case open:
+			depth++
+		case close:
+			if depth == 0 {
+				*t = u
+				return true
+			}
+			depth--
+		}
+		if !u.next() {
+			return false
+		}
+	}
+}
+
+// findOpen moves to the first open rune, going backward, not matched by a close
+// rune, like the start of the brackets around the position.
+func findOpen(t *textWalker, open, close rune) bool {
+	u := *t
+	depth := 0
+	for {
+		switch u.rune() {
+		case close:
+			depth++
+		case open:
+			if depth == 0 {
+				*t = u
+				return true
+			}
+			depth--
+		}
+		if !u.prev() {
+			return false
+		}
+	}
+}
+
+// firstNonBlank returns the column of the first rune of a line that is not a
+// space or a tab.
+func firstNonBlank(d *document, line int) int {
+	l := d.line(line)
+	return len([]rune(l)) - len([]rune(strings.TrimLeft(l, " \t")))
+}
+
+func (v *documentView) walker() textWalker {
+	return makeTextWalker(v.document, v.cursorLine, v.cursorColumn)
+}
+
+// moveTo moves the primary cursor.
+func (v *documentView) moveTo(e wicore.Editor, c cursor) {
+	v.setPrimary(c)
+	v.cursorMoved(e)
+}
+
+// selectObject selects a text object, from start to end included. A Visual
+// mode selection keeps its kind.
+func (v *documentView) selectObject(e wicore.Editor, kind selectionKind, start, end cursor) {
+	if v.selection.kind != noSelection {
+		kind = v.selection.kind
+	}
+	v.selection = selection{kind, start}
+	v.setPrimary(end)
+	v.cursorMoved(e)
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+// selectWordEnd selects from the cursor to the end of the count-th word, for
+// "cw". Returns false if the cursor is on whitespace.
+func (v *documentView) selectWordEnd(e wicore.Editor, bigWord bool, count int) bool {
+	t := v.walker()
+	if t.class(bigWord) == spaceClass {
+		return false
+	}
+	start := t.cursor()
+	wordLast(&t, bigWord)
+	for i := 1; i < count; i++ {
+		wordEnd(&t, bigWord)
+	}
+	v.selectObject(e, charSelection, start, t.cursor())
+	return true
+}
+
+// Motions
+
+func wordMotion(f func(t *textWalker, bigWord bool), bigWord bool) func(v *documentView, e wicore.EditorW) {
+	return func(v *documentView, e wicore.EditorW) {
+		t := v.walker()
+		f(&t, bigWord)
+		v.moveTo(e, t.cursor())
+	}
+}
+
+func cmdDocumentCursorLineStart(v *documentView, e wicore.EditorW) {
+	v.moveTo(e, cursor{v.cursorLine, 0, 0})
+}
+
+func cmdDocumentCursorLineFirstNonBlank(v *documentView, e wicore.EditorW) {
+	col := firstNonBlank(v.document, v.cursorLine)
+	v.moveTo(e, cursor{v.cursorLine, col, col})
+}
+
+// cmdDocumentCursorLineEnd moves to the last rune of the line, count-1 lines
+// down. In Insert mode, the cursor goes past the last rune.
+func cmdDocumentCursorLineEnd(v *documentView, e wicore.EditorW, count int) {
+	line := v.cursorLine
+	if count > 1 {
+		line += count - 1
+	}
+	if last := v.document.lineCount() - 1; line > last {
+		line = last
+	}
+	col := v.document.lineLength(line)
+	if col != 0 && e.KeyboardMode() != wicore.Insert {
+		col--
+	}
+	v.moveTo(e, cursor{line, col, col})
+}
+
+// goToLine moves to the first non-blank rune of the 1-based line.
+func (v *documentView) goToLine(e wicore.Editor, line int) {
+	line--
+	if last := v.document.lineCount() - 1; line > last {
+		line = last
+	}
+	col := firstNonBlank(v.document, line)
+	v.moveTo(e, cursor{line, col, col})
+}
+
+func cmdDocumentCursorFirstLine(v *documentView, e wicore.EditorW, count int) {
+	if count == 0 {
+		count = 1
+	}
+	v.goToLine(e, count)
+}
+
+func cmdDocumentCursorLastLine(v *documentView, e wicore.EditorW, count int) {
+	if count == 0 {
+		count = v.document.lineCount()
+	}
+	v.goToLine(e, count)
+}
+
+func cmdDocumentCursorParagraphNext(v *documentView, e wicore.EditorW) {
+	d := v.document
+	last := d.lineCount() - 1
+	line := v.cursorLine
+	for line < last && d.lineLength(line) == 0 {
+		line++
+	}
+	for line < last && d.lineLength(line) != 0 {
+		line++
+	}
+	col := 0
+	if d.lineLength(line) != 0 {
+		// No empty line until the end of the document.
+		col = d.lineLength(line)
+	}
+	v.moveTo(e, cursor{line, col, col})
+}
+
+func cmdDocumentCursorParagraphPrev(v *documentView, e wicore.EditorW) {
+	d := v.document
+	line := v.cursorLine
+	for line > 0 && d.lineLength(line) == 0 {
+		line--
+	}
+	for line > 0 && d.lineLength(line) != 0 {
+		line--
+	}
+	v.moveTo(e, cursor{line, 0, 0})
+}
+
+func cmdDocumentCursorSentenceNext(v *documentView, e wicore.EditorW) {
+	t := v.walker()
+	for t.next() && !sentenceStart(t) {
+	}
+	v.moveTo(e, t.cursor())
+}
+
+func cmdDocumentCursorSentencePrev(v *documentView, e wicore.EditorW) {
+	t := v.walker()
+	for t.prev() && !sentenceStart(t) {
+	}
+	v.moveTo(e, t.cursor())
+}
+
+func cmdDocumentCursorMatchPair(v *documentView, e wicore.EditorW) {
+	t := v.walker()
+	if !matchPair(&t) {
+		// TODO(maruel): Beep.
+		return
+	}
+	v.moveTo(e, t.cursor())
+}
+
+// Text objects
+
+// wordObject selects the word, or the whitespace, at the cursor on its line.
+// The outer object also selects the whitespace after the word, or before it
+// if there is none.
+func wordObject(bigWord, outer bool) func(v *documentView, e wicore.EditorW) {
+	return func(v *documentView, e wicore.EditorW) {
+		runes := []rune(v.document.line(v.cursorLine))
+		if len(runes) == 0 {
+			// TODO(maruel): Beep.
+			return
+		}
+		col := v.cursorColumn
+		if col >= len(runes) {
+			col = len(runes) - 1
+		}
+		span := func(start, end int) (int, int) {
+			c := classOf(runes[start], bigWord)
+			for start > 0 && classOf(runes[start-1], bigWord) == c {
+				start--
+			}
+			for end < len(runes) && classOf(runes[end], bigWord) == c {
+				end++
+			}
+			return start, end
+		}
+		start, end := span(col, col)
+		if outer {
+			if classOf(runes[col], bigWord) == spaceClass {
+				// The whitespace and the word after it.
+				if end < len(runes) {
+					_, end = span(end, end)
+				}
+			} else if end < len(runes) && classOf(runes[end], bigWord) == spaceClass {
+				_, end = span(end, end)
+			} else if start > 0 && classOf(runes[start-1], bigWord) == spaceClass {
+				start, _ = span(start-1, start-1)
+			}
+		}
+		v.selectObject(e, charSelection, cursor{v.cursorLine, start, start}, cursor{v.cursorLine, end - 1, end - 1})
+	}
+}
+
+// paragraphObject selects the lines of the paragraph, or the empty lines, at
+// the cursor. The outer object also selects the empty lines after the
+// paragraph, or before it if there is none.
+func paragraphObject(outer bool) func(v *documentView, e wicore.EditorW) {
+	return func(v *documentView, e wicore.EditorW) {
+		d := v.document
+		last := d.lineCount() - 1
+		span := func(first, end int) (int, int) {
+			empty := d.lineLength(first) == 0
+			for first > 0 && (d.lineLength(first-1) == 0) == empty {
+				first--
+			}
+			for end < last && (d.lineLength(end+1) == 0) == empty {
+				end++
+			}
+			return first, end
+		}
+		first, end := span(v.cursorLine, v.cursorLine)
+		if outer {
+			if end < last {
+				_, end = span(end+1, end+1)
+			} else if first > 0 {
+				first, _ = span(first-1, first-1)
+			}
+		}
+		v.selectObject(e, lineSelection, cursor{first, 0, 0}, cursor{end, 0, 0})
+	}
+}
+
+// quoteObject selects the quoted text on the cursor line, the pair around the
+// cursor or the first one after it. The outer object includes the quotes and
+// the whitespace after them, or before them if there is none.
+func quoteObject(quote rune, outer bool) func(v *documentView, e wicore.EditorW) {
+	return func(v *documentView, e wicore.EditorW) {
+		runes := []rune(v.document.line(v.cursorLine))
+		var quotes []int
+		for i, r := range runes {
+			if r == quote && (i == 0 || runes[i-1] != '\\') {
+				quotes = append(quotes, i)
+			}
+		}
+		start, end := -1, -1
+		for i := 0; i+1 < len(quotes); i += 2 {
+			if quotes[i+1] >= v.cursorColumn {
+				start, end = quotes[i], quotes[i+1]
+				break
+			}
+		}
+		if start == -1 {
+			// TODO(maruel): Beep.
+			return
+		}
+		if outer {
+			end++
+			if end < len(runes) && unicode.IsSpace(runes[end]) {
+				for end < len(runes) && unicode.IsSpace(runes[end]) {
+					end++
+				}
+			} else {
+				for start > 0 && unicode.IsSpace(runes[start-1]) {
+					start--
+				}
+			}
+		} else {
+			start++
+			if start == end {
+				// Nothing between the quotes.
+				return
+			}
+		}
+		v.selectObject(e, charSelection, cursor{v.cursorLine, start, start}, cursor{v.cursorLine, end - 1, end - 1})
+	}
+}
+
+// bracketObject selects the text inside the brackets around the cursor. The
+// outer object includes the brackets. Like in vim, when the brackets are on
+// their own lines, the inner object is the lines between them.
+func bracketObject(open, close rune, outer bool) func(v *documentView, e wicore.EditorW) {
+	return func(v *documentView, e wicore.EditorW) {
+		t := v.walker()
+		if t.rune() != open {
+			if t.rune() == close && !t.prev() {
+				// TODO(maruel): Beep.
+				return
+			}
+			if !findOpen(&t, open, close) {
+				// TODO(maruel): Beep.
+				return
+			}
+		}
+		end := t
+		if !end.next() || !findClose(&end, open, close) {
+			// TODO(maruel): Beep.
+			return
+		}
+		if !outer {
+			t.next()
+			if t.col == len(t.runes) && t.line < end.line {
+				// The open bracket ends its line.
+				t.next()
+			}
+			if end.line > t.line && firstNonBlank(end.d, end.line) == end.col {
+				// The close bracket starts its line, the inner text stops at the
+				// end of the previous line.
+				end.col = 0
+			}
+			end.prev()
+			if t.line > end.line || (t.line == end.line && t.col > end.col) {
+				// Nothing between the brackets.
+				return
+			}
+		}
+		v.selectObject(e, charSelection, t.cursor(), end.cursor())
+	}
+}
+
+// motionToDocCount adapts a motion using the count, 0 if none, to
+// wicore.MotionImpl.
+func motionToDocCount(handler func(v *documentView, e wicore.EditorW, count int)) wicore.MotionImplHandler {
+	return func(c *wicore.MotionImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+		count := 0
+		if len(args) != 0 {
+			count, _ = strconv.Atoi(args[0])
+		}
+		motionToDoc(forEachCursor(func(v *documentView, e wicore.EditorW) {
+			handler(v, e, count)
+		}))(c, e, w)
+	}
+}
+
+// documentMotions returns the motions and the text objects of a documentView.
+func documentMotions() []wicore.Command {
+	cmds := []wicore.Command{
+		&wicore.MotionImpl{
+			"document_cursor_bigword_end",
+			wicore.MotionInclusive,
+			false,
+			motionToDoc(forEachCursor(wordMotion(wordEnd, true))),
+			lang.Map{
+				lang.En: "Moves cursor to the end of the WORD",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_bigword_end [count]\nMoves cursor to the end of the WORD, or of the next one when already at the end. A WORD is a sequence of non-whitespace characters.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_bigword_next",
+			wicore.MotionExclusive,
+			false,
+			motionToDoc(forEachCursor(wordMotion(wordNext, true))),
+			lang.Map{
+				lang.En: "Moves cursor to the next WORD",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_bigword_next [count]\nMoves cursor to the start of the next WORD. A WORD is a sequence of non-whitespace characters. An empty line is a WORD.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_bigword_prev",
+			wicore.MotionExclusive,
+			false,
+			motionToDoc(forEachCursor(wordMotion(wordPrev, true))),
+			lang.Map{
+				lang.En: "Moves cursor to the previous WORD",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_bigword_prev [count]\nMoves cursor to the start of the WORD, or of the previous one when already at the start. A WORD is a sequence of non-whitespace characters.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_first_line",
+			wicore.MotionLinewise,
+			true,
+			jumpMotion(motionToDocCount(cmdDocumentCursorFirstLine)),
+			lang.Map{
+				lang.En: "Moves cursor to the first line",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_first_line [line]\nMoves cursor to the first non-blank character of a line, the first line by default.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_last_line",
+			wicore.MotionLinewise,
+			true,
+			jumpMotion(motionToDocCount(cmdDocumentCursorLastLine)),
+			lang.Map{
+				lang.En: "Moves cursor to the last line",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_last_line [line]\nMoves cursor to the first non-blank character of a line, the last line by default.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_line_end",
+			wicore.MotionInclusive,
+			true,
+			motionToDocCount(cmdDocumentCursorLineEnd),
+			lang.Map{
+				lang.En: "Moves cursor to the end of the line",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_line_end [count]\nMoves cursor to the last character of the line, count-1 lines down. In Insert mode, the cursor goes after the last character.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_line_first_nonblank",
+			wicore.MotionExclusive,
+			false,
+			motionToDoc(forEachCursor(cmdDocumentCursorLineFirstNonBlank)),
+			lang.Map{
+				lang.En: "Moves cursor to the first non-blank character of the line",
+			},
+			lang.Map{
+				lang.En: "Moves cursor to the first character of the line that is not a space or a tab.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_line_start",
+			wicore.MotionExclusive,
+			false,
+			motionToDoc(forEachCursor(cmdDocumentCursorLineStart)),
+			lang.Map{
+				lang.En: "Moves cursor to the start of the line",
+			},
+			lang.Map{
+				lang.En: "Moves cursor to the first column of the line.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_match_pair",
+			wicore.MotionInclusive,
+			false,
+			jumpMotion(motionToDoc(forEachCursor(cmdDocumentCursorMatchPair))),
+			lang.Map{
+				lang.En: "Moves cursor to the matching bracket",
+			},
+			lang.Map{
+				lang.En: "Moves cursor from the first bracket (, ), [, ], { or } at or after the cursor on the line to the matching one.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_paragraph_next",
+			wicore.MotionExclusive,
+			false,
+			jumpMotion(motionToDoc(forEachCursor(cmdDocumentCursorParagraphNext))),
+			lang.Map{
+				lang.En: "Moves cursor to the end of the paragraph",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_paragraph_next [count]\nMoves cursor to the empty line after the paragraph, or to the end of the document.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_paragraph_prev",
+			wicore.MotionExclusive,
+			false,
+			jumpMotion(motionToDoc(forEachCursor(cmdDocumentCursorParagraphPrev))),
+			lang.Map{
+				lang.En: "Moves cursor to the start of the paragraph",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_paragraph_prev [count]\nMoves cursor to the empty line before the paragraph, or to the start of the document.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_sentence_next",
+			wicore.MotionExclusive,
+			false,
+			jumpMotion(motionToDoc(forEachCursor(cmdDocumentCursorSentenceNext))),
+			lang.Map{
+				lang.En: "Moves cursor to the next sentence",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_sentence_next [count]\nMoves cursor to the start of the next sentence. A sentence ends with '.', '!' or '?' followed by whitespace; closing quotes and brackets are allowed in between. Empty lines are sentence boundaries.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_sentence_prev",
+			wicore.MotionExclusive,
+			false,
+			jumpMotion(motionToDoc(forEachCursor(cmdDocumentCursorSentencePrev))),
+			lang.Map{
+				lang.En: "Moves cursor to the start of the sentence",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_sentence_prev [count]\nMoves cursor to the start of the sentence, or of the previous one when already at the start.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_word_end",
+			wicore.MotionInclusive,
+			false,
+			motionToDoc(forEachCursor(wordMotion(wordEnd, false))),
+			lang.Map{
+				lang.En: "Moves cursor to the end of the word",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_word_end [count]\nMoves cursor to the end of the word, or of the next one when already at the end. A word is a sequence of letters, digits and underscores, or a sequence of other non-whitespace characters.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_word_next",
+			wicore.MotionExclusive,
+			false,
+			motionToDoc(forEachCursor(wordMotion(wordNext, false))),
+			lang.Map{
+				lang.En: "Moves cursor to the next word",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_word_next [count]\nMoves cursor to the start of the next word. A word is a sequence of letters, digits and underscores, or a sequence of other non-whitespace characters. An empty line is a word.",
+			},
+		},
+		&wicore.MotionImpl{
+			"document_cursor_word_prev",
+			wicore.MotionExclusive,
+			false,
+			motionToDoc(forEachCursor(wordMotion(wordPrev, false))),
+			lang.Map{
+				lang.En: "Moves cursor to the previous word",
+			},
+			lang.Map{
+				lang.En: "Usage: document_cursor_word_prev [count]\nMoves cursor to the start of the word, or of the previous one when already at the start.",
+			},
+		},
+	}
+
+	// Text objects. The count is ignored.
+	objects := []struct {
+		name    string
+		desc    string
+		handler func(outer bool) func(v *documentView, e wicore.EditorW)
+	}{
+		{"angle", "the text inside <>", func(outer bool) func(v *documentView, e wicore.EditorW) { return bracketObject('<', '>', outer) }},
+		{"backtick", "the text inside ``", func(outer bool) func(v *documentView, e wicore.EditorW) { return quoteObject('`', outer) }},
+		{"bigword", "the WORD", func(outer bool) func(v *documentView, e wicore.EditorW) { return wordObject(true, outer) }},
+		{"brace", "the text inside {}", func(outer bool) func(v *documentView, e wicore.EditorW) { return bracketObject('{', '}', outer) }},
+		{"bracket", "the text inside []", func(outer bool) func(v *documentView, e wicore.EditorW) { return bracketObject('[', ']', outer) }},
+		{"double_quote", "the text inside \"\"", func(outer bool) func(v *documentView, e wicore.EditorW) { return quoteObject('"', outer) }},
+		{"paragraph", "the paragraph", paragraphObject},
+		{"paren", "the text inside ()", func(outer bool) func(v *documentView, e wicore.EditorW) { return bracketObject('(', ')', outer) }},
+		{"single_quote", "the text inside ''", func(outer bool) func(v *documentView, e wicore.EditorW) { return quoteObject('\'', outer) }},
+		{"word", "the word", func(outer bool) func(v *documentView, e wicore.EditorW) { return wordObject(false, outer) }},
+	}
+	for _, o := range objects {
+		cmds = append(cmds,
+			&wicore.MotionImpl{
+				"document_cursor_object_" + o.name + "_inner",
+				wicore.MotionExclusive,
+				true,
+				motionToDoc(o.handler(false)),
+				lang.Map{
+					lang.En: fmt.Sprintf("Selects %s", o.desc),
+				},
+				lang.Map{
+					lang.En: fmt.Sprintf("Selects %s around the cursor. It is a text object, meant to follow an operator or to be used in Visual mode.", o.desc),
+				},
+			},
+			&wicore.MotionImpl{
+				"document_cursor_object_" + o.name + "_outer",
+				wicore.MotionExclusive,
+				true,
+				motionToDoc(o.handler(true)),
+				lang.Map{
+					lang.En: fmt.Sprintf("Selects %s and its surroundings", o.desc),
+				},
+				lang.Map{
+					lang.En: fmt.Sprintf("Selects %s around the cursor, including the delimiters or the whitespace around it. It is a text object, meant to follow an operator or to be used in Visual mode.", o.desc),
+				},
+			})
+	}
+	return cmds
+}
@@ -0,0 +1,100 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestMotions(t *testing.T) {
+	data := []struct {
+		content string
+		keys    string
+		line    int
+		column  int
+	}{
+		{"foo.bar baz", "w", 0, 3},
+		{"foo.bar baz", "ww", 0, 4},
+		{"foo.bar baz", "W", 0, 8},
+		{"foo.bar baz", "3w", 0, 8},
+		{"foo\n\nbar", "w", 1, 0},
+		{"foo\n\nbar", "ww", 2, 0},
+		{"été, ça", "w", 0, 3},
+		{"été, ça", "e", 0, 2},
+		{"été, ça", "ee", 0, 3},
+		{"été, ça", "E", 0, 3},
+		{"foo bar", "$b", 0, 4},
+		{"foo bar", "$bb", 0, 0},
+		{"foo.bar baz", "$B", 0, 8},
+		{"  foo", "$0", 0, 0},
+		{"  foo", "^", 0, 2},
+		{"a\nb\nc\n", "G", 3, 0},
+		{"a\nb\nc\n", "2G", 1, 0},
+		{"a\n  b\nc\n", "Ggg", 0, 0},
+		{"a\n  b\nc\n", "2gg", 1, 2},
+		{"a\nb\n\nc\n\nd", "}", 2, 0},
+		{"a\nb\n\nc\n\nd", "2}", 4, 0},
+		{"a\nb\n\nc\n\nd", "3}", 5, 1},
+		{"a\nb\n\nc\n\nd", "G{", 4, 0},
+		{"One. Two! (Three.) Four", ")", 0, 5},
+		{"One. Two! (Three.) Four", "2)", 0, 10},
+		{"One. Two! (Three.) Four", "3)", 0, 19},
+		{"One. Two! (Three.) Four", "$(", 0, 19},
+		{"One. Two! (Three.) Four", "$((", 0, 10},
+		{"f(a[1], (b))", "%", 0, 11},
+		{"f(a[1], (b))", "%%", 0, 1},
+		{"f(a[1], (b))", "lll%", 0, 5},
+	}
+	for i, line := range data {
+		_, v := typeKeys(t, line.content, line.keys)
+		ut.AssertEqualIndex(t, i, cursor{line.line, line.column, line.column}, v.primary())
+	}
+}
+
+func TestMotionsWithOperators(t *testing.T) {
+	data := []struct {
+		content  string
+		keys     string
+		expected string
+	}{
+		{"foo bar baz", "dw", "bar baz"},
+		{"foo bar baz", "d2w", "baz"},
+		{"foo bar baz", "2dw", "baz"},
+		{"foo bar\nbaz", "wdw", "foo \nbaz"},
+		{"foo bar baz", "cwX\x1b", "X bar baz"},
+		{"foo bar baz", "de", " bar baz"},
+		{"foo bar baz", "wd$", "foo "},
+		{"foo bar baz", "$d0", "z"},
+		{"foo bar baz", "$db", "foo bar z"},
+		{"a\nb\nc\nd", "jdG", "a"},
+		{"a\nb\nc\nd", "Gdgg", ""},
+		{"a\nb\n\nc\n", "d}", "\nc\n"},
+		{"f(a, (b)) x", "ld%", "f x"},
+		{"foo bar baz", "wdiw", "foo  baz"},
+		{"foo bar baz", "wdaw", "foo baz"},
+		{"foo bar", "wdaw", "foo"},
+		{"foo.bar baz", "diW", " baz"},
+		{"a\nb\n\nc\n", "dip", "\nc\n"},
+		{"a\nb\n\nc\n", "dap", "c\n"},
+		{"x = \"hello world\";", "di\"", "x = \"\";"},
+		{"x = \"hello world\";", "da\"", "x =;"},
+		{"say 'hi' now", "ci'yo\x1b", "say 'yo' now"},
+		{"f(a, (b)) x", "lllldi(", "f() x"},
+		{"f(a, (b)) x", "6ldib", "f(a, ()) x"},
+		{"f(a, (b)) x", "6lda(", "f(a, ) x"},
+		{"f {\n  a\n}\n", "jdi{", "f {\n}\n"},
+		{"f {\n  a\n}\n", "jdaB", "f \n"},
+		{"<a>[b]", "di<", "<>[b]"},
+		{"<a>[b]", "$di[", "<a>[]"},
+		{"foo bar baz", "wviwd", "foo  baz"},
+		{"foo bar baz", "gUiw", "FOO bar baz"},
+	}
+	for i, line := range data {
+		_, v := typeKeys(t, line.content, line.keys)
+		ut.AssertEqualIndex(t, i, line.expected, v.document.content.String())
+	}
+}
@@ -0,0 +1,423 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Operators apply to the text a wicore.Motion moves over or to the selection,
+// like "d" in "dw". See key_parser.go for the grammar.
+
+package editor
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/lang"
+)
+
+// operatorCommand is a privileged command that keyParser treats as an
+// operator waiting for a motion. Its arguments are
+// <register> [motion [count]].
+type operatorCommand struct {
+	privilegedCommandImpl
+}
+
+// textRange is the text an operator applies to. A block has one span per
+// line.
+type textRange struct {
+	kind  selectionKind
+	spans [][2]int
+}
+
+// text returns the text of the range. The lines of a block are joined with
+// "\n".
+func (r *textRange) text(d *document) string {
+	parts := make([]string, len(r.spans))
+	for i, s := range r.spans {
+		parts[i] = string(d.content.Range(s[0], s[1]))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// lines returns the first and the last lines touched by the range.
+func (r *textRange) lines(d *document) (int, int) {
+	first := d.content.LineAt(r.spans[0][0])
+	s := r.spans[len(r.spans)-1]
+	if s[1] > s[0] {
+		// The line terminator belongs to the line it ends.
+		return first, d.content.LineAt(s[1] - 1)
+	}
+	return first, d.content.LineAt(s[1])
+}
+
+// operatorRange returns the text the operator applies to: the text moved over
+// by the motion, the text selected by a text object or the selection. Without
+// motion nor selection, it is the cursor line.
+func operatorRange(e *editor, w *window, v *documentView, args []string) (textRange, bool) {
+	d := v.document
+	if len(args) == 0 {
+		if v.selection.kind != noSelection {
+			r := textRange{v.selection.kind, v.selectionSpans()}
+			v.setSelection(e, noSelection)
+			return r, true
+		}
+		return textRange{lineSelection, [][2]int{{d.content.LineStart(v.cursorLine), d.content.LineStart(v.cursorLine + 1)}}}, true
+	}
+	motion, ok := wicore.GetCommand(e, w, args[0]).(wicore.Motion)
+	if !ok {
+		e.ExecuteCommand(w, "alert", notAMotion.Formatf(args[0]))
+		return textRange{}, false
+	}
+	v.setSelection(e, noSelection)
+	start := v.primary()
+	motion.Handle(e, w, args[1:]...)
+	if v.selection.kind != noSelection {
+		// A text object selected the text.
+		r := textRange{v.selection.kind, v.selectionSpans()}
+		v.setSelection(e, noSelection)
+		v.setPrimary(start)
+		return r, true
+	}
+	end := v.primary()
+	// The operator decides where the cursor ends up.
+	v.setPrimary(start)
+	if end.line < start.line || (end.line == start.line && end.column < start.column) {
+		start, end = end, start
+	}
+	switch motion.Kind() {
+	case wicore.MotionLinewise:
+		return textRange{lineSelection, [][2]int{{d.content.LineStart(start.line), d.content.LineStart(end.line + 1)}}}, true
+	case wicore.MotionInclusive:
+		hi := d.offset(end.line, end.column)
+		if end.column < d.lineLength(end.line) {
+			// The line terminator is not included.
+			hi = nextRuneEnd(d.content, hi)
+		}
+		return textRange{charSelection, [][2]int{{d.offset(start.line, start.column), hi}}}, true
+	default:
+		if args[0] == "document_cursor_word_next" || args[0] == "document_cursor_bigword_next" {
+			if end.line > start.line && end.column <= firstNonBlank(d, end.line) {
+				// Like in vim, the last word moved over at the end of a line stops
+				// there instead of at the next line.
+				end.line--
+				end.column = d.lineLength(end.line)
+			}
+		} else if end.line > start.line && end.column == 0 {
+			// Like in vim, an exclusive motion ending at the start of a line stops
+			// at the end of the previous line. It becomes linewise when it starts
+			// at the indentation.
+			end.line--
+			end.column = d.lineLength(end.line)
+			if start.column <= firstNonBlank(d, start.line) {
+				return textRange{lineSelection, [][2]int{{d.content.LineStart(start.line), d.content.LineStart(end.line + 1)}}}, true
+			}
+		}
+		lo, hi := d.offset(start.line, start.column), d.offset(end.line, end.column)
+		return textRange{charSelection, [][2]int{{lo, hi}}}, lo < hi
+	}
+}
+
+// deleteRange removes the text of a range. A last line without terminator
+// takes the terminator of the previous line with it.
+func (v *documentView) deleteRange(r textRange) {
+	d := v.document
+	if s := r.spans[0]; r.kind == lineSelection && s[1] == d.content.Len() && s[0] > 0 && s[1] > s[0] && d.content.Range(s[1]-1, s[1])[0] != '\n' {
+		r.spans = [][2]int{{s[0] - 1, s[1]}}
+	}
+	for i := len(r.spans) - 1; i >= 0; i-- {
+		d.delete(r.spans[i][0], r.spans[i][1])
+	}
+}
+
+// applyOperator runs an operator on the text range of its arguments.
+func applyOperator(c *privilegedCommandImpl, e *editor, w *window, args []string, op func(v *documentView, r textRange, name rune)) {
+	if len(args) == 0 || len(args) > 3 {
+		e.ExecuteCommand(w, "alert", c.LongDesc())
+		return
+	}
+	name, ok := registerArg(args[:1])
+	if !ok {
+		e.ExecuteCommand(w, "alert", invalidRegister.Formatf(args[0]))
+		return
+	}
+	v, ok := w.View().(*documentView)
+	if !ok {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	if v.document.loading {
+		// TODO(maruel): Beep.
+		return
+	}
+	// Only the primary cursor is used.
+	v.cursors = nil
+	if r, ok := operatorRange(e, w, v, args[1:]); ok {
+		op(v, r, name)
+	}
+	v.clampCursor()
+	v.cursorMoved(e)
+	if isVisualMode(e.KeyboardMode()) {
+		e.setKeyboardMode(wicore.Normal)
+	}
+	// TODO(maruel): Implement dirty instead.
+	e.TriggerTerminalResized()
+}
+
+// setCursorStart moves the cursor to the start of a range.
+func (v *documentView) setCursorStart(r textRange) {
+	line, col := v.document.position(r.spans[0][0])
+	v.setPrimary(cursor{line, col, col})
+}
+
+func cmdOperatorChange(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	if len(args) >= 2 && (args[1] == "document_cursor_word_next" || args[1] == "document_cursor_bigword_next") {
+		// Like in vim, "cw" changes up to the end of the word, not up to the next
+		// word.
+		count := 1
+		if len(args) == 3 {
+			count, _ = strconv.Atoi(args[2])
+		}
+		if v, ok := w.View().(*documentView); ok && !v.document.loading {
+			v.setSelection(e, noSelection)
+			if v.selectWordEnd(e, args[1] == "document_cursor_bigword_next", count) {
+				args = args[:1]
+			}
+		}
+	}
+	// The text of a block is typed at its left edge.
+	left := 0
+	if v, ok := w.View().(*documentView); ok && v.selection.kind == blockSelection {
+		left, _ = v.blockColumns()
+	}
+	op := func(v *documentView, r textRange, name rune) {
+		d := v.document
+		e.deleteRegister(name, register{r.text(d), r.kind})
+		if r.kind == lineSelection {
+			// An empty line is kept to type the new text.
+			if s := &r.spans[0]; s[1] > s[0] && d.content.Range(s[1]-1, s[1])[0] == '\n' {
+				s[1]--
+				if s[1] > s[0] && d.content.Range(s[1]-1, s[1])[0] == '\r' {
+					s[1]--
+				}
+			}
+		}
+		for i := len(r.spans) - 1; i >= 0; i-- {
+			d.delete(r.spans[i][0], r.spans[i][1])
+		}
+		v.setCursorStart(r)
+		if r.kind == blockSelection {
+			// The text is typed on every line of the block.
+			all := make([]cursor, len(r.spans))
+			for i := range all {
+				col := v.displayToColumn(v.cursorLine+i, left)
+				all[i] = cursor{v.cursorLine + i, col, col}
+			}
+			v.setAllCursors(e, all)
+		}
+		e.setKeyboardMode(wicore.Insert)
+	}
+	applyOperator(c, e, w, args, op)
+}
+
+func cmdOperatorDelete(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	op := func(v *documentView, r textRange, name rune) {
+		e.deleteRegister(name, register{r.text(v.document), r.kind})
+		line := v.document.content.LineAt(r.spans[0][0])
+		v.deleteRange(r)
+		if r.kind == lineSelection {
+			// The cursor goes to the line that replaces the deleted ones.
+			v.setPrimary(cursor{line, 0, 0})
+		} else {
+			v.setCursorStart(r)
+		}
+	}
+	applyOperator(c, e, w, args, op)
+}
+
+func cmdOperatorYank(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	op := func(v *documentView, r textRange, name rune) {
+		if !e.yankRegister(name, register{r.text(v.document), r.kind}) {
+			e.ExecuteCommand(w, "alert", readOnlyRegister.Formatf(args[0]))
+		}
+		if r.kind != lineSelection {
+			v.setCursorStart(r)
+		} else if first, _ := r.lines(v.document); first != v.cursorLine {
+			// Whole lines keep the cursor column, like in vim.
+			v.setPrimary(cursor{first, v.cursorColumnMax, v.cursorColumnMax})
+		}
+	}
+	applyOperator(c, e, w, args, op)
+}
+
+func cmdOperatorIndent(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	op := func(v *documentView, r textRange, name rune) {
+		d := v.document
+		first, last := r.lines(d)
+		for l := last; l >= first; l-- {
+			if d.lineLength(l) != 0 {
+				d.insert(d.content.LineStart(l), "\t")
+			}
+		}
+		v.setPrimary(cursor{first, 0, 0})
+	}
+	applyOperator(c, e, w, args, op)
+}
+
+func cmdOperatorDedent(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	op := func(v *documentView, r textRange, name rune) {
+		d := v.document
+		first, last := r.lines(d)
+		for l := last; l >= first; l-- {
+			line := d.line(l)
+			n := 0
+			if strings.HasPrefix(line, "\t") {
+				n = 1
+			} else {
+				for n < len(line) && n < 8 && line[n] == ' ' {
+					n++
+				}
+			}
+			start := d.content.LineStart(l)
+			d.delete(start, start+n)
+		}
+		v.setPrimary(cursor{first, 0, 0})
+	}
+	applyOperator(c, e, w, args, op)
+}
+
+// caseOperator returns an operator replacing the text with f(text).
+func caseOperator(f func(rune) rune) func(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	return func(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+		op := func(v *documentView, r textRange, name rune) {
+			d := v.document
+			for i := len(r.spans) - 1; i >= 0; i-- {
+				s := r.spans[i]
+				old := string(d.content.Range(s[0], s[1]))
+				if s := strings.Map(f, old); s != old {
+					d.delete(r.spans[i][0], r.spans[i][1])
+					d.insert(r.spans[i][0], s)
+				}
+			}
+			v.setCursorStart(r)
+		}
+		applyOperator(c, e, w, args, op)
+	}
+}
+
+// toggleCase returns the other case of a letter.
+func toggleCase(r rune) rune {
+	if unicode.IsUpper(r) {
+		return unicode.ToLower(r)
+	}
+	if unicode.IsLower(r) {
+		return unicode.ToUpper(r)
+	}
+	return r
+}
+
+// RegisterOperatorCommands registers the operators. They are usually run by
+// typing an operator key followed by a motion, like "dw".
+func RegisterOperatorCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&operatorCommand{privilegedCommandImpl{
+			"operator_case_lower",
+			-1,
+			caseOperator(unicode.ToLower),
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Converts text to lowercase",
+			},
+			lang.Map{
+				lang.En: "Usage: operator_case_lower <register> [motion [count]]\nConverts to lowercase the text moved over by the motion, the selection or the cursor line.",
+			},
+		}},
+		&operatorCommand{privilegedCommandImpl{
+			"operator_case_toggle",
+			-1,
+			caseOperator(toggleCase),
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Toggles the case of text",
+			},
+			lang.Map{
+				lang.En: "Usage: operator_case_toggle <register> [motion [count]]\nToggles the case of the text moved over by the motion, the selection or the cursor line.",
+			},
+		}},
+		&operatorCommand{privilegedCommandImpl{
+			"operator_case_upper",
+			-1,
+			caseOperator(unicode.ToUpper),
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Converts text to uppercase",
+			},
+			lang.Map{
+				lang.En: "Usage: operator_case_upper <register> [motion [count]]\nConverts to uppercase the text moved over by the motion, the selection or the cursor line.",
+			},
+		}},
+		&operatorCommand{privilegedCommandImpl{
+			"operator_change",
+			-1,
+			cmdOperatorChange,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Replaces text",
+			},
+			lang.Map{
+				lang.En: "Usage: operator_change <register> [motion [count]]\nDeletes the text moved over by the motion, the selection or the cursor line into a register and switches to Insert mode. Changing whole lines keeps an empty line; changing a block types the text on every line of the block.",
+			},
+		}},
+		&operatorCommand{privilegedCommandImpl{
+			"operator_dedent",
+			-1,
+			cmdOperatorDedent,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Removes one level of indentation",
+			},
+			lang.Map{
+				lang.En: "Usage: operator_dedent <register> [motion [count]]\nRemoves a tab, or up to 8 spaces, at the start of the lines moved over by the motion, of the selection or of the cursor line. The register is not used.",
+			},
+		}},
+		&operatorCommand{privilegedCommandImpl{
+			"operator_delete",
+			-1,
+			cmdOperatorDelete,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Deletes text",
+			},
+			lang.Map{
+				lang.En: "Usage: operator_delete <register> [motion [count]]\nDeletes the text moved over by the motion, the selection or the cursor line into a register. With the unnamed register \", the text goes into the register 1 and the previous deletes are shifted up to the register 9.",
+			},
+		}},
+		&operatorCommand{privilegedCommandImpl{
+			"operator_indent",
+			-1,
+			cmdOperatorIndent,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Adds one level of indentation",
+			},
+			lang.Map{
+				lang.En: "Usage: operator_indent <register> [motion [count]]\nInserts a tab at the start of the non-empty lines moved over by the motion, of the selection or of the cursor line. The register is not used.",
+			},
+		}},
+		&operatorCommand{privilegedCommandImpl{
+			"operator_yank",
+			-1,
+			cmdOperatorYank,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Copies text into a register",
+			},
+			lang.Map{
+				lang.En: "Usage: operator_yank <register> [motion [count]]\nCopies the text moved over by the motion, the selection or the cursor line into a register. With the unnamed register \", the text goes into the register 0.",
+			},
+		}},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// typeKeys types keys in a new document with content and returns the
+// documentView once the editor quit. "\x1b" is Escape, "\x16" is Ctrl-V, "\n"
+// is Enter and "\b" is Backspace.
+func typeKeys(t *testing.T, content, keys string) (*editor, *documentView) {
+	e, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	ed := e.(*editor)
+	var v *documentView
+	wicore.PostCommand(e, nil, "editor_bootstrap_ui")
+	wicore.PostCommand(e, func() {
+		v = ed.ActiveWindow().View().(*documentView)
+		v.document.reset(text.NewString(content))
+	}, "new")
+	// The keys are typed one at a time from the UI goroutine, each once the
+	// search or the macro started by the previous one, if any, is done.
+	rs := []rune(keys)
+	var next func()
+	next = func() {
+		if ed.search.cancel != nil || ed.macro.active {
+			wicore.PostCommand(e, next, "editor_redraw")
+			return
+		}
+		if len(rs) == 0 {
+			wicore.PostCommand(e, nil, "editor_quit", "force")
+			return
+		}
+		switch c := rs[0]; c {
+		case '\x1b':
+			ed.TriggerTerminalKeyPressed(key.Press{Key: key.Escape})
+		case '\x0f':
+			ed.TriggerTerminalMetaKeyPressed(key.Press{Ctrl: true, Ch: 'o'})
+		case '\x16':
+			ed.TriggerTerminalMetaKeyPressed(key.Press{Ctrl: true, Ch: 'v'})
+		case '\t':
+			ed.TriggerTerminalKeyPressed(key.Press{Key: key.Tab})
+		case ' ':
+			ed.TriggerTerminalKeyPressed(key.Press{Key: key.Space})
+		case '\n':
+			ed.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+		case '\b':
+			ed.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Backspace})
+		default:
+			ed.TriggerTerminalKeyPressed(key.Press{Ch: c})
+		}
+		rs = rs[1:]
+		wicore.PostCommand(e, next, "editor_redraw")
+	}
+	wicore.PostCommand(e, next, "editor_redraw")
+	ut.AssertEqual(t, 0, e.EventLoop())
+	_ = e.Close()
+	return ed, v
+}
+
+func TestOperators(t *testing.T) {
+	data := []struct {
+		content  string
+		keys     string
+		expected string
+		line     int
+		column   int
+	}{
+		{"a\nb\nc\nd\n", "dd", "b\nc\nd\n", 0, 0},
+		{"a\nb\nc\nd\n", "j2dd", "a\nd\n", 1, 0},
+		{"a\nb\nc\nd\n", "2dj", "d\n", 0, 0},
+		{"a\nb\nc\nd\n", "d3\x1bdd", "b\nc\nd\n", 0, 0},
+		// The last line has no terminator.
+		{"a\nb", "jdd", "a", 0, 0},
+		{"abcd", "ld2l", "ad", 0, 1},
+		{"abcd", "lld2h", "cd", 0, 0},
+		{"ab\ncd\n", "cc", "\ncd\n", 0, 0},
+		{"ab\ncd\n", "g~j", "AB\nCD\n", 0, 0},
+		{"ab\ncd\n", "gUU", "AB\ncd\n", 0, 0},
+		{"Ab\ncd\n", "vlu", "ab\ncd\n", 0, 0},
+		{"ab\n\ncd\n", ">2j", "\tab\n\n\tcd\n", 0, 0},
+		{"\tab\n    cd\n", "<j", "ab\ncd\n", 0, 0},
+		{"ab\ncd\nef\n", "l\x16jlx", "a\nc\nef\n", 0, 1},
+		{"ab\ncd\nef\n", "Vjd", "ef\n", 0, 0},
+	}
+	for i, line := range data {
+		_, v := typeKeys(t, line.content, line.keys)
+		ut.AssertEqualIndex(t, i, line.expected, v.document.content.String())
+		ut.AssertEqualIndex(t, i, cursor{line.line, line.column, line.column}, v.primary())
+	}
+}
+
+func TestOperatorRegisters(t *testing.T) {
+	e, v := typeKeys(t, "ab\ncd\n", "\"ayjdlp")
+	ut.AssertEqual(t, register{"ab\ncd\n", lineSelection}, e.registers['a'])
+	ut.AssertEqual(t, register{"a", charSelection}, e.registers['1'])
+	ut.AssertEqual(t, "ba\ncd\n", v.document.content.String())
+	ut.AssertEqual(t, wicore.Normal, e.KeyboardMode())
+}
+
+func TestLargeCount(t *testing.T) {
+	// Each repetition posts events to the UI goroutine, more than the event
+	// queue holds.
+	content := strings.Repeat(strings.Repeat("a", 3000)+"\n", 3000)
+	_, v := typeKeys(t, content, "1000x")
+	ut.AssertEqual(t, 2000, v.document.lineLength(0))
+	_, v = typeKeys(t, content, "yy500p")
+	ut.AssertEqual(t, 3501, v.document.lineCount())
+}
@@ -7,6 +7,7 @@ package editor
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/rpc"
@@ -18,6 +19,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/wi-ed/wi/internal"
 	"github.com/wi-ed/wi/wicore"
 	"github.com/wi-ed/wi/wicore/lang"
 )
@@ -32,6 +34,7 @@ type pluginProcess struct {
 	initialized bool                 // Initialized late after async call Init() completed.
 	err         error                // If set, the plugin had an error and is quarantined.
 	listener    wicore.EventListener
+	queries     io.ReadWriteCloser // Connection on which the plugin queries the editor, see editorRPC. nil if not supported.
 }
 
 func (p *pluginProcess) Close() error {
@@ -58,6 +61,10 @@ func (p *pluginProcess) Close() error {
 		}
 		p.client = nil
 	}
+	if p.queries != nil {
+		_ = p.queries.Close()
+		p.queries = nil
+	}
 	if p.proc != nil {
 		if err1 := p.proc.Kill(); err1 != nil {
 			err = err1
@@ -88,6 +95,18 @@ func (p *pluginProcess) Init(e wicore.Editor) {
 	// Make sure all plugins have their event registry properly registered
 	// before doing anything silly. This is purely a process-local setup.
 	p.listener = registerPluginEvents(p.client, e)
+	if ed, ok := e.(*editor); ok && p.queries != nil {
+		server := rpc.NewServer()
+		var obj internal.EditorRPC = &editorRPC{ed}
+		if err := server.RegisterName("EditorRPC", obj); err != nil {
+			log.Printf("%s: failed to serve the queries: %s", p, err)
+		} else {
+			conn := p.queries
+			wicore.Go("EditorRPC", func() {
+				server.ServeConn(conn)
+			})
+		}
+	}
 
 	out := 0
 	details := wicore.EditorDetails{
@@ -111,6 +130,36 @@ func (p *pluginProcess) Init(e wicore.Editor) {
 	})
 }
 
+// editorRPC implements internal.EditorRPC. The queries are answered in the UI
+// goroutine.
+type editorRPC struct {
+	e *editor
+}
+
+// run runs f in the UI goroutine and waits for it.
+func (r *editorRPC) run(f func()) {
+	done := make(chan struct{})
+	r.e.deferred <- func() {
+		f()
+		close(done)
+	}
+	<-done
+}
+
+func (r *editorRPC) RegisterContent(name string, out *string) error {
+	r.run(func() {
+		*out = r.e.RegisterContent(name)
+	})
+	return nil
+}
+
+func (r *editorRPC) SelectedText(ignored int, out *string) error {
+	r.run(func() {
+		*out = r.e.SelectedText()
+	})
+	return nil
+}
+
 // Plugins is the collection of Plugin instances, it represents all the live
 // plugin processes.
 type Plugins []wicore.Plugin
@@ -146,7 +195,36 @@ func loadPlugin(cmdLine []string) (wicore.Plugin, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err := cmd.Start(); err != nil {
+
+	// The plugin queries the editor on a second pair of pipes, passed as file
+	// descriptors 3 and 4. They can't be inherited on Windows.
+	var queries io.ReadWriteCloser
+	var childFiles []*os.File
+	if runtime.GOOS != "windows" {
+		reqR, reqW, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		respR, respW, err := os.Pipe()
+		if err != nil {
+			_ = reqR.Close()
+			_ = reqW.Close()
+			return nil, err
+		}
+		childFiles = []*os.File{reqW, respR}
+		cmd.ExtraFiles = childFiles
+		cmd.Env = append(cmd.Env, "WIRPC=1")
+		queries = wicore.MakeReadWriteCloser(reqR, respW)
+	}
+	err = cmd.Start()
+	// The child has its own copy.
+	for _, f := range childFiles {
+		_ = f.Close()
+	}
+	if err != nil {
+		if queries != nil {
+			_ = queries.Close()
+		}
 		return nil, err
 	}
 
@@ -191,6 +269,7 @@ func loadPlugin(cmdLine []string) (wicore.Plugin, error) {
 		false,
 		nil,
 		nil,
+		queries,
 	}
 	if err = p.client.Call("PluginRPC.GetInfo", lang.Active(), &p.details); err != nil {
 		return nil, err
@@ -0,0 +1,391 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Registers hold yanked and deleted text, like vim's registers. They are
+// global to the editor so text can be moved between documents.
+
+package editor
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/lang"
+)
+
+// registerNames lists the registers in the order shown by "registers".
+const registerNames = "\"0123456789abcdefghijklmnopqrstuvwxyz%:"
+
+// register is the content of a register. kind tells how the text is put back:
+// inside a line, as whole lines or as a block.
+type register struct {
+	text string
+	kind selectionKind
+}
+
+// makeRegister returns a register holding text, as whole lines if it ends with
+// a line terminator.
+func makeRegister(text string) register {
+	if strings.HasSuffix(text, "\n") {
+		return register{text, lineSelection}
+	}
+	return register{text, charSelection}
+}
+
+// isWritableRegister returns true for the unnamed register, the named
+// registers a to z and the numbered registers 0 to 9.
+func isWritableRegister(name rune) bool {
+	return name == '"' || (name >= 'a' && name <= 'z') || (name >= '0' && name <= '9')
+}
+
+// isRegisterName returns true if name is a register. A to Z append to the
+// registers a to z; "%" and ":" are read-only.
+func isRegisterName(name rune) bool {
+	return isWritableRegister(name) || (name >= 'A' && name <= 'Z') || name == '%' || name == ':'
+}
+
+// appendRegister returns the concatenation of two registers. If any of them
+// contains whole lines, the result is whole lines.
+func appendRegister(old, reg register) register {
+	if old.kind != lineSelection && reg.kind != lineSelection {
+		return register{old.text + reg.text, old.kind}
+	}
+	text := old.text
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	text += reg.text
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return register{text, lineSelection}
+}
+
+// register returns the content of a register.
+func (e *editor) register(name rune) (register, bool) {
+	switch {
+	case name == '%':
+		if d := activeDocument(e.ActiveWindow()); d != nil && d.filePath != "" {
+			return register{d.filePath, charSelection}, true
+		}
+		return register{}, false
+	case name == ':':
+		return register{e.lastCommand, charSelection}, e.lastCommand != ""
+	case name >= 'A' && name <= 'Z':
+		name += 'a' - 'A'
+	}
+	reg, ok := e.registers[name]
+	return reg, ok
+}
+
+// storeRegister sets the content of a register without notifying the plugins.
+// An uppercase letter appends to the register. Returns the register modified,
+// false if the register is read-only or invalid.
+func (e *editor) storeRegister(name rune, reg register) (rune, bool) {
+	if name >= 'A' && name <= 'Z' {
+		name += 'a' - 'A'
+		if old, ok := e.registers[name]; ok {
+			reg = appendRegister(old, reg)
+		}
+	} else if !isWritableRegister(name) {
+		return name, false
+	}
+	e.registers[name] = reg
+	return name, true
+}
+
+// setRegister sets the content of a register. An uppercase letter appends to
+// the register. Returns false if the register is read-only or invalid.
+func (e *editor) setRegister(name rune, reg register) bool {
+	name, ok := e.storeRegister(name, reg)
+	if ok {
+		e.TriggerEditorRegisterChanged(string(name))
+	}
+	return ok
+}
+
+// yankRegister stores yanked text in a register, "0 when the unnamed register
+// is used. The unnamed register always receives a copy.
+func (e *editor) yankRegister(name rune, reg register) bool {
+	if name == '"' {
+		name = '0'
+	}
+	name, ok := e.storeRegister(name, reg)
+	if !ok {
+		return false
+	}
+	e.registers['"'] = e.registers[name]
+	e.TriggerEditorRegisterChanged(string(name))
+	return true
+}
+
+// deleteRegister stores deleted text in a register. When the unnamed register
+// is used, the text goes in "1 and the previous deletes are shifted up to "9.
+// The unnamed register always receives a copy.
+func (e *editor) deleteRegister(name rune, reg register) bool {
+	if name == '"' {
+		for i := '9'; i > '1'; i-- {
+			if old, ok := e.registers[i-1]; ok {
+				e.registers[i] = old
+			}
+		}
+		name = '1'
+	}
+	name, ok := e.storeRegister(name, reg)
+	if !ok {
+		return false
+	}
+	e.registers['"'] = e.registers[name]
+	e.TriggerEditorRegisterChanged(string(name))
+	return true
+}
+
+// registerArg returns the register named by an optional argument, the
+// unnamed register by default.
+func registerArg(args []string) (rune, bool) {
+	if len(args) == 0 {
+		return '"', true
+	}
+	name, size := utf8.DecodeRuneInString(args[0])
+	return name, size == len(args[0]) && isRegisterName(name)
+}
+
+// put inserts the content of a register after or before the cursor. Whole
+// lines are put below or above the cursor line; a block is put on the
+// following lines at the display column of the cursor.
+func (v *documentView) put(e wicore.Editor, reg register, before bool) {
+	d := v.document
+	switch reg.kind {
+	case lineSelection:
+		text := reg.text
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		line := v.cursorLine
+		if !before {
+			line++
+		}
+		offset := d.content.LineStart(line)
+		if l := d.content.Len(); offset == l && l != 0 && d.content.Range(l-1, l)[0] != '\n' {
+			// The last line has no terminator.
+			text = "\n" + strings.TrimSuffix(text, "\n")
+		}
+		d.insert(offset, text)
+		v.setPrimary(cursor{line, 0, 0})
+		v.cursorMoved(e)
+	case blockSelection:
+		x := v.virtualColumn()
+		if runes := []rune(d.line(v.cursorLine)); !before && len(runes) != 0 {
+			if v.columnAdd() != 0 {
+				x++
+			} else {
+				x += cellWidth(runes, v.cursorColumn)
+			}
+		}
+		first := 0
+		for i, text := range strings.Split(reg.text, "\n") {
+			line := v.cursorLine + i
+			if line >= d.lineCount() {
+				d.insert(d.content.Len(), "\n")
+			}
+			// Short lines are padded with spaces.
+			col := d.padTo(line, x)
+			if i == 0 {
+				first = col
+			}
+			d.insert(d.offset(line, col), text)
+		}
+		v.setPrimary(cursor{v.cursorLine, first, first})
+		v.cursorMoved(e)
+	default:
+		offset := d.offset(v.cursorLine, v.cursorColumn)
+		if !before && v.cursorColumn < d.lineLength(v.cursorLine) {
+			offset = nextRuneEnd(d.content, offset)
+		}
+		d.insert(offset, reg.text)
+		// The cursor is left on the last rune put.
+		v.setCursorOffset(e, prevRuneStart(d.content, offset+len(reg.text)))
+	}
+	// TODO(maruel): Implement dirty instead.
+	e.TriggerTerminalResized()
+}
+
+// escapeRegister returns a one line preview of the content of a register.
+func escapeRegister(text string) string {
+	const maxLen = 60
+	text = strings.NewReplacer("\n", "^J", "\r", "^M", "\t", "^I").Replace(text)
+	if r := []rune(text); len(r) > maxLen {
+		text = string(r[:maxLen]) + "..."
+	}
+	return text
+}
+
+// Commands
+
+func cmdRegisterPut(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	registerPut(c, e, w, false, args)
+}
+
+func cmdRegisterPutBefore(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	registerPut(c, e, w, true, args)
+}
+
+func registerPut(c *privilegedCommandImpl, e *editor, w *window, before bool, args []string) {
+	if len(args) > 1 {
+		e.ExecuteCommand(w, "alert", c.LongDesc())
+		return
+	}
+	name, ok := registerArg(args)
+	if !ok {
+		e.ExecuteCommand(w, "alert", invalidRegister.Formatf(args[0]))
+		return
+	}
+	v, ok := w.View().(*documentView)
+	if !ok {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	if v.document.loading {
+		// TODO(maruel): Beep.
+		return
+	}
+	reg, ok := e.register(name)
+	if !ok {
+		e.ExecuteCommand(w, "alert", emptyRegister.Formatf(string(name)))
+		return
+	}
+	v.put(e, reg, before)
+}
+
+func cmdRegisterSet(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	if len(args) == 0 {
+		e.ExecuteCommand(w, "alert", c.LongDesc())
+		return
+	}
+	name, ok := registerArg(args[:1])
+	if !ok {
+		e.ExecuteCommand(w, "alert", invalidRegister.Formatf(args[0]))
+		return
+	}
+	if !e.setRegister(name, makeRegister(strings.Join(args[1:], " "))) {
+		e.ExecuteCommand(w, "alert", readOnlyRegister.Formatf(args[0]))
+	}
+}
+
+func cmdRegisterYank(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	if len(args) > 1 {
+		e.ExecuteCommand(w, "alert", c.LongDesc())
+		return
+	}
+	name, ok := registerArg(args)
+	if !ok {
+		e.ExecuteCommand(w, "alert", invalidRegister.Formatf(args[0]))
+		return
+	}
+	v, ok := w.View().(*documentView)
+	if !ok {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	var reg register
+	if v.selection.kind != noSelection {
+		reg = register{v.selectionText(), v.selection.kind}
+		// The cursor is left at the start of the yanked text.
+		start, _ := v.selectionBounds()
+		v.setPrimary(cursor{start.line, start.column, start.column})
+		v.setSelection(e, noSelection)
+		v.cursorMoved(e)
+	} else {
+		content := v.document.content
+		reg = register{string(content.Range(content.LineStart(v.cursorLine), content.LineStart(v.cursorLine+1))), lineSelection}
+	}
+	if !e.yankRegister(name, reg) {
+		e.ExecuteCommand(w, "alert", readOnlyRegister.Formatf(args[0]))
+	}
+	if isVisualMode(e.KeyboardMode()) {
+		e.setKeyboardMode(wicore.Normal)
+	}
+}
+
+func cmdRegisters(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	items := []string{}
+	for _, name := range registerNames {
+		if reg, ok := e.register(name); ok {
+			items = append(items, fmt.Sprintf("\"%c  %s", name, escapeRegister(reg.text)))
+		}
+	}
+	e.ExecuteCommand(w, "window_new", append([]string{"0", "floating", "list", registersTitle.String()}, items...)...)
+}
+
+// RegisterRegisterCommands registers the commands to yank and put text with
+// the registers.
+func RegisterRegisterCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"register_put",
+			-1,
+			cmdRegisterPut,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Puts the content of a register after the cursor",
+			},
+			lang.Map{
+				lang.En: "Usage: register_put [register]\nPuts the content of a register after the cursor, the unnamed register by default. Whole lines are put below the cursor line and a block is put at the cursor column of the following lines.",
+			},
+		},
+		&privilegedCommandImpl{
+			"register_put_before",
+			-1,
+			cmdRegisterPutBefore,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Puts the content of a register before the cursor",
+			},
+			lang.Map{
+				lang.En: "Usage: register_put_before [register]\nPuts the content of a register before the cursor, the unnamed register by default. Whole lines are put above the cursor line.",
+			},
+		},
+		&privilegedCommandImpl{
+			"register_set",
+			-1,
+			cmdRegisterSet,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Sets the content of a register",
+			},
+			lang.Map{
+				lang.En: "Usage: register_set <register> <text...>\nSets the content of a register; the arguments are joined with a space. An uppercase letter appends to the register. The text is put as whole lines if it ends with a line terminator. The plugins are notified of the register modifications with the EditorRegisterChanged event and read the registers with RegisterContent.",
+			},
+		},
+		&privilegedCommandImpl{
+			"register_yank",
+			-1,
+			cmdRegisterYank,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Copies the selection into a register",
+			},
+			lang.Map{
+				lang.En: "Usage: register_yank [register]\nCopies the selection, or the cursor line if there is no selection, into a register. The registers a to z are named, A to Z append to them. Without a register, the text goes into the register 0. The unnamed register \" always receives a copy. The registers 1 to 9 hold the last deleted texts, shifted on each deletion. % is the file name and : is the last command line; they are read-only.",
+			},
+		},
+		&privilegedCommandImpl{
+			"registers",
+			0,
+			cmdRegisters,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Lists the registers",
+			},
+			lang.Map{
+				lang.En: "Lists the registers that are not empty, with a preview of their content.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
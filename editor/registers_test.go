@@ -0,0 +1,114 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+func TestRegisters(t *testing.T) {
+	e, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	ed := e.(*editor)
+
+	ut.AssertEqual(t, true, ed.yankRegister('"', register{"foo", charSelection}))
+	ut.AssertEqual(t, register{"foo", charSelection}, ed.registers['0'])
+	ut.AssertEqual(t, register{"foo", charSelection}, ed.registers['"'])
+
+	ut.AssertEqual(t, true, ed.yankRegister('a', register{"bar", charSelection}))
+	ut.AssertEqual(t, true, ed.yankRegister('A', register{"baz", charSelection}))
+	reg, ok := ed.register('A')
+	ut.AssertEqual(t, true, ok)
+	ut.AssertEqual(t, register{"barbaz", charSelection}, reg)
+	ut.AssertEqual(t, reg, ed.registers['"'])
+	// Appending lines to characters gives lines.
+	ut.AssertEqual(t, true, ed.setRegister('A', register{"line\n", lineSelection}))
+	ut.AssertEqual(t, register{"barbaz\nline\n", lineSelection}, ed.registers['a'])
+
+	ut.AssertEqual(t, true, ed.deleteRegister('"', makeRegister("1")))
+	ut.AssertEqual(t, true, ed.deleteRegister('"', makeRegister("2\n")))
+	ut.AssertEqual(t, register{"2\n", lineSelection}, ed.registers['1'])
+	ut.AssertEqual(t, register{"1", charSelection}, ed.registers['2'])
+	ut.AssertEqual(t, register{"foo", charSelection}, ed.registers['0'])
+
+	ut.AssertEqual(t, false, ed.setRegister('%', makeRegister("x")))
+	ut.AssertEqual(t, false, ed.yankRegister(':', makeRegister("x")))
+	_, ok = ed.register(':')
+	ut.AssertEqual(t, false, ok)
+	ed.lastCommand = "document_save"
+	reg, _ = ed.register(':')
+	ut.AssertEqual(t, "document_save", reg.text)
+
+	name, ok := registerArg([]string{"é"})
+	ut.AssertEqual(t, false, ok)
+	name, ok = registerArg([]string{"Z"})
+	ut.AssertEqual(t, true, ok)
+	ut.AssertEqual(t, 'Z', name)
+}
+
+func TestRegisterPut(t *testing.T) {
+	e, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	doc := e.(*editor).newDocument("")
+	doc.reset(text.NewString("foo\nbar"))
+	v := &documentView{docView: docView{document: doc}}
+
+	v.put(e, register{"XY", charSelection}, false)
+	ut.AssertEqual(t, "fXYoo\nbar", doc.content.String())
+	ut.AssertEqual(t, cursor{0, 2, 2}, v.primary())
+	v.put(e, register{"Z", charSelection}, true)
+	ut.AssertEqual(t, "fXZYoo\nbar", doc.content.String())
+
+	// The last line has no terminator.
+	v.setPrimary(cursor{1, 1, 1})
+	v.put(e, register{"new\n", lineSelection}, false)
+	ut.AssertEqual(t, "fXZYoo\nbar\nnew", doc.content.String())
+	ut.AssertEqual(t, cursor{2, 0, 0}, v.primary())
+	v.put(e, register{"up", lineSelection}, true)
+	ut.AssertEqual(t, "fXZYoo\nbar\nup\nnew", doc.content.String())
+
+	// The block is padded past the end of the short lines and adds lines.
+	v.setPrimary(cursor{1, 2, 2})
+	v.put(e, register{"12\n34\n56", blockSelection}, false)
+	ut.AssertEqual(t, "fXZYoo\nbar12\nup 34\nnew56", doc.content.String())
+	v.setPrimary(cursor{3, 0, 0})
+	v.put(e, register{"a\nb", blockSelection}, true)
+	ut.AssertEqual(t, "fXZYoo\nbar12\nup 34\nanew56\nb", doc.content.String())
+}
+
+func TestRegisterChangedEvent(t *testing.T) {
+	e, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	ed := e.(*editor)
+	var names []string
+	e.RegisterEditorRegisterChanged(func(name string) {
+		names = append(names, name)
+	})
+	for i := 0; i < 10; i++ {
+		ed.deleteRegister('"', makeRegister("x"))
+	}
+	ed.yankRegister('"', makeRegister("y"))
+	ed.yankRegister('B', makeRegister("z"))
+	wicore.PostCommand(e, nil, "editor_quit")
+	ut.AssertEqual(t, 0, e.EventLoop())
+	// One event per operation; the content is queried.
+	ut.AssertEqual(t, []string{"1", "1", "1", "1", "1", "1", "1", "1", "1", "1", "0", "b"}, names)
+	ut.AssertEqual(t, "z", e.RegisterContent("\""))
+	ut.AssertEqual(t, "x", e.RegisterContent("9"))
+	ut.AssertEqual(t, "", e.RegisterContent("é"))
+}
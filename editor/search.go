@@ -0,0 +1,569 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Regexp search in the documents. The search runs in a background goroutine
+// on a snapshot of the document so the UI stays responsive on huge files.
+// The matches are searched line by line, like in vim.
+
+package editor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// maxSearchHistory is the number of patterns kept in the search history.
+const maxSearchHistory = 100
+
+// searchPattern is a compiled search pattern.
+type searchPattern struct {
+	text      string // Pattern as typed.
+	re        *regexp.Regexp
+	wholeWord bool // Only the matches that are whole words, for search_word.
+}
+
+// compileSearch compiles a pattern. With smartcase, a pattern without
+// uppercase letter ignores the case.
+func compileSearch(pattern string, wholeWord bool) (*searchPattern, error) {
+	expr := pattern
+	if !hasUpper(pattern) {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &searchPattern{pattern, re, wholeWord}, nil
+}
+
+// hasUpper returns true if pattern has an uppercase letter that is not part
+// of an escape sequence like \S.
+func hasUpper(pattern string) bool {
+	escaped := false
+	for _, r := range pattern {
+		if !escaped && unicode.IsUpper(r) {
+			return true
+		}
+		escaped = !escaped && r == '\\'
+	}
+	return false
+}
+
+// findAll returns the byte indexes [start, end) of the matches in a line.
+func (p *searchPattern) findAll(line string) [][]int {
+	matches := p.re.FindAllStringIndex(line, -1)
+	if !p.wholeWord {
+		return matches
+	}
+	out := matches[:0]
+	for _, m := range matches {
+		if isWholeWordString(line, m[0], m[1]) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// isWholeWordString returns true if line[start:end] is not surrounded by word
+// runes.
+func isWholeWordString(line string, start, end int) bool {
+	if r, _ := utf8.DecodeLastRuneInString(line[:start]); start > 0 && isWordRune(r) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(line[end:])
+	return end == len(line) || !isWordRune(r)
+}
+
+// findMatch returns the position of the first match after line and col, or
+// the last one before it when backward. The search wraps around the document.
+// It stops early when cancel is closed.
+func findMatch(content text.Buffer, p *searchPattern, line, col int, backward bool, cancel <-chan struct{}) (int, int, bool) {
+	lines := content.LineCount()
+	// The cursor line is visited twice: first for the matches after the cursor,
+	// then after wrapping around for the ones before it.
+	for i := 0; i <= lines; i++ {
+		if i%256 == 0 {
+			select {
+			case <-cancel:
+				return 0, 0, false
+			default:
+			}
+		}
+		l := line + i
+		if backward {
+			l = line - i
+		}
+		l = (l%lines + lines) % lines
+		s := strings.TrimSuffix(content.Line(l), "\r")
+		matches := p.findAll(s)
+		for j := range matches {
+			m := matches[j]
+			if backward {
+				m = matches[len(matches)-1-j]
+			}
+			c := utf8.RuneCountInString(s[:m[0]])
+			switch {
+			case i == 0 && !backward && c <= col:
+			case i == 0 && backward && c >= col:
+			case i == lines && !backward && c > col:
+			case i == lines && backward && c < col:
+			default:
+				return l, c, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// searchState is the state of the search, shared by all the documents like
+// in vim.
+type searchState struct {
+	last      *searchPattern // Last search, for search_next.
+	backward  bool           // The last search was backward.
+	highlight bool           // The matches of the last search are highlighted.
+	history   []string       // Patterns searched, the most recent last.
+	cancel    chan struct{}  // Closed to stop the running search.
+
+	// Incremental search, while the search window is open.
+	origin       cursor        // Cursor position when the search window was opened.
+	originView   *documentView // View to search in.
+	originWindow wicore.Window
+}
+
+// addHistory adds a pattern at the end of the search history.
+func (s *searchState) addHistory(pattern string) {
+	for i, h := range s.history {
+		if h == pattern {
+			s.history = append(s.history[:i], s.history[i+1:]...)
+			break
+		}
+	}
+	s.history = append(s.history, pattern)
+	if len(s.history) > maxSearchHistory {
+		s.history = s.history[len(s.history)-maxSearchHistory:]
+	}
+}
+
+// forEachDocumentView calls f for each documentView in the Window tree.
+func forEachDocumentView(w wicore.Window, f func(v *documentView)) {
+	if v, ok := w.View().(*documentView); ok {
+		f(v)
+	}
+	for _, c := range w.ChildrenWindows() {
+		forEachDocumentView(c, f)
+	}
+}
+
+// setHighlight sets the search pattern highlighted in all the documentViews,
+// nil to remove the highlighting.
+func (e *editor) setHighlight(p *searchPattern) {
+	forEachDocumentView(e.rootWindow, func(v *documentView) {
+		v.highlight = p
+	})
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+// searchAsync looks for a match from a position in a background goroutine
+// then moves the cursor there. A search started later cancels this one.
+// found, if not nil, is called before moving the cursor and notFound is called
+// if there is no match.
+func (e *editor) searchAsync(v *documentView, p *searchPattern, from cursor, backward bool, found, notFound func()) {
+	if e.search.cancel != nil {
+		close(e.search.cancel)
+	}
+	cancel := make(chan struct{})
+	e.search.cancel = cancel
+	content := v.document.snapshot()
+	wicore.Go("search", func() {
+		line, col, ok := findMatch(content, p, from.line, from.column, backward, cancel)
+		v.document.runInUI(e, func() {
+			select {
+			case <-cancel:
+				// Superseded by another search.
+				return
+			default:
+			}
+			e.search.cancel = nil
+			if v.document.content != content {
+				// Modified in the meantime.
+				return
+			}
+			if !ok {
+				notFound()
+				return
+			}
+			if found != nil {
+				found()
+			}
+			v.moveTo(e, cursor{line, col, col})
+			wicore.PostCommand(e, nil, "editor_redraw")
+		})
+	})
+}
+
+// startSearch runs a search from the cursor and makes it the last search.
+func (e *editor) startSearch(w wicore.Window, v *documentView, p *searchPattern, backward bool) {
+	e.search.last = p
+	e.search.backward = backward
+	e.search.highlight = true
+	e.setHighlight(p)
+	e.searchAsync(v, p, v.primary(), backward, func() {
+		recordJump(w, v)
+	}, func() {
+		e.ExecuteCommand(w, "alert", patternNotFound.Formatf(p.text))
+	})
+}
+
+// incrementalSearch moves the cursor to the first match of the pattern typed
+// so far in the search window. An invalid pattern, likely incomplete, is
+// ignored.
+func (e *editor) incrementalSearch(pattern string, backward bool) {
+	v := e.search.originView
+	if v == nil {
+		return
+	}
+	if pattern == "" {
+		w := e.search.originWindow
+		e.cancelIncrementalSearch()
+		e.search.originView = v
+		e.search.originWindow = w
+		return
+	}
+	p, err := compileSearch(pattern, false)
+	if err != nil {
+		return
+	}
+	e.setHighlight(p)
+	origin := e.search.origin
+	e.searchAsync(v, p, origin, backward, nil, func() {
+		v.moveTo(e, origin)
+		wicore.PostCommand(e, nil, "editor_redraw")
+	})
+}
+
+// cancelIncrementalSearch puts the cursor back where it was before the search
+// window was opened.
+func (e *editor) cancelIncrementalSearch() {
+	if e.search.cancel != nil {
+		close(e.search.cancel)
+		e.search.cancel = nil
+	}
+	if v := e.search.originView; v != nil {
+		v.moveTo(e, e.search.origin)
+	}
+	if e.search.highlight {
+		e.setHighlight(e.search.last)
+	} else {
+		e.setHighlight(nil)
+	}
+	e.search.originView = nil
+	e.search.originWindow = nil
+}
+
+// commitIncrementalSearch runs the search typed in the search window from the
+// original cursor position.
+func (e *editor) commitIncrementalSearch(pattern string, backward bool) {
+	v, w := e.search.originView, e.search.originWindow
+	if v == nil {
+		return
+	}
+	e.cancelIncrementalSearch()
+	cmdName := "search"
+	if backward {
+		cmdName = "search_backward"
+	}
+	if pattern == "" {
+		e.ExecuteCommand(w, cmdName)
+	} else {
+		e.ExecuteCommand(w, cmdName, pattern)
+	}
+}
+
+// drawMatches highlights the search matches in the visible lines.
+func (v *documentView) drawMatches() {
+	if v.highlight == nil {
+		return
+	}
+	var matches [][2]int
+	line := -1
+	for y, r := range v.rows {
+		if r.line != line {
+			// The matches are converted to display columns once per line.
+			line = r.line
+			s := v.document.line(line)
+			matches = matches[:0]
+			for _, m := range v.highlight.findAll(s) {
+				start := utf8.RuneCountInString(s[:m[0]])
+				end := start + utf8.RuneCountInString(s[m[0]:m[1]])
+				matches = append(matches, [2]int{displayColumn(r.runes, start), displayColumn(r.runes, end)})
+			}
+		}
+		for _, m := range matches {
+			v.paintCells(y, r, m[0], m[1], colors.Black, colors.BrightYellow)
+		}
+	}
+}
+
+// Commands
+
+// searchView returns the documentView of a Window.
+func searchView(e *editor, w *window) (*documentView, bool) {
+	v, ok := w.View().(*documentView)
+	if !ok {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+	}
+	return v, ok
+}
+
+func cmdSearch(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	searchCommand(e, w, false, args)
+}
+
+func cmdSearchBackward(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	searchCommand(e, w, true, args)
+}
+
+func searchCommand(e *editor, w *window, backward bool, args []string) {
+	v, ok := searchView(e, w)
+	if !ok {
+		return
+	}
+	p := e.search.last
+	if len(args) != 0 {
+		pattern := strings.Join(args, " ")
+		var err error
+		if p, err = compileSearch(pattern, false); err != nil {
+			e.ExecuteCommand(w, "alert", invalidPattern.Formatf(pattern, err))
+			return
+		}
+		e.search.addHistory(pattern)
+	} else if p == nil {
+		e.ExecuteCommand(w, "alert", noPreviousSearch.String())
+		return
+	}
+	e.startSearch(w, v, p, backward)
+}
+
+func cmdSearchClear(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	e.search.highlight = false
+	e.setHighlight(nil)
+}
+
+func cmdSearchHistory(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	items := []string{}
+	for i := len(e.search.history) - 1; i >= 0; i-- {
+		items = append(items, fmt.Sprintf("%3d  %s", len(e.search.history)-i, e.search.history[i]))
+	}
+	e.ExecuteCommand(w, "window_new", append([]string{"0", "floating", "list", searchHistoryTitle.String()}, items...)...)
+}
+
+func cmdSearchNext(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	searchNext(e, w, false)
+}
+
+func cmdSearchPrev(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	searchNext(e, w, true)
+}
+
+// searchNext repeats the last search, in the opposite direction if reverse.
+func searchNext(e *editor, w *window, reverse bool) {
+	v, ok := searchView(e, w)
+	if !ok {
+		return
+	}
+	if e.search.last == nil {
+		e.ExecuteCommand(w, "alert", noPreviousSearch.String())
+		return
+	}
+	backward := e.search.backward
+	e.startSearch(w, v, e.search.last, backward != reverse)
+	// search_prev doesn't change the direction of search_next.
+	e.search.backward = backward
+}
+
+func cmdSearchPrompt(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	searchPrompt(e, w, "/")
+}
+
+func cmdSearchPromptBackward(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	searchPrompt(e, w, "?")
+}
+
+// searchPrompt opens the command window to type a search pattern.
+func searchPrompt(e *editor, w *window, prompt string) {
+	v, ok := searchView(e, w)
+	if !ok {
+		return
+	}
+	e.search.origin = v.primary()
+	e.search.originView = v
+	e.search.originWindow = w
+	e.ExecuteCommand(w, "window_new", w.ID(), "floating", "command", prompt)
+}
+
+func cmdSearchWord(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	searchWord(e, w, false)
+}
+
+func cmdSearchWordBackward(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	searchWord(e, w, true)
+}
+
+// searchWord searches for the whole word under the cursor. The case is not
+// ignored.
+func searchWord(e *editor, w *window, backward bool) {
+	v, ok := searchView(e, w)
+	if !ok {
+		return
+	}
+	line := v.document.line(v.cursorLine)
+	start, end := wordAt(line, v.cursorColumn)
+	if start == end {
+		e.ExecuteCommand(w, "alert", noWordUnderCursor.String())
+		return
+	}
+	word := string([]rune(line)[start:end])
+	p := &searchPattern{word, regexp.MustCompile(regexp.QuoteMeta(word)), true}
+	e.search.addHistory(p.re.String())
+	// Searching from the start of the word skips it.
+	v.setPrimary(cursor{v.cursorLine, start, start})
+	e.startSearch(w, v, p, backward)
+}
+
+// RegisterSearchCommands registers the commands to search in the documents.
+func RegisterSearchCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"search",
+			-1,
+			cmdSearch,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Searches forward for a regexp",
+			},
+			lang.Map{
+				lang.En: "Usage: search [regexp...]\nMoves the cursor to the next match of a regexp, wrapping around the end of the document. The arguments are joined with a space; without argument, the last pattern is used. The case is ignored if the pattern has no uppercase letter. The matches are highlighted in all the documents until search_clear.",
+			},
+		},
+		&privilegedCommandImpl{
+			"search_backward",
+			-1,
+			cmdSearchBackward,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Searches backward for a regexp",
+			},
+			lang.Map{
+				lang.En: "Usage: search_backward [regexp...]\nMoves the cursor to the previous match of a regexp, wrapping around the start of the document. See search.",
+			},
+		},
+		&privilegedCommandImpl{
+			"search_clear",
+			0,
+			cmdSearchClear,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Removes the highlighting of the search matches",
+			},
+			lang.Map{
+				lang.En: "Removes the highlighting of the search matches until the next search.",
+			},
+		},
+		&privilegedCommandImpl{
+			"search_history",
+			0,
+			cmdSearchHistory,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Lists the previous searches",
+			},
+			lang.Map{
+				lang.En: "Lists the patterns searched, the most recent first. In the search window, Up and Down recall them.",
+			},
+		},
+		&privilegedCommandImpl{
+			"search_next",
+			0,
+			cmdSearchNext,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Repeats the last search",
+			},
+			lang.Map{
+				lang.En: "Moves the cursor to the next match of the last search, in the same direction.",
+			},
+		},
+		&privilegedCommandImpl{
+			"search_prev",
+			0,
+			cmdSearchPrev,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Repeats the last search in the opposite direction",
+			},
+			lang.Map{
+				lang.En: "Moves the cursor to the next match of the last search, in the opposite direction.",
+			},
+		},
+		&privilegedCommandImpl{
+			"search_prompt",
+			0,
+			cmdSearchPrompt,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Shows the search window",
+			},
+			lang.Map{
+				lang.En: "Shows the window to type a regexp to search forward. The cursor moves to the first match while typing. Enter runs the search and Escape puts the cursor back.",
+			},
+		},
+		&privilegedCommandImpl{
+			"search_prompt_backward",
+			0,
+			cmdSearchPromptBackward,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Shows the search window to search backward",
+			},
+			lang.Map{
+				lang.En: "Shows the window to type a regexp to search backward. See search_prompt.",
+			},
+		},
+		&privilegedCommandImpl{
+			"search_word",
+			0,
+			cmdSearchWord,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Searches forward for the word under the cursor",
+			},
+			lang.Map{
+				lang.En: "Moves the cursor to the next occurrence of the whole word under the cursor. The case is not ignored.",
+			},
+		},
+		&privilegedCommandImpl{
+			"search_word_backward",
+			0,
+			cmdSearchWordBackward,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Searches backward for the word under the cursor",
+			},
+			lang.Map{
+				lang.En: "Moves the cursor to the previous occurrence of the whole word under the cursor. The case is not ignored.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+func TestFindMatch(t *testing.T) {
+	content := text.NewString("foo bar\r\nbar été\nFOO foo\n")
+	data := []struct {
+		pattern  string
+		line     int
+		col      int
+		backward bool
+		found    bool
+		eLine    int
+		eCol     int
+	}{
+		{"bar", 0, 0, false, true, 0, 4},
+		{"bar", 0, 4, false, true, 1, 0},
+		{"bar", 1, 0, false, true, 0, 4},
+		{"bar", 0, 4, true, true, 1, 0},
+		{"bar", 1, 0, true, true, 0, 4},
+		{"foo", 2, 4, true, true, 2, 0},
+		{"FOO", 2, 4, false, true, 2, 0},
+		{"été", 0, 0, false, true, 1, 4},
+		{"bar$", 1, 0, false, true, 0, 4},
+		// The only match is under the cursor.
+		{"été", 1, 4, false, true, 1, 4},
+		{"\\S+ été", 0, 0, false, true, 1, 0},
+		{"baz", 0, 0, false, false, 0, 0},
+	}
+	for i, line := range data {
+		p, err := compileSearch(line.pattern, false)
+		ut.AssertEqualIndex(t, i, nil, err)
+		l, c, ok := findMatch(content, p, line.line, line.col, line.backward, nil)
+		ut.AssertEqualIndex(t, i, line.found, ok)
+		ut.AssertEqualIndex(t, i, line.eLine, l)
+		ut.AssertEqualIndex(t, i, line.eCol, c)
+	}
+
+	cancel := make(chan struct{})
+	close(cancel)
+	p, _ := compileSearch("foo", false)
+	_, _, ok := findMatch(content, p, 0, 0, false, cancel)
+	ut.AssertEqual(t, false, ok)
+}
+
+func TestSmartcase(t *testing.T) {
+	ut.AssertEqual(t, false, hasUpper("foo\\S"))
+	ut.AssertEqual(t, true, hasUpper("Foo"))
+	ut.AssertEqual(t, true, hasUpper("\\\\S"))
+	p, _ := compileSearch("été", false)
+	ut.AssertEqual(t, true, p.re.MatchString("ÉTÉ"))
+	p, _ = compileSearch("Été", false)
+	ut.AssertEqual(t, false, p.re.MatchString("été"))
+}
+
+func TestWholeWord(t *testing.T) {
+	p := &searchPattern{"é", nil, true}
+	p2, _ := compileSearch("é", false)
+	p.re = p2.re
+	ut.AssertEqual(t, [][]int{{6, 8}}, p.findAll("éé, é"))
+}
+
+func TestSearch(t *testing.T) {
+	data := []struct {
+		content string
+		keys    string
+		line    int
+		column  int
+	}{
+		{"foo\nbar\nfoo\n", "/foo\n", 2, 0},
+		{"foo\nbar\nfoo\n", "/foo\nn", 0, 0},
+		{"foo\nbar\nfoo\n", "/foo\nN", 0, 0},
+		{"foo\nbar\nfoo\n", "?bar\n", 1, 0},
+		{"foo\nbar\nfoo\n", "?bar\nn", 1, 0},
+		{"foo\nbar\nfoo\n", "/ax\br\n", 1, 1},
+		// Escape puts the cursor back.
+		{"foo\nbar\nfoo\n", "/bar\x1b", 0, 0},
+		// An empty pattern repeats the last search.
+		{"a b a b\n", "/b\n/\n", 0, 6},
+		{"foo foobar foo\n", "*", 0, 11},
+		{"foo foobar foo\n", "#", 0, 11},
+		{"foo foobar foo\n", "$#", 0, 0},
+	}
+	for i, line := range data {
+		_, v := typeKeys(t, line.content, line.keys)
+		ut.AssertEqualIndex(t, i, cursor{line.line, line.column, line.column}, v.primary())
+	}
+}
+
+func TestSearchHistory(t *testing.T) {
+	e, v := typeKeys(t, "foo\nbar\nfoo\n", "/bar\n/foo\n/bar\n/o\x1b")
+	ut.AssertEqual(t, []string{"foo", "bar"}, e.search.history)
+	ut.AssertEqual(t, "bar", e.search.last.text)
+	ut.AssertEqual(t, e.search.last, v.highlight)
+	ut.AssertEqual(t, cursor{1, 0, 0}, v.primary())
+}
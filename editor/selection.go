@@ -0,0 +1,302 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Selection in a documentView. The selection goes from an anchor to the
+// primary cursor, both included like in vim.
+
+package editor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+)
+
+// selectionKind is the shape of the selection.
+type selectionKind int
+
+const (
+	noSelection    selectionKind = iota
+	charSelection                // Follows the text from the anchor to the cursor.
+	lineSelection                // Whole lines from the anchor to the cursor.
+	blockSelection               // Rectangle with the anchor and the cursor as corners.
+)
+
+var selectionKindNames = []string{"none", "char", "line", "block"}
+
+func (s selectionKind) String() string {
+	if s < 0 || int(s) >= len(selectionKindNames) {
+		return fmt.Sprintf("selectionKind(%d)", int(s))
+	}
+	return selectionKindNames[s]
+}
+
+func stringToSelectionKind(s string) (selectionKind, bool) {
+	for i, n := range selectionKindNames {
+		if n == s {
+			return selectionKind(i), true
+		}
+	}
+	return noSelection, false
+}
+
+// selection is the selected part of a document, in document coordinates. The
+// other end is the primary cursor, so motions extend the selection.
+type selection struct {
+	kind   selectionKind
+	anchor cursor
+}
+
+// contains returns true if the rune at line and col is selected. start and end
+// are the values returned by selectionBounds(). The column past the end of a
+// line stands for the line terminator.
+func (s *selection) contains(start, end cursor, line, col int) bool {
+	if line < start.line || line > end.line {
+		return false
+	}
+	switch s.kind {
+	case charSelection:
+		return (line != start.line || col >= start.column) && (line != end.line || col <= end.column)
+	case lineSelection:
+		return true
+	case blockSelection:
+		return col >= start.column && col <= end.column
+	}
+	return false
+}
+
+// selectionBounds returns the first and the last selected positions. For a
+// block selection, the columns are the left and the right edges.
+func (v *documentView) selectionBounds() (cursor, cursor) {
+	start, end := v.selection.anchor, v.primary()
+	if v.selection.kind == blockSelection {
+		if start.line > end.line {
+			start.line, end.line = end.line, start.line
+		}
+		if start.column > end.column {
+			start.column, end.column = end.column, start.column
+		}
+		return start, end
+	}
+	if start.line > end.line || (start.line == end.line && start.column > end.column) {
+		start, end = end, start
+	}
+	return start, end
+}
+
+// blockColumns returns the display columns of the left and the right edges of
+// a block selection, both included. A tab at an edge is included as a whole,
+// unless the cursor is inside it.
+func (v *documentView) blockColumns() (int, int) {
+	a := v.selection.anchor
+	runes := []rune(v.document.line(a.line))
+	left := displayColumn(runes, a.column)
+	right := left + cellWidth(runes, a.column) - 1
+	x, w := v.virtualColumn(), 1
+	if v.columnAdd() == 0 {
+		w = cellWidth([]rune(v.document.line(v.cursorLine)), v.cursorColumn)
+	}
+	if x < left {
+		left = x
+	}
+	if x+w-1 > right {
+		right = x + w - 1
+	}
+	return left, right
+}
+
+// selectionSpans returns the byte ranges [start, end) of the selection. A block
+// selection has one range per line, covering the runes shown between its
+// edges.
+func (v *documentView) selectionSpans() [][2]int {
+	start, end := v.selectionBounds()
+	d := v.document
+	switch v.selection.kind {
+	case charSelection:
+		return [][2]int{{d.offset(start.line, start.column), nextRuneEnd(d.content, d.offset(end.line, end.column))}}
+	case lineSelection:
+		return [][2]int{{d.content.LineStart(start.line), d.content.LineStart(end.line + 1)}}
+	case blockSelection:
+		left, right := v.blockColumns()
+		spans := make([][2]int, 0, end.line-start.line+1)
+		for l := start.line; l <= end.line; l++ {
+			runes := []rune(d.line(l))
+			first, _ := columnAt(runes, left)
+			last, _ := columnAt(runes, right)
+			spans = append(spans, [2]int{d.offset(l, first), d.offset(l, last+1)})
+		}
+		return spans
+	}
+	return nil
+}
+
+// selectionText returns the selected text. The lines of a block selection are
+// joined with "\n".
+func (v *documentView) selectionText() string {
+	spans := v.selectionSpans()
+	parts := make([]string, len(spans))
+	for i, s := range spans {
+		parts[i] = string(v.document.content.Range(s[0], s[1]))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// selectionChanged triggers the event with the bounds of the selection. The
+// text is only computed when queried, see editor.SelectedText().
+func (v *documentView) selectionChanged(e wicore.Editor) {
+	if v.selection.kind == noSelection {
+		e.TriggerDocumentSelectionChanged(v.document, -1, -1, -1, -1)
+		return
+	}
+	start, end := v.selectionBounds()
+	e.TriggerDocumentSelectionChanged(v.document, start.column, start.line, end.column, end.line)
+}
+
+// setSelection changes the kind of the selection. When there was no
+// selection, it is anchored at the primary cursor.
+func (v *documentView) setSelection(e wicore.Editor, kind selectionKind) {
+	if v.selection.kind == kind {
+		return
+	}
+	if v.selection.kind == noSelection {
+		v.selection.anchor = v.primary()
+	}
+	if kind == noSelection {
+		// Kept for the '< and '> range addresses.
+		start, end := v.selectionBounds()
+		v.lastSelection = [2]cursor{start, end}
+		v.lastSelectionKind = v.selection.kind
+	}
+	v.selection.kind = kind
+	v.selectionChanged(e)
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+// onKeyboardModeChanged starts a selection of the corresponding kind when
+// entering a Visual mode and removes it when leaving the Visual modes.
+func (v *documentView) onKeyboardModeChanged(e wicore.Editor, mode wicore.KeyboardMode) {
+	switch mode {
+	case wicore.Visual:
+		v.setSelection(e, charSelection)
+	case wicore.VisualLine:
+		v.setSelection(e, lineSelection)
+	case wicore.VisualBlock:
+		v.setSelection(e, blockSelection)
+	default:
+		v.setSelection(e, noSelection)
+	}
+}
+
+// drawSelection highlights the visible part of the selection. Only the runes
+// and the line terminators are highlighted, not the space past the end of the
+// lines, except for a block in columnMode.
+func (v *documentView) drawSelection() {
+	if v.selection.kind == noSelection {
+		return
+	}
+	start, end := v.selectionBounds()
+	left, right := 0, 0
+	if v.selection.kind == blockSelection {
+		left, right = v.blockColumns()
+	}
+	for y, r := range v.rows {
+		if r.line < start.line || r.line > end.line {
+			continue
+		}
+		if v.selection.kind == blockSelection {
+			to := right + 1
+			if n := displayColumn(r.runes, len(r.runes)); to > n && !v.columnMode {
+				to = n
+			}
+			v.paintCells(y, r, left, to, colors.White, colors.Blue)
+			continue
+		}
+		x := displayColumn(r.runes, r.start)
+		for col := r.start; col <= len(r.runes) && (col < r.end || r.last) && r.pos(x) < v.buffer.Width; col++ {
+			w := 1
+			if col < len(r.runes) {
+				w = runeWidth(r.runes[col], x)
+			}
+			if v.selection.contains(start, end, r.line, col) {
+				v.paintCells(y, r, x, x+w, colors.White, colors.Blue)
+			}
+			x += w
+		}
+	}
+}
+
+func cmdSelectionStart(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+	v, ok := w.View().(*documentView)
+	if !ok {
+		e.ExecuteCommand(w, "alert", "Internal error")
+		return
+	}
+	kind, ok := stringToSelectionKind(args[0])
+	if !ok || kind == noSelection {
+		e.ExecuteCommand(w, "alert", invalidSelectionKind.Formatf(args[0]))
+		return
+	}
+	v.setSelection(e, kind)
+}
+
+func cmdSelectionExtend(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+	v, ok := w.View().(*documentView)
+	if !ok {
+		e.ExecuteCommand(w, "alert", "Internal error")
+		return
+	}
+	if len(args) == 0 {
+		e.ExecuteCommand(w, "alert", c.LongDesc())
+		return
+	}
+	if v.selection.kind == noSelection {
+		v.setSelection(e, charSelection)
+	}
+	e.ExecuteCommand(w, args[0], args[1:]...)
+}
+
+func cmdSelectionAll(v *documentView, e wicore.EditorW) {
+	last := v.document.lineCount() - 1
+	l := v.document.lineLength(last)
+	v.selection = selection{charSelection, cursor{}}
+	v.setPrimary(cursor{last, l, l})
+	v.cursorMoved(e)
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+func cmdSelectionClear(v *documentView, e wicore.EditorW) {
+	v.setSelection(e, noSelection)
+}
+
+func cmdSelectionSwapAnchor(v *documentView, e wicore.EditorW) {
+	if v.selection.kind == noSelection {
+		e.ExecuteCommand(nil, "alert", noSelectionActive.String())
+		return
+	}
+	anchor := v.selection.anchor
+	v.selection.anchor = v.primary()
+	v.setPrimary(anchor)
+	v.cursorMoved(e)
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+// cmdSelectionToCursors replaces the selection with a cursor on each of its
+// lines, at the display column of the primary cursor.
+func cmdSelectionToCursors(v *documentView, e wicore.EditorW) {
+	if v.selection.kind == noSelection {
+		e.ExecuteCommand(nil, "alert", noSelectionActive.String())
+		return
+	}
+	start, end := v.selectionBounds()
+	all := v.allCursors()
+	x := v.virtualColumn()
+	for l := start.line; l <= end.line; l++ {
+		col := v.displayToColumn(l, x)
+		all = append(all, cursor{l, col, col})
+	}
+	v.setSelection(e, noSelection)
+	v.setAllCursors(e, all)
+}
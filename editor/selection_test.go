@@ -0,0 +1,113 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+func TestSelection(t *testing.T) {
+	e, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	doc := e.(*editor).newDocument("")
+	doc.reset(text.NewString("été foo\nbar\nbazinga\n"))
+	v := &documentView{docView: docView{document: doc}}
+	ut.AssertEqual(t, "", v.selectionText())
+
+	v.setPrimary(cursor{0, 1, 1})
+	v.setSelection(e, charSelection)
+	ut.AssertEqual(t, "t", v.selectionText())
+	cmdDocumentCursorDown(v, e)
+	ut.AssertEqual(t, "té foo\nba", v.selectionText())
+	// The anchor is included when the cursor is before it.
+	v.setPrimary(cursor{0, 0, 0})
+	ut.AssertEqual(t, "ét", v.selectionText())
+	// The column past the end of the line selects the line terminator.
+	v.setPrimary(cursor{1, 3, 3})
+	ut.AssertEqual(t, "té foo\nbar\n", v.selectionText())
+
+	v.setSelection(e, lineSelection)
+	ut.AssertEqual(t, "été foo\nbar\n", v.selectionText())
+
+	v.setSelection(e, blockSelection)
+	v.setPrimary(cursor{2, 4, 4})
+	ut.AssertEqual(t, "té f\nar\nazin", v.selectionText())
+	start, end := v.selectionBounds()
+	ut.AssertEqual(t, true, v.selection.contains(start, end, 1, 2))
+	ut.AssertEqual(t, false, v.selection.contains(start, end, 1, 0))
+	ut.AssertEqual(t, false, v.selection.contains(start, end, 2, 5))
+
+	cmdSelectionSwapAnchor(v, e)
+	ut.AssertEqual(t, cursor{0, 1, 1}, v.primary())
+	ut.AssertEqual(t, "té f\nar\nazin", v.selectionText())
+
+	cmdSelectionToCursors(v, e)
+	ut.AssertEqual(t, noSelection, v.selection.kind)
+	ut.AssertEqual(t, []cursor{{1, 1, 1}, {2, 1, 1}}, v.cursors)
+	v.cursors = nil
+
+	cmdSelectionAll(v, e)
+	ut.AssertEqual(t, doc.content.String(), v.selectionText())
+	cmdSelectionClear(v, e)
+	ut.AssertEqual(t, "", v.selectionText())
+}
+
+func TestSelectionVisualModes(t *testing.T) {
+	e, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	doc := e.(*editor).newDocument("")
+	doc.reset(text.NewString("foo\nbar\n"))
+	v := &documentView{docView: docView{document: doc}}
+
+	v.setPrimary(cursor{0, 1, 1})
+	v.onKeyboardModeChanged(e, wicore.Visual)
+	cmdDocumentCursorDown(v, e)
+	ut.AssertEqual(t, "oo\nba", v.selectionText())
+	// Switching between the Visual modes keeps the anchor.
+	v.onKeyboardModeChanged(e, wicore.VisualBlock)
+	ut.AssertEqual(t, "o\na", v.selectionText())
+	v.onKeyboardModeChanged(e, wicore.VisualLine)
+	ut.AssertEqual(t, "foo\nbar\n", v.selectionText())
+	v.onKeyboardModeChanged(e, wicore.Normal)
+	ut.AssertEqual(t, noSelection, v.selection.kind)
+}
+
+func TestSelectionChangedEvent(t *testing.T) {
+	e, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = e.Close()
+	}()
+	var bounds [][4]int
+	e.RegisterDocumentSelectionChanged(func(doc wicore.Document, startCol, startRow, endCol, endRow int) {
+		bounds = append(bounds, [4]int{startCol, startRow, endCol, endRow})
+	})
+	selected := ""
+	wicore.PostCommand(e, nil, "editor_bootstrap_ui")
+	wicore.PostCommand(e, func() {
+		v := e.ActiveWindow().View().(*documentView)
+		v.document.reset(text.NewString("foo\nbar\n"))
+		v.setPrimary(cursor{0, 1, 1})
+		v.setSelection(e, charSelection)
+		cmdDocumentCursorDown(v, e)
+		selected = e.SelectedText()
+		v.setSelection(e, noSelection)
+		wicore.PostCommand(e, nil, "editor_quit", "force")
+	}, "new")
+	ut.AssertEqual(t, 0, e.EventLoop())
+	// The event only has the bounds, the text is queried.
+	ut.AssertEqual(t, "oo\nba", selected)
+	ut.AssertEqual(t, [][4]int{{1, 0, 1, 0}, {1, 0, 1, 1}, {-1, -1, -1, -1}}, bounds)
+}
@@ -12,18 +12,130 @@ var activateDisabled = lang.Map{
 	lang.En: "Can't activate a disabled view.",
 }
 
+var alreadyOpened = lang.Map{
+	lang.En: "\"%s\" is already opened in another document.",
+}
+
 var cantAddTwoWindowWithSameDocking = lang.Map{
 	lang.En: "Can't create two windows with the same docking \"%s\".",
 }
 
+var changedOnDisk = lang.Map{
+	lang.En: "\"%s\" was modified on disk but the document has unsaved changes.",
+}
+
+var changedOnDiskChoices = lang.Map{
+	lang.En: "k: keep the document, r: reload from disk, d: show the differences",
+}
+
+var changeListEnd = lang.Map{
+	lang.En: "At end of change list",
+}
+
+var changeListStart = lang.Map{
+	lang.En: "At start of change list",
+}
+
+var emptyRegister = lang.Map{
+	lang.En: "Register \"%s\" is empty",
+}
+
+var failedToConvert = lang.Map{
+	lang.En: "Can't convert to %s: %s",
+}
+
+var failedToOpen = lang.Map{
+	lang.En: "Failed to open \"%s\": %s",
+}
+
+var failedToRecover = lang.Map{
+	lang.En: "Failed to recover \"%s\": %s",
+}
+
+var failedToSave = lang.Map{
+	lang.En: "Failed to save \"%s\": %s",
+}
+
+var globalRecursive = lang.Map{
+	lang.En: "document_global can't be run by document_global",
+}
+
+var globalTitle = lang.Map{
+	lang.En: "Lines matching \"%s\"",
+}
+
+var invalidCount = lang.Map{
+	lang.En: "Invalid count \"%s\"",
+}
+
 var invalidDocking = lang.Map{
 	lang.En: "String \"%s\" does not refer to a valid Docking type.",
 }
 
+var invalidEncoding = lang.Map{
+	lang.En: "\"%s\" is not a supported encoding.",
+}
+
+var invalidGlobal = lang.Map{
+	lang.En: "Invalid expression \"%s\", expected /regexp/command",
+}
+
+var invalidHexPattern = lang.Map{
+	lang.En: "Invalid hex pattern \"%s\"",
+}
+
+var invalidLineEnding = lang.Map{
+	lang.En: "\"%s\" is not a valid line ending, use lf or crlf.",
+}
+
+var invalidMark = lang.Map{
+	lang.En: "Invalid mark \"%s\"",
+}
+
+var invalidNumber = lang.Map{
+	lang.En: "Invalid number \"%s\"",
+}
+
+var invalidOffset = lang.Map{
+	lang.En: "Invalid offset \"%s\"",
+}
+
+var invalidOption = lang.Map{
+	lang.En: "Invalid option: %s",
+}
+
+var invalidPattern = lang.Map{
+	lang.En: "Invalid pattern \"%s\": %s",
+}
+
+var invalidRange = lang.Map{
+	lang.En: "Invalid range \"%s\": %s",
+}
+
 var invalidRect = lang.Map{
 	lang.En: "\"%s, %s, %s, %s\" does not refer to a valid Rect.",
 }
 
+var invalidRegister = lang.Map{
+	lang.En: "Invalid register \"%s\"",
+}
+
+var invalidScannerKind = lang.Map{
+	lang.En: "Invalid scanner kind \"%s\", use content, shebang, name or modeline",
+}
+
+var invalidSelectionKind = lang.Map{
+	lang.En: "Invalid selection kind \"%s\", use char, line or block",
+}
+
+var invalidSize = lang.Map{
+	lang.En: "\"%s\" is not a valid size.",
+}
+
+var invalidSubstitute = lang.Map{
+	lang.En: "Invalid substitution \"%s\": %s",
+}
+
 var invalidViewFactory = lang.Map{
 	lang.En: "\"%s\" does not refer to a valid ViewFactory. Make sure the view factory was properly registered.",
 }
@@ -32,15 +144,144 @@ var isNotValidWindow = lang.Map{
 	lang.En: "ID \"%s\" does not refer to a valid window ID.",
 }
 
+var largeFile = lang.Map{
+	lang.En: "Large",
+}
+
+var loadingProgress = lang.Map{
+	lang.En: "%s... %d%%",
+}
+
+var macroRecording = lang.Map{
+	lang.En: "recording @%s",
+}
+
+var macroTooLong = lang.Map{
+	lang.En: "Macro too long, is it recursive?",
+}
+
+var markNotSet = lang.Map{
+	lang.En: "Mark not set: %s",
+}
+
+var marksHeader = lang.Map{
+	lang.En: "mark   line  col  text",
+}
+
+var marksTitle = lang.Map{
+	lang.En: "Marks",
+}
+
+var newestChange = lang.Map{
+	lang.En: "Already at newest change.",
+}
+
+var noFileName = lang.Map{
+	lang.En: "The document has no file name, use document_save_as.",
+}
+
+var noPreviousMacro = lang.Map{
+	lang.En: "No previous macro",
+}
+
+var noPreviousSearch = lang.Map{
+	lang.En: "No previous search",
+}
+
+var noPreviousSubstitute = lang.Map{
+	lang.En: "No previous substitution",
+}
+
+var noSelectionActive = lang.Map{
+	lang.En: "No selection",
+}
+
+var noSwapFile = lang.Map{
+	lang.En: "There is no swap file to recover \"%s\" from.",
+}
+
+var notADocument = lang.Map{
+	lang.En: "The active view is not a document.",
+}
+
+// notAMotion describes that a command can't follow an operator.
+var notAMotion = lang.Map{
+	lang.En: "\"%s\" is not a motion.",
+}
+
+var notForBinary = lang.Map{
+	lang.En: "Binary content has no line endings",
+}
+
 var notFound = lang.Map{
 	lang.En: "Command \"%s\" is not registered.",
 }
 
+var notInLargeFileMode = lang.Map{
+	lang.En: "This is disabled in large file mode.",
+}
+
 // notMapped describes that a key is not mapped to any command.
 var notMapped = lang.Map{
 	lang.En: "\"%s\" is not mapped to any command.",
 }
 
+var notRecording = lang.Map{
+	lang.En: "Not recording a macro",
+}
+
+var noWordUnderCursor = lang.Map{
+	lang.En: "No word under the cursor",
+}
+
+var oldestChange = lang.Map{
+	lang.En: "Already at oldest change.",
+}
+
+var patternNotFound = lang.Map{
+	lang.En: "Pattern not found: %s",
+}
+
+var readOnlyRegister = lang.Map{
+	lang.En: "Register \"%s\" is read-only",
+}
+
+var registersTitle = lang.Map{
+	lang.En: "Registers",
+}
+
+var searchHistoryTitle = lang.Map{
+	lang.En: "Search history",
+}
+
+var searchTimedOut = lang.Map{
+	lang.En: "Search timed out: %s",
+}
+
+var stillLoading = lang.Map{
+	lang.En: "The document is still loading.",
+}
+
+var substituteConfirm = lang.Map{
+	lang.En: "Replace with \"%s\"? (y/n/a/q)",
+}
+
+var substituteConfirmTitle = lang.Map{
+	lang.En: "Substitute",
+}
+
+var swapFound = lang.Map{
+	lang.En: "A swap file more recent than \"%s\" was found. It likely contains modifications lost in a crash.",
+}
+
+var swapFoundChoices = lang.Map{
+	lang.En: "(r)ecover, (d)iff, (x) delete the swap file, (i)gnore",
+}
+
+var undoListTitle = lang.Map{
+	lang.En: "Undo history of %s",
+}
+
 var viewDirty = lang.Map{
 	lang.En: "View \"%s\" is not saved, aborting quit.",
 }
@@ -0,0 +1,316 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Ex-style substitution, like ":%s/foo/bar/g". The matches are searched line
+// by line and all the replacements are applied at once, so a substitution is
+// a single undo step, even when each match is confirmed.
+
+package editor
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// substituteExpr is a parsed "/pattern/replacement/flags" expression.
+type substituteExpr struct {
+	re          *regexp.Regexp
+	replacement string // Go regexp template, with $1 for the first group.
+	global      bool   // g: Replaces all the matches of a line, not only the first one.
+	confirm     bool   // c: Asks before each replacement.
+}
+
+// parseSubstitute parses a substitution expression. The delimiter is the
+// first character, it can be escaped with a backslash in the pattern and the
+// replacement. An empty pattern is the last search pattern. In the
+// replacement, "\n" is a line break. The flags are g, i and c.
+func parseSubstitute(expr string, lastSearch *searchPattern) (*substituteExpr, error) {
+	delim := expr[0]
+	if delim == '\\' || delim == '"' || delim == '|' || delim == ' ' || isWordRune(rune(delim)) {
+		return nil, errors.New("invalid delimiter")
+	}
+	pattern := scanDelimited(expr[1:], delim)
+	rest := expr[1+len(pattern):]
+	replacement, flags := "", ""
+	if rest != "" {
+		replacement = scanDelimited(rest[1:], delim)
+		if rest = rest[1+len(replacement):]; rest != "" {
+			flags = rest[1:]
+		}
+	}
+	s := &substituteExpr{replacement: unescapeReplacement(replacement, delim)}
+	ignoreCase := false
+	for _, f := range flags {
+		switch f {
+		case 'g':
+			s.global = true
+		case 'i':
+			ignoreCase = true
+		case 'c':
+			s.confirm = true
+		default:
+			return nil, errors.New("invalid flag " + string(f))
+		}
+	}
+	if pattern == "" {
+		if lastSearch == nil {
+			return nil, errors.New(noPreviousSearch.String())
+		}
+		pattern = lastSearch.re.String()
+	} else {
+		pattern = unescapeDelimiter(pattern, delim)
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	var err error
+	s.re, err = regexp.Compile(pattern)
+	return s, err
+}
+
+// unescapeReplacement processes the escape sequences of a replacement.
+func unescapeReplacement(s string, delim byte) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'n':
+				out = append(out, '\n')
+				i++
+				continue
+			case 't':
+				out = append(out, '\t')
+				i++
+				continue
+			case '\\', delim:
+				out = append(out, s[i+1])
+				i++
+				continue
+			}
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
+
+// replacement is a match to replace, in byte offsets in the content.
+type replacement struct {
+	start int
+	end   int
+	text  string
+}
+
+// findReplacements returns the replacements of the matches in the lines of
+// the range.
+func (s *substituteExpr) findReplacements(d *document, r lineRange) []replacement {
+	var out []replacement
+	for l := r.start; l <= r.end; l++ {
+		line := d.line(l)
+		offset := d.content.LineStart(l)
+		for _, m := range s.re.FindAllStringSubmatchIndex(line, -1) {
+			text := string(s.re.ExpandString(nil, s.replacement, line, m))
+			out = append(out, replacement{offset + m[0], offset + m[1], text})
+			if !s.global {
+				break
+			}
+		}
+	}
+	return out
+}
+
+// applyReplacements applies the replacements, sorted by offset, and moves
+// the cursor to the first non-blank of the line of the last one.
+func (v *documentView) applyReplacements(e wicore.Editor, all []replacement) {
+	if len(all) == 0 {
+		return
+	}
+	d := v.document
+	shift := 0
+	for i := len(all) - 1; i >= 0; i-- {
+		r := all[i]
+		d.delete(r.start, r.end)
+		if r.text != "" {
+			d.insert(r.start, r.text)
+		}
+		if i != len(all)-1 {
+			shift += len(r.text) - (r.end - r.start)
+		}
+	}
+	line, _ := d.position(all[len(all)-1].start + shift)
+	col := firstNonBlank(d, line)
+	v.moveTo(e, cursor{line, col, col})
+	// TODO(maruel): Implement dirty instead.
+	e.TriggerTerminalResized()
+}
+
+// substitution is a substitution waiting for the confirmation of each match.
+type substitution struct {
+	v        *documentView
+	content  text.Buffer // Content when the matches were found.
+	pending  []replacement
+	accepted []replacement
+}
+
+// substituteState is the state of the substitutions, shared by all the
+// documents.
+type substituteState struct {
+	last    string        // Last expression, for a substitution without expression.
+	confirm *substitution // Substitution being confirmed, see substitute_confirm.
+}
+
+// showNext moves the cursor to the next match to confirm and shows the
+// confirmation Window. Applies the accepted replacements when done.
+func (s *substitution) showNext(e *editor) {
+	if len(s.pending) == 0 {
+		s.done(e)
+		return
+	}
+	line, col := s.v.document.position(s.pending[0].start)
+	s.v.moveTo(e, cursor{line, col, col})
+	e.ExecuteCommand(e.ActiveWindow(), "window_new", "0", "floating", "substitute_confirm", substituteConfirm.Formatf(s.pending[0].text))
+}
+
+// done applies the accepted replacements, unless the document was modified in
+// the meantime.
+func (s *substitution) done(e *editor) {
+	e.substitute.confirm = nil
+	if s.v.document.content != s.content {
+		return
+	}
+	s.v.applyReplacements(e, s.accepted)
+}
+
+func cmdDocumentSubstitute(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+	v, ok := w.View().(*documentView)
+	if !ok {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	if v.document.loading {
+		e.ExecuteCommand(w, "alert", stillLoading.String())
+		return
+	}
+	r, err := v.parseRange(args[0])
+	if err != nil {
+		e.ExecuteCommand(w, "alert", invalidRange.Formatf(args[0], err))
+		return
+	}
+	expr := args[1]
+	if expr == "" {
+		if expr = e.substitute.last; expr == "" {
+			e.ExecuteCommand(w, "alert", noPreviousSubstitute.String())
+			return
+		}
+	}
+	s, err := parseSubstitute(expr, e.search.last)
+	if err != nil {
+		e.ExecuteCommand(w, "alert", invalidSubstitute.Formatf(expr, err))
+		return
+	}
+	e.substitute.last = expr
+	all := s.findReplacements(v.document, r)
+	if len(all) == 0 {
+		e.ExecuteCommand(w, "alert", patternNotFound.Formatf(s.re.String()))
+		return
+	}
+	v.cursors = nil
+	if s.confirm {
+		e.substitute.confirm = &substitution{v, v.document.content, all, nil}
+		e.substitute.confirm.showNext(e)
+		return
+	}
+	v.applyReplacements(e, all)
+}
+
+// substituteConfirmViewFactory asks to confirm the next replacement of
+// e.substitute.confirm. args[0] is the question.
+func substituteConfirmViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	v := makeListView(id, substituteConfirmTitle.String(), args)
+	// answer closes the Window then processes the answer to the pending
+	// replacement.
+	answer := func(f func(s *substitution)) wicore.CommandImplHandler {
+		return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+			e.ExecuteCommand(w, "window_close", w.ID())
+			ed := e.(*editor)
+			if s := ed.substitute.confirm; s != nil {
+				f(s)
+				s.showNext(ed)
+			}
+		}
+	}
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"substitute_confirm_all",
+			0,
+			answer(func(s *substitution) {
+				s.accepted = append(s.accepted, s.pending...)
+				s.pending = nil
+			}),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Replaces this match and all the next ones",
+			},
+			lang.Map{
+				lang.En: "Replaces this match and all the remaining ones without asking.",
+			},
+		},
+		&wicore.CommandImpl{
+			"substitute_confirm_no",
+			0,
+			answer(func(s *substitution) {
+				s.pending = s.pending[1:]
+			}),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Skips this match",
+			},
+			lang.Map{
+				lang.En: "Skips this match and goes to the next one.",
+			},
+		},
+		&wicore.CommandImpl{
+			"substitute_confirm_quit",
+			0,
+			answer(func(s *substitution) {
+				s.pending = nil
+			}),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Stops the substitution",
+			},
+			lang.Map{
+				lang.En: "Skips this match and all the remaining ones. The matches already accepted are replaced.",
+			},
+		},
+		&wicore.CommandImpl{
+			"substitute_confirm_yes",
+			0,
+			answer(func(s *substitution) {
+				s.accepted = append(s.accepted, s.pending[0])
+				s.pending = s.pending[1:]
+			}),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Replaces this match",
+			},
+			lang.Map{
+				lang.En: "Replaces this match and goes to the next one.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		v.commands.Register(cmd)
+	}
+	v.keyBindings.Set(wicore.AllMode, key.Press{Key: key.Escape}, "substitute_confirm_quit")
+	v.keyBindings.Set(wicore.Normal, key.Press{Ch: 'a'}, "substitute_confirm_all")
+	v.keyBindings.Set(wicore.Normal, key.Press{Ch: 'n'}, "substitute_confirm_no")
+	v.keyBindings.Set(wicore.Normal, key.Press{Ch: 'q'}, "substitute_confirm_quit")
+	v.keyBindings.Set(wicore.Normal, key.Press{Ch: 'y'}, "substitute_confirm_yes")
+	return v
+}
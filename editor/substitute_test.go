@@ -0,0 +1,75 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestParseExCommand(t *testing.T) {
+	data := []struct {
+		line     string
+		expected []string
+	}{
+		{"s/a/b/", []string{"document_substitute", "", "/a/b/"}},
+		{"%s/a b/c/g", []string{"document_substitute", "%", "/a b/c/g"}},
+		{".,+5s#a#b#", []string{"document_substitute", ".,+5", "#a#b#"}},
+		{"'<,'>s/a/b/", []string{"document_substitute", "'<,'>", "/a/b/"}},
+		{"/f\\/o/,/bar/substitute/a/b/", []string{"document_substitute", "/f\\/o/,/bar/", "/a/b/"}},
+		{"s", []string{"document_substitute", "", ""}},
+		{"search foo", nil},
+		{"5", nil},
+	}
+	for i, line := range data {
+		args, ok := parseExCommand(line.line)
+		ut.AssertEqualIndex(t, i, line.expected != nil, ok)
+		ut.AssertEqualIndex(t, i, line.expected, args)
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	data := []struct {
+		content  string
+		keys     string
+		expected string
+		line     int
+		column   int
+	}{
+		{"foo\nfoo\n", ":s/o/0/\n", "f0o\nfoo\n", 0, 0},
+		{"foo\nfoo\n", ":%s/o/0/g\n", "f00\nf00\n", 1, 0},
+		{"foo\nfoo\n", ":%s/(f)(o+)/$2$1/\n", "oof\noof\n", 1, 0},
+		{"Foo\n", ":s/f/x/\n", "Foo\n", 0, 0},
+		{"Foo\n", ":s/f/x/i\n", "xoo\n", 0, 0},
+		{"a\na\na\na\n", "j:.,+1s/a/b/\n", "a\nb\nb\na\n", 2, 0},
+		{"a\na\na\na\n", "jVj\x1bgg:'<,'>s/a/b/\n", "a\nb\nb\na\n", 2, 0},
+		{"a\na\na\na\n", "jVj:s/a/b/\n", "a\nb\nb\na\n", 2, 0},
+		{"a\nfoo\na\nbxr\na\n", ":/foo/,/bxr/s/a/b/\n", "a\nfoo\nb\nbxr\na\n", 2, 0},
+		{"a\na\n", ":2;-1s/a/b/\n", "b\nb\n", 1, 0},
+		{"a/b\n", ":s/\\//-/\n", "a-b\n", 0, 0},
+		{"a,b\n", ":s/,/\\n  /\n", "a\n  b\n", 0, 0},
+		// An empty expression repeats the last substitution.
+		{"a a\na a\n", ":s/a/b/\nj:s\n", "b a\nb a\n", 1, 0},
+		// An empty pattern is the last search pattern.
+		{"a b\n", "/b\n:s//c/\n", "a c\n", 0, 0},
+		// A whole substitution is a single undo step.
+		{"a a\na a\n", ":%s/a/b/g\nu", "a a\na a\n", 1, 2},
+		{"a a a a\n", ":s/a/b/gc\nyna", "b a b b\n", 0, 0},
+		{"a a a a\n", ":s/a/b/gc\nyq", "b a a a\n", 0, 0},
+		{"a a a a\n", ":s/a/b/gc\nn\x1b", "a a a a\n", 0, 2},
+		{"a a a a\n", ":s/a/b/gc\nyyyyu", "a a a a\n", 0, 6},
+		// Errors.
+		{"a\n", ":s/x/b/\n", "a\n", 0, 0},
+		{"a\n", ":5s/a/b/\n", "a\n", 0, 0},
+		{"a\n", ":s/a/b/z\n", "a\n", 0, 0},
+		{"a\n", ":'<s/a/b/\n", "a\n", 0, 0},
+	}
+	for i, line := range data {
+		_, v := typeKeys(t, line.content, line.keys)
+		ut.AssertEqualIndex(t, i, line.expected, v.document.content.String())
+		ut.AssertEqualIndex(t, i, cursor{line.line, line.column, line.column}, v.primary())
+	}
+}
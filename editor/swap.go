@@ -0,0 +1,273 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Swap files journal the modifications of the documents, so they can be
+// recovered after a crash.
+
+package editor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// swapHeader starts every swap file.
+//
+// The header is followed by records, each starting with a line:
+//   - "b <encoding> <line ending> <length>" followed by the whole content. It
+//     is always the first record.
+//   - "i <offset> <length>" followed by the inserted bytes.
+//   - "d <start> <end>" to delete the bytes in [start, end).
+const swapHeader = "wi swap 1\n"
+
+// swapDirectory returns the directory where the swap files are kept, or "" if
+// it can't be determined.
+func swapDirectory() string {
+	state := os.Getenv("XDG_STATE_HOME")
+	if state == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return ""
+		}
+		state = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(state, "wi", "swap")
+}
+
+// swapPath returns the path of the swap file of a file.
+func swapPath(dir string, id fileIdentity) string {
+	r := strings.NewReplacer(string(os.PathSeparator), "%", "/", "%", ":", "%")
+	return filepath.Join(dir, r.Replace(id.path)+".swp")
+}
+
+// swapFile is the journal of a document. Records are written by a background
+// goroutine so the UI goroutine never waits on the disk.
+//
+// The writes are not flushed to disk, since the goal is to survive a crash of
+// the process, not of the OS.
+type swapFile struct {
+	path string
+	wake chan struct{}
+	done chan struct{} // Closed when the writer goroutine exits.
+
+	lock     sync.Mutex
+	content  text.Buffer // Content to write first, when truncate is set.
+	format   fileFormat  // Format of content.
+	truncate bool        // Truncate the file and write content before pending.
+	pending  []byte      // Records to append.
+	closed   bool
+	remove   bool // Delete the file instead of writing pending.
+
+	f *os.File // Only accessed by the writer goroutine.
+}
+
+func newSwapFile(path string) *swapFile {
+	s := &swapFile{path: path, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	wicore.Go("swapFile", s.loop)
+	return s
+}
+
+// checkpoint replaces the journal with the whole content. The content is
+// serialized by the writer goroutine.
+func (s *swapFile) checkpoint(content text.Buffer, format fileFormat) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.content = content
+	s.format = format
+	s.truncate = true
+	s.pending = nil
+	s.signal()
+}
+
+// insert journals the insertion of str at offset.
+func (s *swapFile) insert(offset int, str string) {
+	s.append(fmt.Sprintf("i %d %d\n%s", offset, len(str), str))
+}
+
+// delete journals the deletion of the bytes in [start, end).
+func (s *swapFile) delete(start, end int) {
+	s.append(fmt.Sprintf("d %d %d\n", start, end))
+}
+
+func (s *swapFile) append(record string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pending = append(s.pending, record...)
+	s.signal()
+}
+
+// signal wakes up the writer. s.lock must be held.
+func (s *swapFile) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops journaling and keeps the swap file, so the modifications can be
+// recovered. It waits for the pending records to be written.
+func (s *swapFile) Close() error {
+	s.stop(false)
+	return nil
+}
+
+// Remove stops journaling and deletes the swap file, once there is nothing
+// left to recover.
+func (s *swapFile) Remove() error {
+	s.stop(true)
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// stop makes the writer goroutine exit and waits for it.
+func (s *swapFile) stop(remove bool) {
+	s.lock.Lock()
+	if !s.closed {
+		s.closed = true
+		s.remove = remove
+		s.signal()
+	}
+	s.lock.Unlock()
+	<-s.done
+}
+
+func (s *swapFile) loop() {
+	defer close(s.done)
+	for range s.wake {
+		s.lock.Lock()
+		content, format, truncate, pending := s.content, s.format, s.truncate, s.pending
+		closed, remove := s.closed, s.remove
+		s.content = text.Buffer{}
+		s.truncate = false
+		s.pending = nil
+		s.lock.Unlock()
+		if !remove {
+			if err := s.write(content, format, truncate, pending); err != nil {
+				// There's not much to do, the document can still be saved.
+				log.Printf("Failed to write %s: %s", s.path, err)
+			}
+		}
+		if closed {
+			if s.f != nil {
+				_ = s.f.Close()
+				s.f = nil
+			}
+			return
+		}
+	}
+}
+
+// write appends the records to the file, after replacing its content with a
+// checkpoint of content if truncate is set.
+func (s *swapFile) write(content text.Buffer, format fileFormat, truncate bool, pending []byte) error {
+	if !truncate && len(pending) == 0 {
+		return nil
+	}
+	if s.f == nil {
+		if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		s.f = f
+	}
+	if truncate {
+		if err := s.f.Truncate(0); err != nil {
+			return err
+		}
+		w := bufio.NewWriter(s.f)
+		fmt.Fprintf(w, "%sb %s %s %d\n", swapHeader, format.encoding, format.lineEnding, content.Len())
+		if _, err := content.WriteTo(w); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	_, err := s.f.Write(pending)
+	return err
+}
+
+// errBadSwapFile is returned when a swap file can't be parsed.
+var errBadSwapFile = errors.New("invalid swap file")
+
+// readSwapFile replays the journal in a swap file and returns the content it
+// describes. A truncated last record, which happens if the process crashed
+// while writing it, is ignored.
+func readSwapFile(path string) (text.Buffer, fileFormat, error) {
+	var content text.Buffer
+	var format fileFormat
+	f, err := os.Open(path)
+	if err != nil {
+		return content, format, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	r := bufio.NewReader(f)
+	header := make([]byte, len(swapHeader))
+	if _, err := io.ReadFull(r, header); err != nil || string(header) != swapHeader {
+		return content, format, errBadSwapFile
+	}
+	for first := true; ; first = false {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return content, format, nil
+		}
+		if err != nil {
+			return content, format, err
+		}
+		var op byte
+		var a, b int
+		var enc, eol string
+		if first {
+			if _, err := fmt.Sscanf(line, "b %s %s %d\n", &enc, &eol, &a); err != nil {
+				return content, format, errBadSwapFile
+			}
+			op = 'b'
+		} else if _, err := fmt.Sscanf(line, "%c %d %d\n", &op, &a, &b); err != nil {
+			return content, format, errBadSwapFile
+		}
+		switch op {
+		case 'b':
+			var ok bool
+			if format.encoding, ok = stringToEncoding(enc); !ok {
+				return content, format, errBadSwapFile
+			}
+			if format.lineEnding, ok = nameToLineEnding(eol); !ok {
+				return content, format, errBadSwapFile
+			}
+			data := make([]byte, a)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return content, format, errBadSwapFile
+			}
+			content = text.New(data)
+		case 'i':
+			data := make([]byte, b)
+			if _, err := io.ReadFull(r, data); err != nil {
+				// Truncated record.
+				return content, format, nil
+			}
+			content = content.Insert(a, data)
+		case 'd':
+			content = content.Delete(a, b)
+		default:
+			return content, format, errBadSwapFile
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+func TestReadSwapFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(dir)
+	data := []struct {
+		in       string
+		expected string
+		format   fileFormat
+		err      error
+	}{
+		{"wi swap 1\nb utf-8 LF 6\nhello\n", "hello\n", fileFormat{utf8Encoding, lfEnding}, nil},
+		{"wi swap 1\nb latin1 CRLF 6\nhello\ni 5 3\n, x", "hello, x\n", fileFormat{latin1Encoding, crlfEnding}, nil},
+		{"wi swap 1\nb utf-8 Mixed 6\nhello\nd 0 2\ni 0 1\nH", "Hllo\n", fileFormat{utf8Encoding, mixedEnding}, nil},
+		// The last record is truncated by a crash.
+		{"wi swap 1\nb utf-8 LF 6\nhello\ni 0 5\nab", "hello\n", fileFormat{utf8Encoding, lfEnding}, nil},
+		{"wi swap 1\ni 0 5\nhello", "", fileFormat{}, errBadSwapFile},
+		{"vi swap 1\n", "", fileFormat{}, errBadSwapFile},
+	}
+	p := filepath.Join(dir, "a.swp")
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, nil, ioutil.WriteFile(p, []byte(line.in), 0600))
+		content, format, err := readSwapFile(p)
+		ut.AssertEqualIndex(t, i, line.err, err)
+		if err == nil {
+			ut.AssertEqualIndex(t, i, line.expected, content.String())
+			ut.AssertEqualIndex(t, i, line.format, format)
+		}
+	}
+}
+
+func TestSwapFileClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "a.swp")
+	format := fileFormat{utf8Encoding, lfEnding}
+
+	// Closing keeps the swap file with all the records.
+	s := newSwapFile(p)
+	s.checkpoint(text.NewString("hello\n"), format)
+	s.insert(5, ", x")
+	ut.AssertEqual(t, nil, s.Close())
+	content, f, err := readSwapFile(p)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "hello, x\n", content.String())
+	ut.AssertEqual(t, format, f)
+
+	// Removing deletes it.
+	s = newSwapFile(p)
+	s.checkpoint(text.NewString("a\n"), format)
+	ut.AssertEqual(t, nil, s.Remove())
+	_, err = os.Stat(p)
+	ut.AssertEqual(t, true, os.IsNotExist(err))
+}
@@ -0,0 +1,138 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+// undoState is a node in the undo tree. It is the state of the document after
+// a group of edits.
+//
+// Each state holds a snapshot of the whole content. Since text.Buffer is an
+// immutable rope, the snapshots share all the unmodified parts so this is
+// much cheaper than it looks.
+type undoState struct {
+	parent   *undoState
+	children []*undoState
+	redo     *undoState  // Child to follow on redo, the most recently visited one.
+	content  text.Buffer // Content after the edits.
+	offset   int         // Byte offset of the first edit, used to restore the cursor.
+	seq      int         // Change number, in creation order. The root is 0.
+	depth    int         // Number of changes from the root.
+	when     time.Time
+}
+
+// undoTree is the branching history of a document, like vim's undo tree.
+// Undoing then doing a new edit creates a new branch instead of losing the
+// undone changes.
+//
+// Edits are merged in the current state until the group is sealed. The editor
+// seals the groups after each command batch and when leaving Insert mode, so
+// a whole insert session is undone at once.
+type undoTree struct {
+	root    *undoState
+	current *undoState
+	open    bool // true if new edits are merged into current.
+	lastSeq int
+}
+
+func makeUndoTree(content text.Buffer) undoTree {
+	root := &undoState{content: content, when: time.Now()}
+	return undoTree{root: root, current: root}
+}
+
+// record records content as the result of an edit at offset.
+func (u *undoTree) record(content text.Buffer, offset int) {
+	if u.open {
+		u.current.content = content
+		u.current.when = time.Now()
+		return
+	}
+	u.lastSeq++
+	s := &undoState{
+		parent:  u.current,
+		content: content,
+		offset:  offset,
+		seq:     u.lastSeq,
+		depth:   u.current.depth + 1,
+		when:    time.Now(),
+	}
+	u.current.children = append(u.current.children, s)
+	u.current.redo = s
+	u.current = s
+	u.open = true
+}
+
+// seal closes the current group of edits. The next edit creates a new state.
+func (u *undoTree) seal() {
+	u.open = false
+}
+
+// undo moves to the parent state. It returns the content to restore and the
+// offset of the undone change.
+func (u *undoTree) undo() (text.Buffer, int, bool) {
+	u.seal()
+	s := u.current
+	if s.parent == nil {
+		return text.Buffer{}, 0, false
+	}
+	s.parent.redo = s
+	u.current = s.parent
+	return u.current.content, s.offset, true
+}
+
+// redo moves to the most recently visited child state. It returns the content
+// to restore and the offset of the redone change.
+func (u *undoTree) redo() (text.Buffer, int, bool) {
+	u.seal()
+	if u.current.redo == nil {
+		return text.Buffer{}, 0, false
+	}
+	u.current = u.current.redo
+	return u.current.content, u.current.offset, true
+}
+
+// list returns a description of each branch of the tree, like vim's
+// :undolist. The current state is marked with a '>'.
+func (u *undoTree) list() []string {
+	leaves := []*undoState{}
+	var walk func(s *undoState)
+	walk = func(s *undoState) {
+		if len(s.children) == 0 && s != u.root {
+			leaves = append(leaves, s)
+		}
+		for _, c := range s.children {
+			walk(c)
+		}
+	}
+	walk(u.root)
+	sort.Sort(undoStatesBySeq(leaves))
+
+	out := make([]string, 0, len(leaves)+1)
+	out = append(out, fmt.Sprintf("  %-7s %-7s %s", "number", "changes", "when"))
+	for _, s := range leaves {
+		marker := ' '
+		if s == u.current {
+			marker = '>'
+		}
+		out = append(out, fmt.Sprintf("%c %-7d %-7d %s", marker, s.seq, s.depth, s.when.Format("15:04:05")))
+	}
+	if u.current.children != nil || u.current == u.root {
+		// The current state is not a leaf; make it visible anyway.
+		out = append(out, fmt.Sprintf("> %-7d %-7d %s", u.current.seq, u.current.depth, u.current.when.Format("15:04:05")))
+	}
+	return out
+}
+
+type undoStatesBySeq []*undoState
+
+func (u undoStatesBySeq) Len() int           { return len(u) }
+func (u undoStatesBySeq) Less(i, j int) bool { return u[i].seq < u[j].seq }
+func (u undoStatesBySeq) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
@@ -0,0 +1,56 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore/text"
+)
+
+func TestUndoTree(t *testing.T) {
+	d := makeDocument(1)
+	d.reset(text.NewString("hello"))
+	ut.AssertEqual(t, false, d.IsDirty())
+
+	// Two edits in the same group are undone at once.
+	d.insert(5, " world")
+	d.insert(11, "!")
+	d.history.seal()
+	d.delete(0, 1)
+	d.history.seal()
+	ut.AssertEqual(t, "ello world!", d.content.String())
+
+	offset, ok := d.undo()
+	ut.AssertEqual(t, true, ok)
+	ut.AssertEqual(t, 0, offset)
+	ut.AssertEqual(t, "hello world!", d.content.String())
+	offset, ok = d.undo()
+	ut.AssertEqual(t, true, ok)
+	ut.AssertEqual(t, 5, offset)
+	ut.AssertEqual(t, "hello", d.content.String())
+	ut.AssertEqual(t, false, d.IsDirty())
+	_, ok = d.undo()
+	ut.AssertEqual(t, false, ok)
+
+	// Editing after undo creates a new branch; redo follows it.
+	d.redo()
+	d.insert(0, ">")
+	d.history.seal()
+	ut.AssertEqual(t, ">hello world!", d.content.String())
+	d.undo()
+	d.redo()
+	ut.AssertEqual(t, ">hello world!", d.content.String())
+	_, ok = d.redo()
+	ut.AssertEqual(t, false, ok)
+
+	// The old branch is still reachable.
+	d.undo()
+	d.history.current.redo = d.history.current.children[0]
+	d.redo()
+	ut.AssertEqual(t, "ello world!", d.content.String())
+	ut.AssertEqual(t, 3, len(d.history.list()))
+}
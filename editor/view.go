@@ -12,6 +12,8 @@ import (
 
 	"github.com/wi-ed/wi/wicore"
 	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
 	"github.com/wi-ed/wi/wicore/raster"
 )
 
@@ -155,6 +157,7 @@ func statusRootViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW
 				[][]string{
 					{"window_new", id, "left", "status_active_window_name"},
 					{"window_new", id, "right", "status_position"},
+					{"window_new", id, "right", "status_document"},
 					{"window_new", id, "fill", "status_mode"},
 				},
 				nil,
@@ -172,8 +175,9 @@ func statusActiveWindowNameViewFactory(e wicore.Editor, id int, args ...string)
 }
 
 func statusModeViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
-	// Mostly for testing purpose, will contain the current mode "Insert" or "Command".
-	v := makeStaticDisabledView(e, id, e.KeyboardMode().String(), 10, 1)
+	// Mostly for testing purpose, will contain the current mode, like "Insert"
+	// or "VisualBlock".
+	v := makeStaticDisabledView(e, id, e.KeyboardMode().String(), 11, 1)
 	v.defaultFormat = raster.CellFormat{}
 	event := e.RegisterEditorKeyboardModeChanged(func(mode wicore.KeyboardMode) {
 		v.title = mode.String()
@@ -182,6 +186,32 @@ func statusModeViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW
 	return v
 }
 
+// statusDocumentView shows the properties of the active document, like its
+// encoding.
+type statusDocumentView struct {
+	staticDisabledView
+	e wicore.Editor
+}
+
+func (v *statusDocumentView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{' ', v.DefaultFormat()})
+	status := ""
+	if doc := activeDocument(v.e.ActiveWindow()); doc != nil {
+		status = doc.status()
+	}
+	if ed, ok := v.e.(*editor); ok && ed.macro.recording != 0 {
+		status = macroRecording.Formatf(string(ed.macro.recording)) + " " + status
+	}
+	v.buffer.DrawString(status, 0, 0, v.DefaultFormat())
+	return v.buffer
+}
+
+func statusDocumentViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	v := &statusDocumentView{*makeStaticDisabledView(e, id, "Status Document", 24, 1), e}
+	v.defaultFormat = raster.CellFormat{}
+	return v
+}
+
 func statusPositionViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
 	// Position, % of file.
 	// TODO(maruel): Register events of movement, make itself Invalidate().
@@ -208,22 +238,125 @@ func infobarAlertViewFactory(e wicore.Editor, id int, args ...string) wicore.Vie
 	return v
 }
 
+// listView is a read-only View showing lines of text, like the undo
+// history. It is meant to be shown in a floating Window and is dismissed with
+// Escape or 'q'.
+type listView struct {
+	view
+	lines []string
+}
+
+func (v *listView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{' ', v.DefaultFormat()})
+	for i, l := range v.lines {
+		v.buffer.DrawString(l, 0, i, v.DefaultFormat())
+	}
+	return v.buffer
+}
+
+func cmdListClose(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+	e.ExecuteCommand(w, "window_close", w.ID())
+}
+
+// makeListView creates a listView showing lines. More commands and key
+// bindings can be added to it.
+func makeListView(id int, title string, lines []string) *listView {
+	width := 1
+	for _, l := range lines {
+		if n := utf8.RuneCountInString(l); n > width {
+			width = n
+		}
+	}
+	height := len(lines)
+	if height == 0 {
+		height = 1
+	}
+	dispatcher := makeCommands()
+	dispatcher.Register(&wicore.CommandImpl{
+		"list_close",
+		0,
+		cmdListClose,
+		wicore.WindowCategory,
+		lang.Map{
+			lang.En: "Closes the list",
+		},
+		lang.Map{
+			lang.En: "Closes the list and its Window.",
+		},
+	})
+	bindings := makeKeyBindings()
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Escape}, "list_close")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'q'}, "list_close")
+	return &listView{
+		view{
+			commands:      dispatcher,
+			keyBindings:   bindings,
+			id:            id,
+			title:         title,
+			naturalX:      width,
+			naturalY:      height,
+			defaultFormat: raster.CellFormat{Fg: colors.White, Bg: colors.Black},
+		},
+		lines,
+	}
+}
+
+// listViewFactory creates a listView. args[0] is the title, the remaining
+// arguments are the lines to show.
+func listViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	if len(args) == 0 {
+		return makeListView(id, "", nil)
+	}
+	return makeListView(id, args[0], args[1:])
+}
+
 // RegisterDefaultViewFactories registers the builtins views factories.
 func RegisterDefaultViewFactories(e Editor) {
 	e.RegisterViewFactory("command", commandViewFactory)
+	e.RegisterViewFactory("document_changed", documentChangedViewFactory)
+	e.RegisterViewFactory("document_recovery", documentRecoveryViewFactory)
+	e.RegisterViewFactory("hex", hexViewFactory)
 	e.RegisterViewFactory("infobar_alert", infobarAlertViewFactory)
+	e.RegisterViewFactory("list", listViewFactory)
 	e.RegisterViewFactory("new_document", documentViewFactory)
 	e.RegisterViewFactory("status_active_window_name", statusActiveWindowNameViewFactory)
+	e.RegisterViewFactory("status_document", statusDocumentViewFactory)
 	e.RegisterViewFactory("status_mode", statusModeViewFactory)
 	e.RegisterViewFactory("status_position", statusPositionViewFactory)
 	e.RegisterViewFactory("status_root", statusRootViewFactory)
+	e.RegisterViewFactory("substitute_confirm", substituteConfirmViewFactory)
 }
 
 // Commands
 
 // RegisterViewCommands registers view-related commands
 func RegisterViewCommands(dispatcher wicore.CommandsW) {
-	cmds := []wicore.Command{}
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"view_set_column_mode",
+			-1,
+			cmdViewSetColumnMode,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Sets the free movement of the cursor in the View",
+			},
+			lang.Map{
+				lang.En: "Usage: view_set_column_mode [on|off]\nLets the cursor move on the display columns, past the end of the lines and inside the tabs, like vim's virtualedit=all. Typing there first fills the space with spaces. It is meant to edit tables and ASCII art, with block selections. Without argument, it toggles the mode. Each View has its own setting.",
+			},
+		},
+		&wicore.CommandImpl{
+			"view_set_wrap",
+			-1,
+			cmdViewSetWrap,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Sets the soft word wrap of the View",
+			},
+			lang.Map{
+				lang.En: "Usage: view_set_wrap [on|off] [indent] [showbreak]\nShows the lines longer than the View on several rows, broken at the word boundaries, instead of scrolling horizontally. Without argument, it toggles the word wrap. The continuation rows start with indent spaces followed by showbreak, for example: view_set_wrap on 2 >. Each View has its own setting.",
+			},
+		},
+	}
 	for _, cmd := range cmds {
 		dispatcher.Register(cmd)
 	}
@@ -0,0 +1,151 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// File watching. The OS specific implementations are in watcher_*.go.
+
+package editor
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/wi-ed/wi/wicore"
+)
+
+// pollInterval is the interval at which the files are checked when the OS
+// doesn't provide file change notifications.
+const pollInterval = time.Second
+
+// fileWatcher notifies when files are modified on disk.
+//
+// The notification function is called from a background goroutine with the
+// absolute path of the modified file. It may be called spuriously, so the receiver
+// must check if the file was really modified.
+type fileWatcher interface {
+	io.Closer
+	// watch starts watching a file. Calls are reference counted.
+	watch(filePath string)
+	// unwatch stops watching a file.
+	unwatch(filePath string)
+}
+
+// fileStat is the state of a file on disk, to determine if it was modified.
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+func (f fileStat) equal(o fileStat) bool {
+	return f.modTime.Equal(o.modTime) && f.size == o.size
+}
+
+// absPath returns the absolute path of filePath, so paths can be compared.
+func absPath(filePath string) string {
+	if p, err := filepath.Abs(filePath); err == nil {
+		return p
+	}
+	return filePath
+}
+
+func statFile(filePath string) (fileStat, error) {
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return fileStat{}, err
+	}
+	return fileStat{fi.ModTime(), fi.Size()}, nil
+}
+
+// watchedFile is a file watched by pollWatcher.
+type watchedFile struct {
+	refs int
+	stat fileStat
+	err  error
+}
+
+// pollWatcher is the portable fileWatcher. It periodically checks the
+// modification time and the size of the files.
+type pollWatcher struct {
+	lock   sync.Mutex
+	files  map[string]*watchedFile
+	notify func(filePath string)
+	done   chan struct{}
+}
+
+func newPollWatcher(notify func(filePath string)) *pollWatcher {
+	p := &pollWatcher{
+		files:  map[string]*watchedFile{},
+		notify: notify,
+		done:   make(chan struct{}),
+	}
+	wicore.Go("pollWatcher", p.loop)
+	return p
+}
+
+func (p *pollWatcher) Close() error {
+	close(p.done)
+	return nil
+}
+
+func (p *pollWatcher) watch(filePath string) {
+	filePath = absPath(filePath)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if f, ok := p.files[filePath]; ok {
+		f.refs++
+		return
+	}
+	stat, err := statFile(filePath)
+	p.files[filePath] = &watchedFile{1, stat, err}
+}
+
+func (p *pollWatcher) unwatch(filePath string) {
+	filePath = absPath(filePath)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if f, ok := p.files[filePath]; ok {
+		if f.refs--; f.refs == 0 {
+			delete(p.files, filePath)
+		}
+	}
+}
+
+// watching returns true if filePath is watched.
+func (p *pollWatcher) watching(filePath string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	_, ok := p.files[absPath(filePath)]
+	return ok
+}
+
+func (p *pollWatcher) loop() {
+	for {
+		select {
+		case <-time.After(pollInterval):
+		case <-p.done:
+			return
+		}
+		for _, filePath := range p.poll() {
+			p.notify(filePath)
+		}
+	}
+}
+
+// poll returns the files that changed since the last poll.
+func (p *pollWatcher) poll() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var out []string
+	for filePath, f := range p.files {
+		stat, err := statFile(filePath)
+		if !stat.equal(f.stat) || (err == nil) != (f.err == nil) {
+			f.stat = stat
+			f.err = err
+			out = append(out, filePath)
+		}
+	}
+	return out
+}
@@ -0,0 +1,170 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/wi-ed/wi/wicore"
+)
+
+// inotifyMask are the events that denote a file was modified. The directory is
+// watched instead of the file, since saving atomically replaces the file.
+// IN_MODIFY catches the writers keeping the file opened, like a log appender.
+const inotifyMask = syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_DELETE | syscall.IN_MOVED_FROM
+
+// inotifyWatcher is the fileWatcher on linux.
+type inotifyWatcher struct {
+	lock   sync.Mutex
+	fd     int                       // Do not call f.Fd(), it switches the file to blocking mode.
+	f      *os.File                  // Wraps fd so Close() unblocks Read().
+	dirs   map[string]int32          // Directory path to watch descriptor.
+	wds    map[int32]string          // Watch descriptor to directory path.
+	files  map[string]map[string]int // Directory to watched file names to reference count.
+	poll   *pollWatcher              // Fallback for the directories that can't be watched, e.g. when max_user_watches is exhausted. Created on first use.
+	notify func(filePath string)
+}
+
+// newFileWatcher returns an inotify based fileWatcher, falling back to polling
+// if inotify is not available.
+func newFileWatcher(notify func(filePath string)) fileWatcher {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		log.Printf("inotify is not available, polling files: %s", err)
+		return newPollWatcher(notify)
+	}
+	i := &inotifyWatcher{
+		fd:     fd,
+		f:      os.NewFile(uintptr(fd), "inotify"),
+		dirs:   map[string]int32{},
+		wds:    map[int32]string{},
+		files:  map[string]map[string]int{},
+		notify: notify,
+	}
+	wicore.Go("inotifyWatcher", i.loop)
+	return i
+}
+
+func (i *inotifyWatcher) Close() error {
+	i.lock.Lock()
+	poll := i.poll
+	i.lock.Unlock()
+	if poll != nil {
+		_ = poll.Close()
+	}
+	return i.f.Close()
+}
+
+func (i *inotifyWatcher) watch(filePath string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	dir, name := splitAbs(filePath)
+	if i.poll != nil && i.poll.watching(filePath) {
+		i.poll.watch(filePath)
+		return
+	}
+	if names, ok := i.files[dir]; ok {
+		names[name]++
+		return
+	}
+	wd, err := syscall.InotifyAddWatch(i.fd, dir, inotifyMask)
+	if err != nil {
+		// Usually ENOSPC when max_user_watches is exhausted.
+		log.Printf("Failed to watch %s, polling %s: %s", dir, name, err)
+		if i.poll == nil {
+			i.poll = newPollWatcher(i.notify)
+		}
+		i.poll.watch(filePath)
+		return
+	}
+	i.dirs[dir] = int32(wd)
+	i.wds[int32(wd)] = dir
+	i.files[dir] = map[string]int{name: 1}
+}
+
+func (i *inotifyWatcher) unwatch(filePath string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	dir, name := splitAbs(filePath)
+	if i.poll != nil && i.poll.watching(filePath) {
+		i.poll.unwatch(filePath)
+		return
+	}
+	names, ok := i.files[dir]
+	if !ok {
+		return
+	}
+	if names[name]--; names[name] <= 0 {
+		delete(names, name)
+	}
+	if len(names) == 0 {
+		wd := i.dirs[dir]
+		_, _ = syscall.InotifyRmWatch(i.fd, uint32(wd))
+		delete(i.dirs, dir)
+		delete(i.wds, wd)
+		delete(i.files, dir)
+	}
+}
+
+func (i *inotifyWatcher) loop() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := i.f.Read(buf)
+		if err != nil {
+			// Closed.
+			return
+		}
+		for _, filePath := range i.parse(buf[:n]) {
+			i.notify(filePath)
+		}
+	}
+}
+
+// splitAbs returns the absolute directory and the file name of filePath.
+func splitAbs(filePath string) (string, string) {
+	return filepath.Split(absPath(filePath))
+}
+
+// parse returns the watched files referenced by the events in buf. When the
+// event queue overflowed, events were lost so all the watched files are
+// returned.
+func (i *inotifyWatcher) parse(buf []byte) []string {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	var out []string
+	for len(buf) >= syscall.SizeofInotifyEvent {
+		event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		end := syscall.SizeofInotifyEvent + int(event.Len)
+		if end > len(buf) {
+			break
+		}
+		name := string(buf[syscall.SizeofInotifyEvent:end])
+		for len(name) != 0 && name[len(name)-1] == 0 {
+			name = name[:len(name)-1]
+		}
+		buf = buf[end:]
+		if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			for dir, names := range i.files {
+				for name := range names {
+					out = append(out, filepath.Join(dir, name))
+				}
+			}
+			continue
+		}
+		dir, ok := i.wds[event.Wd]
+		if !ok {
+			continue
+		}
+		if _, ok := i.files[dir][name]; ok {
+			out = append(out, filepath.Join(dir, name))
+		}
+	}
+	return out
+}
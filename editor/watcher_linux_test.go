@@ -0,0 +1,48 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/maruel/ut"
+)
+
+func TestInotifyWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	i, ok := newFileWatcher(func(string) {}).(*inotifyWatcher)
+	if !ok {
+		t.Skip("inotify is not available")
+	}
+	defer i.Close()
+	i.watch(a)
+	i.watch(b)
+
+	// Events were lost, all the files are returned.
+	buf := make([]byte, syscall.SizeofInotifyEvent)
+	event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[0]))
+	event.Wd = -1
+	event.Mask = syscall.IN_Q_OVERFLOW
+	out := i.parse(buf)
+	sort.Strings(out)
+	ut.AssertEqual(t, []string{a, b}, out)
+
+	// A directory that can't be watched is polled instead.
+	missing := filepath.Join(dir, "missing", "c.txt")
+	i.watch(missing)
+	ut.AssertEqual(t, true, i.poll.watching(missing))
+	i.unwatch(missing)
+	ut.AssertEqual(t, false, i.poll.watching(missing))
+}
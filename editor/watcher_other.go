@@ -0,0 +1,14 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// +build !linux
+
+package editor
+
+// newFileWatcher returns a polling fileWatcher.
+//
+// TODO(maruel): Use FSEvents on OSX and ReadDirectoryChangesW on Windows.
+func newFileWatcher(notify func(filePath string)) fileWatcher {
+	return newPollWatcher(notify)
+}
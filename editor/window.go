@@ -49,6 +49,7 @@ type window struct {
 	border          wicore.BorderType
 	effectiveBorder drawnBorder       // effectiveBorder automatically collapses borders when the Window Rect is too small and is based on docking.
 	borderFormat    raster.CellFormat // Format to be used in borders. It can be different from .View().DefaultFormat().
+	jumps           jumpList          // Positions before the jumps made in this Window, see jump_older.
 }
 
 // wicore.Window interface.
@@ -95,13 +96,18 @@ func (w *window) View() wicore.View {
 
 // Private methods.
 
-// Recursively detach a window tree.
+// Recursively detach a window tree and close its views.
 func detachRecursively(w *window) {
 	for _, c := range w.childrenWindows {
 		detachRecursively(c)
 	}
 	w.parent = nil
 	w.childrenWindows = nil
+	if w.view != nil {
+		if err := w.view.Close(); err != nil {
+			log.Printf("%s: failed to close %s: %s", w, w.view, err)
+		}
+	}
 }
 
 func recurseIDToWindow(w *window, fullID string) *window {
@@ -200,16 +206,39 @@ func calculateEffectiveBorder(r raster.Rect, d wicore.DockingType) drawnBorder {
 	}
 }
 
+// raise makes w and its parents visible when they are stacked DockingFill
+// Windows, by moving them first among their DockingFill siblings.
+func (w *window) raise() {
+	for ; w.parent != nil; w = w.parent {
+		if w.docking != wicore.DockingFill {
+			continue
+		}
+		// Rotate only the DockingFill children, so the layout of the other
+		// children is not affected.
+		prev := w
+		for i, child := range w.parent.childrenWindows {
+			if child.docking != wicore.DockingFill {
+				continue
+			}
+			w.parent.childrenWindows[i] = prev
+			if child == w {
+				break
+			}
+			prev = child
+		}
+	}
+}
+
 // resizeChildren() resizes all the children Window.
 func (w *window) resizeChildren() {
 	log.Printf("%s.resizeChildren()", w)
 	// When borders are used, w.clientAreaRect.X and .Y are likely 1.
 	remaining := w.clientAreaRect
-	var fill *window
+	var fills []*window
 	for _, child := range w.childrenWindows {
 		switch child.Docking() {
 		case wicore.DockingFill:
-			fill = child
+			fills = append(fills, child)
 
 		case wicore.DockingFloating:
 			// Floating uses its own thing.
@@ -272,8 +301,11 @@ func (w *window) resizeChildren() {
 			panic("Fill me")
 		}
 	}
-	if fill != nil {
-		fill.setRect(remaining)
+	if len(fills) != 0 {
+		// Only the first one is visible but they all have the same size.
+		for _, fill := range fills {
+			fill.setRect(remaining)
+		}
 		w.viewRect.X = 0
 		w.viewRect.Y = 0
 		w.viewRect.Width = 0
@@ -296,17 +328,41 @@ func (w *window) buffer() *raster.Buffer {
 	return w.windowBuffer
 }
 
-/* TODO(maruel): Is it needed at all?
-func (w *window) setView(view wicore.View) {
-	if view != w.view {
-		w.view = view
-		b := w.windowBuffer.SubBuffer(w.viewRect)
-		b.Fill(w.cell(' '))
-		wicore.PostCommand(w, "editor_redraw")
+// setView replaces the View of the Window, for example to show a document in
+// another way. The previous View is closed.
+func (w *window) setView(view wicore.ViewW) {
+	old := w.view
+	w.view = view
+	view.SetSize(w.viewRect.Width, w.viewRect.Height)
+	view.OnAttach(w)
+	if old != nil {
+		if err := old.Close(); err != nil {
+			log.Printf("%s: failed to close %s: %s", w, old, err)
+		}
+	}
+	wicore.PostCommand(w.e, nil, "editor_redraw")
+}
+
+// newView creates a View with the ViewFactory viewFactoryName. Returns nil if
+// there is no such factory.
+func (e *editor) newView(viewFactoryName string, args ...string) wicore.ViewW {
+	viewFactory, ok := e.viewFactories[viewFactoryName]
+	if !ok {
+		return nil
+	}
+	// TODO(maruel): e.nextViewID is an implementation detail, it's wrong.
+	view := viewFactory(e, e.nextViewID, args...)
+	e.nextViewID++
+	return view
+}
+
+// walkWindows calls f for w and all its descendants.
+func walkWindows(w *window, f func(w *window)) {
+	f(w)
+	for _, c := range w.childrenWindows {
+		walkWindows(c, f)
 	}
-	panic("To test")
 }
-*/
 
 // updateBorder calculates w.effectiveBorder, w.clientAreaRect and draws the
 // borders right away in the Window's buffer.
@@ -468,11 +524,13 @@ func cmdWindowClose(c *privilegedCommandImpl, e *editor, w *window, args ...stri
 		e.ExecuteCommand(w, "alert", isNotValidWindow.Formatf(windowName))
 		return
 	}
-	for i, v := range child.parent.childrenWindows {
+	parent := child.parent
+	for i, v := range parent.childrenWindows {
 		if v == child {
-			copy(w.childrenWindows[i:], w.childrenWindows[i+1:])
-			w.childrenWindows[len(w.childrenWindows)-1] = nil
-			w.childrenWindows = w.childrenWindows[:len(w.childrenWindows)-1]
+			copy(parent.childrenWindows[i:], parent.childrenWindows[i+1:])
+			parent.childrenWindows[len(parent.childrenWindows)-1] = nil
+			parent.childrenWindows = parent.childrenWindows[:len(parent.childrenWindows)-1]
+			e.forgetWindow(child)
 			detachRecursively(v)
 			wicore.PostCommand(e, nil, "editor_redraw")
 			return
@@ -500,48 +558,60 @@ func cmdWindowNew(c *privilegedCommandImpl, e *editor, w *window, args ...string
 		}
 		return
 	}
-	// TODO(maruel): Only the first child Window with DockingFill is visible.
-	// TODO(maruel): Reorder .childrenWindows with
-	// CommandDispatcherFull.ActivateWindow() but only with DockingFill.
+	// Multiple DockingFill children are stacked; only the first one is visible.
+	// See window.raise().
 	// TODO(maruel): Also allow DockingFloating.
-	//if docking != wicore.DockingFill {
-	for _, child := range parent.childrenWindows {
-		if child.Docking() == docking {
-			if viewFactoryName != "infobar_alert" {
-				e.ExecuteCommand(w, "alert", cantAddTwoWindowWithSameDocking.Formatf(docking))
+	if docking != wicore.DockingFill {
+		for _, child := range parent.childrenWindows {
+			if child.Docking() == docking {
+				if viewFactoryName != "infobar_alert" {
+					e.ExecuteCommand(w, "alert", cantAddTwoWindowWithSameDocking.Formatf(docking))
+				}
+				return
 			}
-			return
 		}
 	}
-	//}
 
-	viewFactory, ok := e.viewFactories[viewFactoryName]
-	if !ok {
+	view := e.newView(viewFactoryName, args[3:]...)
+	if view == nil {
 		if viewFactoryName != "infobar_alert" {
 			e.ExecuteCommand(w, "alert", invalidViewFactory.Formatf(viewFactoryName))
 		}
 		return
 	}
-	// TODO(maruel): e.nextViewID is an implementation detail, it's wrong.
-	view := viewFactory(e, e.nextViewID, args[3:]...)
-	e.nextViewID++
 
 	child := makeWindow(parent, view, docking)
+	var rect raster.Rect
 	if docking == wicore.DockingFloating {
 		width, height := view.NaturalSize()
 		if child.border != wicore.BorderNone {
 			width += 2
 			height += 2
 		}
-		// TODO(maruel): Handle when width or height > scren size.
 		// TODO(maruel): Not clean. Doesn't handle root Window resize properly.
 		rootRect := e.rootWindow.Rect()
-		child.rect.X = (rootRect.Width - width - 1) / 2
-		child.rect.Y = (rootRect.Height - height - 1) / 2
-		child.rect.Width = width
-		child.rect.Height = height
+		if width > rootRect.Width {
+			width = rootRect.Width
+		}
+		if height > rootRect.Height {
+			height = rootRect.Height
+		}
+		rect.X = (rootRect.Width - width - 1) / 2
+		rect.Y = (rootRect.Height - height - 1) / 2
+		if rect.X < 0 {
+			rect.X = 0
+		}
+		if rect.Y < 0 {
+			rect.Y = 0
+		}
+		rect.Width = width
+		rect.Height = height
 	}
 	parent.childrenWindows = append(parent.childrenWindows, child)
+	if docking == wicore.DockingFloating {
+		// setRect() is what allocates the buffers.
+		child.setRect(rect)
+	}
 	parent.resizeChildren()
 	// Call OnAttach() after the Window is attached to the parent.
 	view.OnAttach(child)
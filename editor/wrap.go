@@ -0,0 +1,332 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Soft word wrap of a documentView. When wordWrap is set, a line longer than
+// the View is shown on several rows, broken after the last whitespace that
+// fits, and the View doesn't scroll horizontally. The continuation rows start
+// with wrapIndent spaces and the showBreak marker.
+
+package editor
+
+import (
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// displayRow is the part of a line shown on a row of the View.
+type displayRow struct {
+	line  int
+	runes []rune // Content of the line.
+	start int    // First column of the line shown on the row.
+	end   int    // Column after the last one shown on the row.
+	left  int    // Display column shown at x.
+	right int    // Display column after the last one shown on the row.
+	x     int    // Position of left in the row, after the continuation prefix.
+	last  bool   // true if the row shows the end of the line.
+}
+
+// pos returns the position in the row of the display column x.
+func (r *displayRow) pos(x int) int {
+	return r.x + x - r.left
+}
+
+// text returns the runes shown on the row, with the tabs expanded to spaces.
+func (r *displayRow) text() string {
+	out := make([]rune, 0, r.end-r.start)
+	x := displayColumn(r.runes, r.start)
+	for _, c := range r.runes[r.start:r.end] {
+		w := runeWidth(c, x)
+		for i := x; i < x+w; i++ {
+			if i < r.left {
+				// Part of a tab scrolled out of the View.
+				continue
+			}
+			if c == '\t' {
+				out = append(out, ' ')
+			} else {
+				out = append(out, c)
+			}
+		}
+		x += w
+	}
+	return string(out)
+}
+
+// wrapLine returns the column starting each row of a line shown in width
+// display columns. The rows after the first one have prefix columns less.
+func wrapLine(runes []rune, width, prefix int) []int {
+	starts := []int{0}
+	if width <= 0 {
+		return starts
+	}
+	if prefix >= width {
+		prefix = width - 1
+	}
+	// cols[i] is the display column of runes[i].
+	cols := make([]int, len(runes)+1)
+	for i, r := range runes {
+		cols[i+1] = cols[i] + runeWidth(r, cols[i])
+	}
+	pos, avail := 0, width
+	for i := 0; i < len(runes); {
+		if i == pos || cols[i+1]-cols[pos] <= avail {
+			i++
+			continue
+		}
+		// Break after the last whitespace fitting in the row, otherwise in the
+		// middle of the word.
+		next := i
+		for j := i; j > pos; j-- {
+			if unicode.IsSpace(runes[j-1]) {
+				next = j
+				break
+			}
+		}
+		starts = append(starts, next)
+		pos, avail = next, width-prefix
+	}
+	return starts
+}
+
+// wrapPrefix returns the width of the prefix of the continuation rows.
+func (v *documentView) wrapPrefix() int {
+	p := v.wrapIndent + utf8.RuneCountInString(v.showBreak)
+	if w := v.buffer.Width; p >= w && w > 0 {
+		p = w - 1
+	}
+	return p
+}
+
+// lineRows returns the rows showing a line. Without wordWrap, it is a single
+// row scrolled by offsetColumn.
+func (v *documentView) lineRows(line int) []displayRow {
+	runes := []rune(v.document.line(line))
+	end := displayColumn(runes, len(runes))
+	if !v.wordWrap {
+		start, _ := columnAt(runes, v.offsetColumn)
+		if start > len(runes) {
+			start = len(runes)
+		}
+		return []displayRow{{line, runes, start, len(runes), v.offsetColumn, end, 0, true}}
+	}
+	prefix := v.wrapPrefix()
+	starts := wrapLine(runes, v.buffer.Width, prefix)
+	rows := make([]displayRow, len(starts))
+	for i, start := range starts {
+		rows[i] = displayRow{line, runes, start, len(runes), displayColumn(runes, start), end, 0, true}
+		if i != 0 {
+			rows[i].x = prefix
+			rows[i-1].end = start
+			rows[i-1].right = rows[i].left
+			rows[i-1].last = false
+		}
+	}
+	return rows
+}
+
+// rowIndex returns the index of the row showing a column.
+func rowIndex(rows []displayRow, col int) int {
+	i := len(rows) - 1
+	for i > 0 && rows[i].start > col {
+		i--
+	}
+	return i
+}
+
+// layout returns the rows visible in the View.
+func (v *documentView) layout() []displayRow {
+	var out []displayRow
+	for line := v.offsetLine; line < v.document.lineCount() && len(out) < v.buffer.Height; line++ {
+		rows := v.lineRows(line)
+		if line == v.offsetLine && v.offsetRow < len(rows) {
+			rows = rows[v.offsetRow:]
+		}
+		if n := v.buffer.Height - len(out); len(rows) > n {
+			rows = rows[:n]
+		}
+		out = append(out, rows...)
+	}
+	return out
+}
+
+// drawRows draws the rows of the document.
+func (v *documentView) drawRows() {
+	breakFormat := v.defaultFormat
+	breakFormat.Fg = colors.DarkGray
+	for y, r := range v.rows {
+		if r.x != 0 {
+			v.buffer.DrawString(v.showBreak, v.wrapIndent, y, breakFormat)
+		}
+		v.buffer.DrawString(r.text(), r.x, y, v.defaultFormat)
+	}
+}
+
+// cell returns the cell showing a column of a line, add display columns
+// inside the rune, nil if it is not visible. The columns after the end of the
+// line are the positions of the cursor in Insert mode and in columnMode.
+func (v *documentView) cell(line, col, add int) *raster.Cell {
+	for y, r := range v.rows {
+		if r.line == line && col >= r.start && (col < r.end || r.last) {
+			if x := r.pos(displayColumn(r.runes, col) + add); x >= 0 && x < v.buffer.Width {
+				return v.buffer.Cell(x, y)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// paintCells sets the colors of the cells of row y showing the display
+// columns [from, to).
+func (v *documentView) paintCells(y int, r displayRow, from, to int, fg, bg colors.RGB) {
+	if from < r.left {
+		from = r.left
+	}
+	if !r.last && to > r.right {
+		to = r.right
+	}
+	for x := from; x < to && r.pos(x) < v.buffer.Width; x++ {
+		cell := v.buffer.Cell(r.pos(x), y)
+		cell.F.Bg = bg
+		cell.F.Fg = fg
+	}
+}
+
+// scrollToCursorWrapped adjusts offsetLine and offsetRow so the cursor is
+// inside the View.
+func (v *documentView) scrollToCursorWrapped() {
+	v.offsetColumn = 0
+	if rows := v.lineRows(v.offsetLine); v.offsetRow >= len(rows) {
+		// The line was shortened.
+		v.offsetRow = len(rows) - 1
+	}
+	line, row := v.cursorLine, rowIndex(v.lineRows(v.cursorLine), v.cursorColumn)
+	if line < v.offsetLine || (line == v.offsetLine && row < v.offsetRow) {
+		v.offsetLine, v.offsetRow = line, row
+		return
+	}
+	// Walk back from the cursor up to the height of the View. If the first
+	// visible row is not met, the cursor goes on the last row.
+	for n := 1; n < v.buffer.Height; n++ {
+		if line == v.offsetLine && row == v.offsetRow {
+			return
+		}
+		if row > 0 {
+			row--
+		} else {
+			line--
+			row = len(v.lineRows(line)) - 1
+		}
+	}
+	if v.buffer.Height != 0 {
+		v.offsetLine, v.offsetRow = line, row
+	}
+}
+
+// moveDisplayRow moves the cursor up or down by one row of the View, keeping
+// the position of the cursor in the row. Without wordWrap, it moves by one
+// line.
+func (v *documentView) moveDisplayRow(e wicore.EditorW, dir int) {
+	if !v.wordWrap || v.buffer.Width == 0 {
+		if dir < 0 {
+			cmdDocumentCursorUp(v, e)
+		} else {
+			cmdDocumentCursorDown(v, e)
+		}
+		return
+	}
+	rows := v.lineRows(v.cursorLine)
+	i := rowIndex(rows, v.cursorColumn)
+	x := v.wantX
+	if v.wantCursor != v.primary() {
+		x = rows[i].pos(v.virtualColumn())
+	}
+	line := v.cursorLine
+	i += dir
+	if i < 0 {
+		if line == 0 {
+			// TODO(maruel): Beep.
+			return
+		}
+		line--
+		rows = v.lineRows(line)
+		i = len(rows) - 1
+	} else if i >= len(rows) {
+		if line >= v.document.lineCount()-1 {
+			// TODO(maruel): Beep.
+			return
+		}
+		line++
+		rows = v.lineRows(line)
+		i = 0
+	}
+	r := rows[i]
+	want := r.left
+	if x > r.x {
+		want += x - r.x
+	}
+	if !r.last && want >= r.right {
+		want = r.right - 1
+	}
+	v.cursorLine = line
+	v.setVirtualColumn(want)
+	if !r.last && v.cursorColumn >= r.end {
+		// A tab too wide for the row.
+		v.cursorColumn, v.cursorColumnMax = r.end-1, r.end-1
+	}
+	v.wantX, v.wantCursor = x, v.primary()
+	v.cursorMoved(e)
+}
+
+func cmdDocumentCursorRowUp(v *documentView, e wicore.EditorW) {
+	v.moveDisplayRow(e, -1)
+}
+
+func cmdDocumentCursorRowDown(v *documentView, e wicore.EditorW) {
+	v.moveDisplayRow(e, 1)
+}
+
+func cmdViewSetWrap(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+	v, ok := w.View().(*documentView)
+	if !ok {
+		e.ExecuteCommand(w, "alert", notADocument.String())
+		return
+	}
+	if len(args) > 3 {
+		e.ExecuteCommand(w, "alert", c.LongDesc())
+		return
+	}
+	wrap := !v.wordWrap
+	if len(args) != 0 {
+		switch args[0] {
+		case "on":
+			wrap = true
+		case "off":
+			wrap = false
+		default:
+			e.ExecuteCommand(w, "alert", c.LongDesc())
+			return
+		}
+	}
+	if len(args) > 1 {
+		indent, err := strconv.Atoi(args[1])
+		if err != nil || indent < 0 {
+			e.ExecuteCommand(w, "alert", invalidNumber.Formatf(args[1]))
+			return
+		}
+		v.wrapIndent = indent
+	}
+	if len(args) > 2 {
+		v.showBreak = args[2]
+	}
+	v.wordWrap = wrap
+	v.offsetColumn = 0
+	v.offsetRow = 0
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
@@ -0,0 +1,76 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestWrapLine(t *testing.T) {
+	data := []struct {
+		line   string
+		width  int
+		prefix int
+		starts []int
+	}{
+		{"", 4, 0, []int{0}},
+		{"aa bb", 5, 0, []int{0}},
+		{"aaa bbb ccc", 8, 0, []int{0, 8}},
+		{"aaa bbb ccc", 6, 0, []int{0, 4, 8}},
+		{"abcdefghij", 4, 0, []int{0, 4, 8}},
+		{"abcdefghij", 4, 2, []int{0, 4, 6, 8}},
+		{"abcdef", 3, 5, []int{0, 3, 4, 5}},
+		{"abcdef", 0, 0, []int{0}},
+	}
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, line.starts, wrapLine([]rune(line.line), line.width, line.prefix))
+	}
+}
+
+func TestWordWrap(t *testing.T) {
+	long := strings.Repeat("word ", 30)
+	content := long + "\nend\n"
+
+	_, v := typeKeys(t, content, ":view_set_wrap on 2 >\n")
+	ut.AssertEqual(t, true, v.wordWrap)
+	ut.AssertEqual(t, 0, v.offsetColumn)
+	rows := v.lineRows(0)
+	ut.AssertEqual(t, true, len(rows) > 1)
+	ut.AssertEqual(t, 0, rows[1].start%5)
+	ut.AssertEqual(t, 3, rows[1].x)
+	ut.AssertEqual(t, rows, v.rows[:len(rows)])
+	ut.AssertEqual(t, '>', v.buffer.Cell(2, 1).R)
+	ut.AssertEqual(t, 'w', v.buffer.Cell(3, 1).R)
+	ut.AssertEqual(t, 'e', v.buffer.Cell(0, len(rows)).R)
+
+	// Up and down move by row, keeping the position in the row.
+	_, v = typeKeys(t, content, ":view_set_wrap\nllj")
+	rows = v.lineRows(0)
+	ut.AssertEqual(t, cursor{0, rows[1].start + 2, rows[1].start + 2}, v.primary())
+	_, v = typeKeys(t, content, ":view_set_wrap\nllj"+strings.Repeat("j", len(rows)-1))
+	ut.AssertEqual(t, cursor{1, 2, 2}, v.primary())
+	_, v = typeKeys(t, content, ":view_set_wrap\nll"+strings.Repeat("j", len(rows))+strings.Repeat("k", len(rows)))
+	ut.AssertEqual(t, cursor{0, 2, 2}, v.primary())
+
+	// The operators still apply to whole lines.
+	_, v = typeKeys(t, content+"x\n", ":view_set_wrap\ndj")
+	ut.AssertEqual(t, "x\n", v.document.content.String())
+
+	// The View scrolls by rows to show the cursor.
+	_, v = typeKeys(t, strings.Repeat(long+"\n", 30), ":view_set_wrap\nG")
+	ut.AssertEqual(t, true, v.offsetLine > 0)
+	ut.AssertEqual(t, true, v.cell(v.cursorLine, v.cursorColumn, 0) != nil)
+	_, v = typeKeys(t, strings.Repeat(long+"\n", 30), ":view_set_wrap\nGgg")
+	ut.AssertEqual(t, 0, v.offsetLine)
+	ut.AssertEqual(t, 0, v.offsetRow)
+
+	// Toggled off.
+	_, v = typeKeys(t, content, ":view_set_wrap\n:view_set_wrap\nllj")
+	ut.AssertEqual(t, false, v.wordWrap)
+	ut.AssertEqual(t, cursor{1, 2, 2}, v.primary())
+}
@@ -13,10 +13,14 @@ import (
 // It is implemented by wi/wicore/plugin, exported here to be used via RPC.
 type EventTriggerRPC interface {
 	TriggerCommandsRPC(packet PacketCommands, ignored *int) error
+	TriggerDocumentChangedOnDiskRPC(packet PacketDocumentChangedOnDisk, ignored *int) error
 	TriggerDocumentCreatedRPC(packet PacketDocumentCreated, ignored *int) error
 	TriggerDocumentCursorMovedRPC(packet PacketDocumentCursorMoved, ignored *int) error
+	TriggerDocumentFileTypeChangedRPC(packet PacketDocumentFileTypeChanged, ignored *int) error
+	TriggerDocumentSelectionChangedRPC(packet PacketDocumentSelectionChanged, ignored *int) error
 	TriggerEditorKeyboardModeChangedRPC(packet PacketEditorKeyboardModeChanged, ignored *int) error
 	TriggerEditorLanguageRPC(packet PacketEditorLanguage, ignored *int) error
+	TriggerEditorRegisterChangedRPC(packet PacketEditorRegisterChanged, ignored *int) error
 	TriggerTerminalKeyPressedRPC(packet PacketTerminalKeyPressed, ignored *int) error
 	TriggerTerminalMetaKeyPressedRPC(packet PacketTerminalMetaKeyPressed, ignored *int) error
 	TriggerTerminalResizedRPC(packet PacketTerminalResized, ignored *int) error
@@ -31,6 +35,11 @@ type PacketCommands struct {
 	Cmds wicore.EnqueuedCommands
 }
 
+// PacketDocumentChangedOnDisk is exported for internal RPC use.
+type PacketDocumentChangedOnDisk struct {
+	Doc wicore.Document
+}
+
 // PacketDocumentCreated is exported for internal RPC use.
 type PacketDocumentCreated struct {
 	Doc wicore.Document
@@ -43,6 +52,21 @@ type PacketDocumentCursorMoved struct {
 	Row int
 }
 
+// PacketDocumentFileTypeChanged is exported for internal RPC use.
+type PacketDocumentFileTypeChanged struct {
+	Doc      wicore.Document
+	FileType wicore.FileType
+}
+
+// PacketDocumentSelectionChanged is exported for internal RPC use.
+type PacketDocumentSelectionChanged struct {
+	Doc      wicore.Document
+	StartCol int
+	StartRow int
+	EndCol   int
+	EndRow   int
+}
+
 // PacketEditorKeyboardModeChanged is exported for internal RPC use.
 type PacketEditorKeyboardModeChanged struct {
 	Mode wicore.KeyboardMode
@@ -53,6 +77,11 @@ type PacketEditorLanguage struct {
 	L lang.Language
 }
 
+// PacketEditorRegisterChanged is exported for internal RPC use.
+type PacketEditorRegisterChanged struct {
+	Name string
+}
+
 // PacketTerminalKeyPressed is exported for internal RPC use.
 type PacketTerminalKeyPressed struct {
 	K key.Press
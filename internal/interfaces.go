@@ -21,3 +21,13 @@ type PluginRPC interface {
 	// return.
 	Quit(in int, ignored *int) error
 }
+
+// EditorRPC is the low-level interface exposed by the editor for use by
+// net/rpc, so the plugins can query it. It is served on a separate connection
+// since the plugin is the server of the main one.
+type EditorRPC interface {
+	// RegisterContent returns the text in a register.
+	RegisterContent(name string, out *string) error
+	// SelectedText returns the text selected in the active View.
+	SelectedText(ignored int, out *string) error
+}
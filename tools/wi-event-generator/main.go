@@ -177,17 +177,46 @@ import (
 	"github.com/wi-ed/wi/wicore/lang"
 )
 
-// makeEventRegistry returns a wicore.EventRegistry and the channel to read
-// from to run the events piped in.
-func makeEventRegistry() (wicore.EventRegistry, chan func()) {
+// makeEventRegistry returns a wicore.EventRegistry, the channel to post the
+// functions to run in the UI goroutine and the channel to read them from.
+func makeEventRegistry() (wicore.EventRegistry, chan<- func(), <-chan func()) {
 	// Reduce the odds of allocation within RegistryXXX() by using relatively
 	// large buffers.
-	c := make(chan func(), 2048)
+	in := make(chan func(), 2048)
+	out := make(chan func())
 	e := &eventRegistry{
-		deferred: c,{{range .Events}}
+		deferred: in,{{range .Events}}
 		{{.Lower}}: make([]listener{{.Name}}, 0, 64),{{end}}
 	}
-	return e, c
+	wicore.Go("queueEvents", func() {
+		queueEvents(in, out)
+	})
+	return e, in, out
+}
+
+// queueEvents forwards the functions posted on in to out, in order. The queue
+// is unbounded so the UI goroutine never blocks on itself when a command
+// posts many events, like a command repeated by a large count. It stops after
+// forwarding nil, which tells the event loop to quit.
+func queueEvents(in <-chan func(), out chan<- func()) {
+	var queue []func()
+	for {
+		var next chan<- func()
+		var f func()
+		if len(queue) != 0 {
+			next, f = out, queue[0]
+		}
+		select {
+		case i := <-in:
+			queue = append(queue, i)
+		case next <- f:
+			queue[0] = nil
+			queue = queue[1:]
+			if f == nil {
+				return
+			}
+		}
+	}
 }
 
 // registerPluginEvents registers all the events to be forwarded to the plugin
@@ -39,18 +39,30 @@ func (p *pluginImpl) Init(e wicore.Editor) {
 	e.RegisterCommands(func(cmds wicore.EnqueuedCommands) {
 		//log.Printf("Commands(%v)", cmds)
 	})
+	e.RegisterDocumentChangedOnDisk(func(doc wicore.Document) {
+		log.Printf("DocumentChangedOnDisk(%s)", doc)
+	})
 	e.RegisterDocumentCreated(func(doc wicore.Document) {
 		log.Printf("DocumentCreated(%s)", doc)
 	})
 	e.RegisterDocumentCursorMoved(func(doc wicore.Document, col, row int) {
 		log.Printf("DocumentCursorMoved(%s, %d, %d)", doc, col, row)
 	})
+	e.RegisterDocumentFileTypeChanged(func(doc wicore.Document, fileType wicore.FileType) {
+		log.Printf("DocumentFileTypeChanged(%s, %s)", doc, fileType)
+	})
+	e.RegisterDocumentSelectionChanged(func(doc wicore.Document, startCol, startRow, endCol, endRow int) {
+		log.Printf("DocumentSelectionChanged(%s, %d, %d, %d, %d, %q)", doc, startCol, startRow, endCol, endRow, e.SelectedText())
+	})
 	e.RegisterEditorKeyboardModeChanged(func(mode wicore.KeyboardMode) {
 		log.Printf("EditorKeyboardModeChanged(%s)", mode)
 	})
 	e.RegisterEditorLanguage(func(l lang.Language) {
 		log.Printf("EditorLanguage(%s)", l)
 	})
+	e.RegisterEditorRegisterChanged(func(name string) {
+		log.Printf("EditorRegisterChanged(%s, %q)", name, e.RegisterContent(name))
+	})
 	e.RegisterTerminalResized(func() {
 		log.Printf("TerminalResized()")
 	})
@@ -66,8 +78,20 @@ func (p *pluginImpl) Init(e wicore.Editor) {
 	e.RegisterWindowResized(func(window wicore.Window) {
 		log.Printf("WindowResized(%s)", window)
 	})
+
+	// A plugin can define its own FileType and the scanners that detect it.
+	e.TriggerCommands(wicore.EnqueuedCommands{
+		[][]string{
+			{"file_type_register", string(codeRust), "name", "*.rs"},
+			{"file_type_register", string(codeRust), "modeline", "rust"},
+		},
+		nil,
+	})
 }
 
+// codeRust is a FileType defined by this plugin.
+const codeRust = wicore.FileType("Code.Rust")
+
 // Close is the place to do full shut down. It is not required to implement
 // this function.
 func (p *pluginImpl) Close() error {
@@ -7,6 +7,7 @@
 package wicore
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/wi-ed/wi/wicore/lang"
@@ -34,6 +35,7 @@ func (c *CommandImpl) Name() string {
 func (c *CommandImpl) Handle(e EditorW, w Window, args ...string) {
 	if c.ExpectedArgs != -1 && len(args) != c.ExpectedArgs {
 		e.ExecuteCommand(w, "alert", c.LongDesc())
+		return
 	}
 	c.HandlerValue(c, e, w, args...)
 }
@@ -53,6 +55,67 @@ func (c *CommandImpl) LongDesc() string {
 	return c.LongDescValue.String()
 }
 
+// MotionImplHandler is the handler to use when coupled with MotionImpl.
+type MotionImplHandler func(c *MotionImpl, e EditorW, w Window, args ...string)
+
+// MotionImpl is the boilerplate Motion implementation. By default, the handler
+// is called as many times as the count.
+type MotionImpl struct {
+	NameValue      string
+	KindValue      MotionKind
+	CountValue     bool // If true, the handler is called once with the count as argument, if any, instead of being called count times.
+	HandlerValue   MotionImplHandler
+	ShortDescValue lang.Map
+	LongDescValue  lang.Map
+}
+
+// Name implements Command.
+func (c *MotionImpl) Name() string {
+	return c.NameValue
+}
+
+// Handle implements Command.
+func (c *MotionImpl) Handle(e EditorW, w Window, args ...string) {
+	count := 1
+	if len(args) > 1 {
+		e.ExecuteCommand(w, "alert", c.LongDesc())
+		return
+	} else if len(args) == 1 {
+		var err error
+		if count, err = strconv.Atoi(args[0]); err != nil || count < 1 {
+			e.ExecuteCommand(w, "alert", c.LongDesc())
+			return
+		}
+	}
+	if c.CountValue {
+		c.HandlerValue(c, e, w, args...)
+		return
+	}
+	for i := 0; i < count; i++ {
+		c.HandlerValue(c, e, w)
+	}
+}
+
+// Category implements Command.
+func (c *MotionImpl) Category(e Editor, w Window) CommandCategory {
+	return WindowCategory
+}
+
+// ShortDesc implements Command.
+func (c *MotionImpl) ShortDesc() string {
+	return c.ShortDescValue.String()
+}
+
+// LongDesc implements Command.
+func (c *MotionImpl) LongDesc() string {
+	return c.LongDescValue.String()
+}
+
+// Kind implements Motion.
+func (c *MotionImpl) Kind() MotionKind {
+	return c.KindValue
+}
+
 // CommandAlias references another command by its name. It's important to not
 // bind directly to the Command reference, so that if a command is replaced by
 // a plugin, that the replacement command is properly called by the alias.
@@ -73,7 +136,7 @@ func (c *CommandAlias) Handle(e EditorW, w Window, args ...string) {
 	// ordering.
 	cmd := GetCommand(e, w, c.CommandValue)
 	if cmd != nil {
-		cmd.Handle(e, w, args...)
+		cmd.Handle(e, w, append(append([]string{}, c.ArgsValue...), args...)...)
 	} else {
 		// TODO(maruel): This makes assumption on "alert".
 		cmd = GetCommand(e, w, "alert")
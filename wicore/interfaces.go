@@ -96,10 +96,26 @@ type EventTrigger interface {
 	//
 	// `callback` is called synchronously after the command is executed.
 	TriggerCommands(cmds EnqueuedCommands)
+	// TriggerDocumentChangedOnDisk is triggered when the file of a Document was
+	// modified by another program.
+	TriggerDocumentChangedOnDisk(doc Document)
 	TriggerDocumentCreated(doc Document)
 	TriggerDocumentCursorMoved(doc Document, col, row int)
+	// TriggerDocumentFileTypeChanged is triggered when the scanners determined
+	// the FileType of a Document.
+	TriggerDocumentFileTypeChanged(doc Document, fileType FileType)
+	// TriggerDocumentSelectionChanged is triggered when the selection in a View
+	// of the Document changed. The selection is from (startCol, startRow) to
+	// (endCol, endRow) inclusively; all are -1 when the selection is cleared.
+	// The text is queried with Editor.SelectedText().
+	TriggerDocumentSelectionChanged(doc Document, startCol, startRow, endCol, endRow int)
 	TriggerEditorKeyboardModeChanged(mode KeyboardMode)
 	TriggerEditorLanguage(l lang.Language)
+	// TriggerEditorRegisterChanged is triggered once per operation modifying
+	// the registers. name is the register written, like "a" or "0"; the unnamed
+	// register and, on a deletion, the registers 1 to 9 may have changed too.
+	// The content is queried with Editor.RegisterContent().
+	TriggerEditorRegisterChanged(name string)
 	TriggerTerminalKeyPressed(k key.Press)
 	TriggerTerminalMetaKeyPressed(k key.Press)
 	TriggerTerminalResized()
@@ -131,6 +147,12 @@ type Editor interface {
 	// Technically, each View could have their own KeyboardMode but in practice
 	// it just creates a cognitive overhead without much benefit.
 	KeyboardMode() KeyboardMode
+	// RegisterContent returns the text in a register, like "a" or "%", "" if it
+	// is empty or invalid.
+	RegisterContent(name string) string
+	// SelectedText returns the text selected in the active View, "" if there is
+	// no selection. The lines of a block selection are joined with "\n".
+	SelectedText() string
 	// Version returns the version number of this build of wi.
 	Version() string
 }
@@ -314,6 +336,47 @@ type Command interface {
 	LongDesc() string
 }
 
+// MotionKind defines how an operator applies to the text a Motion moves over.
+type MotionKind int
+
+const (
+	// MotionExclusive means the character at the end of the motion is not
+	// included, like for "w".
+	MotionExclusive MotionKind = iota
+	// MotionInclusive means the character at the end of the motion is included,
+	// like for "e".
+	MotionInclusive
+	// MotionLinewise means the whole lines moved over are included, like for
+	// "j".
+	MotionLinewise
+)
+
+// Motion is a Command that moves the cursor. A Motion can follow an operator,
+// like "w" in "dw"; the operator then applies to the text between the cursor
+// positions before and after the Motion. A text object, like "iw", is a Motion
+// that selects text instead of moving the cursor; the operator then applies to
+// the selection.
+//
+// The count typed before a Motion, like "3" in "3w", is its only argument, if
+// any.
+type Motion interface {
+	Command
+
+	// Kind returns how an operator applies to the text moved over.
+	Kind() MotionKind
+}
+
+// KeyArgCommand is a Command taking the key typed after it as its only
+// argument, like "a" in "ma" to set the mark a. A count typed before it, like
+// "3" in "3@q", runs it count times.
+type KeyArgCommand interface {
+	Command
+
+	// WaitsForKey returns true if the key typed after the command is its
+	// argument. Otherwise the command runs right away without argument.
+	WaitsForKey(e Editor) bool
+}
+
 // Commands stores the known commands. This is where plugins can add new
 // commands. Each View contains its own Commands.
 type Commands interface {
@@ -346,7 +409,7 @@ type EnqueuedCommands struct {
 // the command window is a Window on its own, instead of a additional input
 // mode on the current Window.
 //
-// TODO(maruel): vim also has visual/select which will be necessary.
+// TODO(maruel): vim also has select which may be necessary.
 type KeyboardMode int
 
 const (
@@ -356,6 +419,16 @@ const (
 	// Insert is the mode where typing letters results in content, not
 	// commands.
 	Insert
+	// Visual is the mode where the motions extend a character selection.
+	Visual
+	// VisualLine is the mode where the motions extend a line selection.
+	VisualLine
+	// VisualBlock is the mode where the motions extend a block selection.
+	VisualBlock
+	// OperatorPending holds the key bindings used after an operator, like "d",
+	// until the motion or the text object is typed. The editor never switches
+	// to this mode; it stays in Normal mode.
+	OperatorPending
 	// AllMode is to bind keys independent of the current mode. It is useful for
 	// function keys, Ctrl-<letter>, arrow keys, etc.
 	AllMode
@@ -372,6 +445,9 @@ type KeyBindings interface {
 	Get(mode KeyboardMode, key key.Press) string
 	// GetAssigned returns all the assigned keys for this mode.
 	GetAssigned(mode KeyboardMode) []key.Press
+	// GetSequence returns the command bound to a sequence of keys, like "gg".
+	// more is true if longer sequences start with these keys.
+	GetSequence(mode KeyboardMode, keys []key.Press) (cmdName string, more bool)
 }
 
 // KeyBindingsW is the writable version of KeyBindings.
@@ -383,6 +459,9 @@ type KeyBindingsW interface {
 	// was already registered and was lost. Set cmdName to "" to remove a key
 	// binding.
 	Set(mode KeyboardMode, key key.Press, cmdName string) bool
+	// SetSequence registers a keyboard mapping for a sequence of keys. A
+	// sequence of a single key is the same as Set().
+	SetSequence(mode KeyboardMode, keys []key.Press, cmdName string) bool
 }
 
 // EditorDetails is sent over the wire to plugins.
@@ -429,9 +508,11 @@ type Plugin interface {
 // categorization of file formats.
 type FileType string
 
-// New types can safely be defined by a plugin.
+// New types can safely be defined by a plugin. The scanners for these types
+// are registered with the command "file_type_register".
 const (
 	Scanning       = FileType("Scanning")
+	Binary         = FileType("Binary")
 	Code           = FileType("Code")   // All files that can be considered "source code" in its broadest meaning.
 	CodeCFamily    = FileType("Code.C") // C covers all C derivatives.
 	CodeCC         = FileType("Code.C.C")
@@ -441,6 +522,12 @@ const (
 	CodeCCPPSource = FileType("Code.C.C++.Source")
 	CodeCCPPHeader = FileType("Code.C.C++.Header")
 	CodeGo         = FileType("Code.Go")
+	CodeMake       = FileType("Code.Make")
+	CodePython     = FileType("Code.Python")
+	CodeShell      = FileType("Code.Shell")
+	Large          = FileType("Large") // Files opened in large file mode are not scanned.
+	Text           = FileType("Text")  // Any text file not otherwise recognized.
+	TextMarkdown   = FileType("Text.Markdown")
 )
 
 // Base returns the base file type for this file type
@@ -26,10 +26,14 @@ func makeEventRegistry() (wicore.EventRegistry, internal.EventTriggerRPC, chan f
 		eventRegistry{
 			deferred:                  c,
 			commands:                  make([]listenerCommands, 0, 64),
+			documentChangedOnDisk:     make([]listenerDocumentChangedOnDisk, 0, 64),
 			documentCreated:           make([]listenerDocumentCreated, 0, 64),
 			documentCursorMoved:       make([]listenerDocumentCursorMoved, 0, 64),
+			documentFileTypeChanged:   make([]listenerDocumentFileTypeChanged, 0, 64),
+			documentSelectionChanged:  make([]listenerDocumentSelectionChanged, 0, 64),
 			editorKeyboardModeChanged: make([]listenerEditorKeyboardModeChanged, 0, 64),
 			editorLanguage:            make([]listenerEditorLanguage, 0, 64),
+			editorRegisterChanged:     make([]listenerEditorRegisterChanged, 0, 64),
 			terminalKeyPressed:        make([]listenerTerminalKeyPressed, 0, 64),
 			terminalMetaKeyPressed:    make([]listenerTerminalMetaKeyPressed, 0, 64),
 			terminalResized:           make([]listenerTerminalResized, 0, 64),
@@ -47,6 +51,11 @@ func (er *eventTriggerRPC) TriggerCommandsRPC(packet internal.PacketCommands, ig
 	return nil
 }
 
+func (er *eventTriggerRPC) TriggerDocumentChangedOnDiskRPC(packet internal.PacketDocumentChangedOnDisk, ignored *int) error {
+	er.triggerDocumentChangedOnDisk(packet.Doc)
+	return nil
+}
+
 func (er *eventTriggerRPC) TriggerDocumentCreatedRPC(packet internal.PacketDocumentCreated, ignored *int) error {
 	er.triggerDocumentCreated(packet.Doc)
 	return nil
@@ -57,6 +66,16 @@ func (er *eventTriggerRPC) TriggerDocumentCursorMovedRPC(packet internal.PacketD
 	return nil
 }
 
+func (er *eventTriggerRPC) TriggerDocumentFileTypeChangedRPC(packet internal.PacketDocumentFileTypeChanged, ignored *int) error {
+	er.triggerDocumentFileTypeChanged(packet.Doc, packet.FileType)
+	return nil
+}
+
+func (er *eventTriggerRPC) TriggerDocumentSelectionChangedRPC(packet internal.PacketDocumentSelectionChanged, ignored *int) error {
+	er.triggerDocumentSelectionChanged(packet.Doc, packet.StartCol, packet.StartRow, packet.EndCol, packet.EndRow)
+	return nil
+}
+
 func (er *eventTriggerRPC) TriggerEditorKeyboardModeChangedRPC(packet internal.PacketEditorKeyboardModeChanged, ignored *int) error {
 	er.triggerEditorKeyboardModeChanged(packet.Mode)
 	return nil
@@ -67,6 +86,11 @@ func (er *eventTriggerRPC) TriggerEditorLanguageRPC(packet internal.PacketEditor
 	return nil
 }
 
+func (er *eventTriggerRPC) TriggerEditorRegisterChangedRPC(packet internal.PacketEditorRegisterChanged, ignored *int) error {
+	er.triggerEditorRegisterChanged(packet.Name)
+	return nil
+}
+
 func (er *eventTriggerRPC) TriggerTerminalKeyPressedRPC(packet internal.PacketTerminalKeyPressed, ignored *int) error {
 	er.triggerTerminalKeyPressed(packet.K)
 	return nil
@@ -106,6 +130,10 @@ func (er *eventRegistry) TriggerCommands(cmds wicore.EnqueuedCommands) {
 	// TODO(maruel): Send it upstream to the editor.
 }
 
+func (er *eventRegistry) TriggerDocumentChangedOnDisk(doc wicore.Document) {
+	// TODO(maruel): Send it upstream to the editor.
+}
+
 func (er *eventRegistry) TriggerDocumentCreated(doc wicore.Document) {
 	// TODO(maruel): Send it upstream to the editor.
 }
@@ -114,6 +142,14 @@ func (er *eventRegistry) TriggerDocumentCursorMoved(doc wicore.Document, col, ro
 	// TODO(maruel): Send it upstream to the editor.
 }
 
+func (er *eventRegistry) TriggerDocumentFileTypeChanged(doc wicore.Document, fileType wicore.FileType) {
+	// TODO(maruel): Send it upstream to the editor.
+}
+
+func (er *eventRegistry) TriggerDocumentSelectionChanged(doc wicore.Document, startCol, startRow, endCol, endRow int) {
+	// TODO(maruel): Send it upstream to the editor.
+}
+
 func (er *eventRegistry) TriggerEditorKeyboardModeChanged(mode wicore.KeyboardMode) {
 	// TODO(maruel): Send it upstream to the editor.
 }
@@ -122,6 +158,10 @@ func (er *eventRegistry) TriggerEditorLanguage(l lang.Language) {
 	// TODO(maruel): Send it upstream to the editor.
 }
 
+func (er *eventRegistry) TriggerEditorRegisterChanged(name string) {
+	// TODO(maruel): Send it upstream to the editor.
+}
+
 func (er *eventRegistry) TriggerTerminalKeyPressed(k key.Press) {
 	// TODO(maruel): Send it upstream to the editor.
 }
@@ -155,6 +195,11 @@ type listenerCommands struct {
 	callback func(cmds wicore.EnqueuedCommands)
 }
 
+type listenerDocumentChangedOnDisk struct {
+	id       int
+	callback func(doc wicore.Document)
+}
+
 type listenerDocumentCreated struct {
 	id       int
 	callback func(doc wicore.Document)
@@ -165,6 +210,16 @@ type listenerDocumentCursorMoved struct {
 	callback func(doc wicore.Document, col, row int)
 }
 
+type listenerDocumentFileTypeChanged struct {
+	id       int
+	callback func(doc wicore.Document, fileType wicore.FileType)
+}
+
+type listenerDocumentSelectionChanged struct {
+	id       int
+	callback func(doc wicore.Document, startCol, startRow, endCol, endRow int)
+}
+
 type listenerEditorKeyboardModeChanged struct {
 	id       int
 	callback func(mode wicore.KeyboardMode)
@@ -175,6 +230,11 @@ type listenerEditorLanguage struct {
 	callback func(l lang.Language)
 }
 
+type listenerEditorRegisterChanged struct {
+	id       int
+	callback func(name string)
+}
+
 type listenerTerminalKeyPressed struct {
 	id       int
 	callback func(k key.Press)
@@ -219,10 +279,14 @@ type eventRegistry struct {
 	deferred chan<- func()
 
 	commands                  []listenerCommands
+	documentChangedOnDisk     []listenerDocumentChangedOnDisk
 	documentCreated           []listenerDocumentCreated
 	documentCursorMoved       []listenerDocumentCursorMoved
+	documentFileTypeChanged   []listenerDocumentFileTypeChanged
+	documentSelectionChanged  []listenerDocumentSelectionChanged
 	editorKeyboardModeChanged []listenerEditorKeyboardModeChanged
 	editorLanguage            []listenerEditorLanguage
+	editorRegisterChanged     []listenerEditorRegisterChanged
 	terminalKeyPressed        []listenerTerminalKeyPressed
 	terminalMetaKeyPressed    []listenerTerminalMetaKeyPressed
 	terminalResized           []listenerTerminalResized
@@ -247,6 +311,14 @@ func (er *eventRegistry) unregister(eventID int) {
 			}
 		}
 	case 0x2000000:
+		for index, value := range er.documentChangedOnDisk {
+			if value.id == eventID {
+				copy(er.documentChangedOnDisk[index:], er.documentChangedOnDisk[index+1:])
+				er.documentChangedOnDisk = er.documentChangedOnDisk[0 : len(er.documentChangedOnDisk)-1]
+				return
+			}
+		}
+	case 0x3000000:
 		for index, value := range er.documentCreated {
 			if value.id == eventID {
 				copy(er.documentCreated[index:], er.documentCreated[index+1:])
@@ -254,7 +326,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x3000000:
+	case 0x4000000:
 		for index, value := range er.documentCursorMoved {
 			if value.id == eventID {
 				copy(er.documentCursorMoved[index:], er.documentCursorMoved[index+1:])
@@ -262,7 +334,23 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x4000000:
+	case 0x5000000:
+		for index, value := range er.documentFileTypeChanged {
+			if value.id == eventID {
+				copy(er.documentFileTypeChanged[index:], er.documentFileTypeChanged[index+1:])
+				er.documentFileTypeChanged = er.documentFileTypeChanged[0 : len(er.documentFileTypeChanged)-1]
+				return
+			}
+		}
+	case 0x6000000:
+		for index, value := range er.documentSelectionChanged {
+			if value.id == eventID {
+				copy(er.documentSelectionChanged[index:], er.documentSelectionChanged[index+1:])
+				er.documentSelectionChanged = er.documentSelectionChanged[0 : len(er.documentSelectionChanged)-1]
+				return
+			}
+		}
+	case 0x7000000:
 		for index, value := range er.editorKeyboardModeChanged {
 			if value.id == eventID {
 				copy(er.editorKeyboardModeChanged[index:], er.editorKeyboardModeChanged[index+1:])
@@ -270,7 +358,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x5000000:
+	case 0x8000000:
 		for index, value := range er.editorLanguage {
 			if value.id == eventID {
 				copy(er.editorLanguage[index:], er.editorLanguage[index+1:])
@@ -278,7 +366,15 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x6000000:
+	case 0x9000000:
+		for index, value := range er.editorRegisterChanged {
+			if value.id == eventID {
+				copy(er.editorRegisterChanged[index:], er.editorRegisterChanged[index+1:])
+				er.editorRegisterChanged = er.editorRegisterChanged[0 : len(er.editorRegisterChanged)-1]
+				return
+			}
+		}
+	case 0xa000000:
 		for index, value := range er.terminalKeyPressed {
 			if value.id == eventID {
 				copy(er.terminalKeyPressed[index:], er.terminalKeyPressed[index+1:])
@@ -286,7 +382,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x7000000:
+	case 0xb000000:
 		for index, value := range er.terminalMetaKeyPressed {
 			if value.id == eventID {
 				copy(er.terminalMetaKeyPressed[index:], er.terminalMetaKeyPressed[index+1:])
@@ -294,7 +390,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x8000000:
+	case 0xc000000:
 		for index, value := range er.terminalResized {
 			if value.id == eventID {
 				copy(er.terminalResized[index:], er.terminalResized[index+1:])
@@ -302,7 +398,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x9000000:
+	case 0xd000000:
 		for index, value := range er.viewActivated {
 			if value.id == eventID {
 				copy(er.viewActivated[index:], er.viewActivated[index+1:])
@@ -310,7 +406,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0xa000000:
+	case 0xe000000:
 		for index, value := range er.viewCreated {
 			if value.id == eventID {
 				copy(er.viewCreated[index:], er.viewCreated[index+1:])
@@ -318,7 +414,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0xb000000:
+	case 0xf000000:
 		for index, value := range er.windowCreated {
 			if value.id == eventID {
 				copy(er.windowCreated[index:], er.windowCreated[index+1:])
@@ -326,7 +422,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0xc000000:
+	case 0x10000000:
 		for index, value := range er.windowResized {
 			if value.id == eventID {
 				copy(er.windowResized[index:], er.windowResized[index+1:])
@@ -346,13 +442,22 @@ func (er *eventRegistry) RegisterCommands(callback func(cmds wicore.EnqueuedComm
 	return &eventListener{er, i | 0x1000000}
 }
 
+func (er *eventRegistry) RegisterDocumentChangedOnDisk(callback func(doc wicore.Document)) wicore.EventListener {
+	er.lock.Lock()
+	defer er.lock.Unlock()
+	i := er.nextID
+	er.nextID++
+	er.documentChangedOnDisk = append(er.documentChangedOnDisk, listenerDocumentChangedOnDisk{i, callback})
+	return &eventListener{er, i | 0x2000000}
+}
+
 func (er *eventRegistry) RegisterDocumentCreated(callback func(doc wicore.Document)) wicore.EventListener {
 	er.lock.Lock()
 	defer er.lock.Unlock()
 	i := er.nextID
 	er.nextID++
 	er.documentCreated = append(er.documentCreated, listenerDocumentCreated{i, callback})
-	return &eventListener{er, i | 0x2000000}
+	return &eventListener{er, i | 0x3000000}
 }
 
 func (er *eventRegistry) RegisterDocumentCursorMoved(callback func(doc wicore.Document, col, row int)) wicore.EventListener {
@@ -361,7 +466,25 @@ func (er *eventRegistry) RegisterDocumentCursorMoved(callback func(doc wicore.Do
 	i := er.nextID
 	er.nextID++
 	er.documentCursorMoved = append(er.documentCursorMoved, listenerDocumentCursorMoved{i, callback})
-	return &eventListener{er, i | 0x3000000}
+	return &eventListener{er, i | 0x4000000}
+}
+
+func (er *eventRegistry) RegisterDocumentFileTypeChanged(callback func(doc wicore.Document, fileType wicore.FileType)) wicore.EventListener {
+	er.lock.Lock()
+	defer er.lock.Unlock()
+	i := er.nextID
+	er.nextID++
+	er.documentFileTypeChanged = append(er.documentFileTypeChanged, listenerDocumentFileTypeChanged{i, callback})
+	return &eventListener{er, i | 0x5000000}
+}
+
+func (er *eventRegistry) RegisterDocumentSelectionChanged(callback func(doc wicore.Document, startCol, startRow, endCol, endRow int)) wicore.EventListener {
+	er.lock.Lock()
+	defer er.lock.Unlock()
+	i := er.nextID
+	er.nextID++
+	er.documentSelectionChanged = append(er.documentSelectionChanged, listenerDocumentSelectionChanged{i, callback})
+	return &eventListener{er, i | 0x6000000}
 }
 
 func (er *eventRegistry) RegisterEditorKeyboardModeChanged(callback func(mode wicore.KeyboardMode)) wicore.EventListener {
@@ -370,7 +493,7 @@ func (er *eventRegistry) RegisterEditorKeyboardModeChanged(callback func(mode wi
 	i := er.nextID
 	er.nextID++
 	er.editorKeyboardModeChanged = append(er.editorKeyboardModeChanged, listenerEditorKeyboardModeChanged{i, callback})
-	return &eventListener{er, i | 0x4000000}
+	return &eventListener{er, i | 0x7000000}
 }
 
 func (er *eventRegistry) RegisterEditorLanguage(callback func(l lang.Language)) wicore.EventListener {
@@ -379,7 +502,16 @@ func (er *eventRegistry) RegisterEditorLanguage(callback func(l lang.Language))
 	i := er.nextID
 	er.nextID++
 	er.editorLanguage = append(er.editorLanguage, listenerEditorLanguage{i, callback})
-	return &eventListener{er, i | 0x5000000}
+	return &eventListener{er, i | 0x8000000}
+}
+
+func (er *eventRegistry) RegisterEditorRegisterChanged(callback func(name string)) wicore.EventListener {
+	er.lock.Lock()
+	defer er.lock.Unlock()
+	i := er.nextID
+	er.nextID++
+	er.editorRegisterChanged = append(er.editorRegisterChanged, listenerEditorRegisterChanged{i, callback})
+	return &eventListener{er, i | 0x9000000}
 }
 
 func (er *eventRegistry) RegisterTerminalKeyPressed(callback func(k key.Press)) wicore.EventListener {
@@ -388,7 +520,7 @@ func (er *eventRegistry) RegisterTerminalKeyPressed(callback func(k key.Press))
 	i := er.nextID
 	er.nextID++
 	er.terminalKeyPressed = append(er.terminalKeyPressed, listenerTerminalKeyPressed{i, callback})
-	return &eventListener{er, i | 0x6000000}
+	return &eventListener{er, i | 0xa000000}
 }
 
 func (er *eventRegistry) RegisterTerminalMetaKeyPressed(callback func(k key.Press)) wicore.EventListener {
@@ -397,7 +529,7 @@ func (er *eventRegistry) RegisterTerminalMetaKeyPressed(callback func(k key.Pres
 	i := er.nextID
 	er.nextID++
 	er.terminalMetaKeyPressed = append(er.terminalMetaKeyPressed, listenerTerminalMetaKeyPressed{i, callback})
-	return &eventListener{er, i | 0x7000000}
+	return &eventListener{er, i | 0xb000000}
 }
 
 func (er *eventRegistry) RegisterTerminalResized(callback func()) wicore.EventListener {
@@ -406,7 +538,7 @@ func (er *eventRegistry) RegisterTerminalResized(callback func()) wicore.EventLi
 	i := er.nextID
 	er.nextID++
 	er.terminalResized = append(er.terminalResized, listenerTerminalResized{i, callback})
-	return &eventListener{er, i | 0x8000000}
+	return &eventListener{er, i | 0xc000000}
 }
 
 func (er *eventRegistry) RegisterViewActivated(callback func(view wicore.View)) wicore.EventListener {
@@ -415,7 +547,7 @@ func (er *eventRegistry) RegisterViewActivated(callback func(view wicore.View))
 	i := er.nextID
 	er.nextID++
 	er.viewActivated = append(er.viewActivated, listenerViewActivated{i, callback})
-	return &eventListener{er, i | 0x9000000}
+	return &eventListener{er, i | 0xd000000}
 }
 
 func (er *eventRegistry) RegisterViewCreated(callback func(view wicore.View)) wicore.EventListener {
@@ -424,7 +556,7 @@ func (er *eventRegistry) RegisterViewCreated(callback func(view wicore.View)) wi
 	i := er.nextID
 	er.nextID++
 	er.viewCreated = append(er.viewCreated, listenerViewCreated{i, callback})
-	return &eventListener{er, i | 0xa000000}
+	return &eventListener{er, i | 0xe000000}
 }
 
 func (er *eventRegistry) RegisterWindowCreated(callback func(window wicore.Window)) wicore.EventListener {
@@ -433,7 +565,7 @@ func (er *eventRegistry) RegisterWindowCreated(callback func(window wicore.Windo
 	i := er.nextID
 	er.nextID++
 	er.windowCreated = append(er.windowCreated, listenerWindowCreated{i, callback})
-	return &eventListener{er, i | 0xb000000}
+	return &eventListener{er, i | 0xf000000}
 }
 
 func (er *eventRegistry) RegisterWindowResized(callback func(window wicore.Window)) wicore.EventListener {
@@ -442,7 +574,7 @@ func (er *eventRegistry) RegisterWindowResized(callback func(window wicore.Windo
 	i := er.nextID
 	er.nextID++
 	er.windowResized = append(er.windowResized, listenerWindowResized{i, callback})
-	return &eventListener{er, i | 0xc000000}
+	return &eventListener{er, i | 0x10000000}
 }
 
 func (er *eventRegistry) triggerCommands(cmds wicore.EnqueuedCommands) {
@@ -462,6 +594,23 @@ func (er *eventRegistry) triggerCommands(cmds wicore.EnqueuedCommands) {
 	}
 }
 
+func (er *eventRegistry) triggerDocumentChangedOnDisk(doc wicore.Document) {
+	er.deferred <- func() {
+		items := func() []func(doc wicore.Document) {
+			er.lock.Lock()
+			defer er.lock.Unlock()
+			items := make([]func(doc wicore.Document), 0, len(er.documentChangedOnDisk))
+			for _, item := range er.documentChangedOnDisk {
+				items = append(items, item.callback)
+			}
+			return items
+		}()
+		for _, item := range items {
+			item(doc)
+		}
+	}
+}
+
 func (er *eventRegistry) triggerDocumentCreated(doc wicore.Document) {
 	er.deferred <- func() {
 		items := func() []func(doc wicore.Document) {
@@ -496,6 +645,40 @@ func (er *eventRegistry) triggerDocumentCursorMoved(doc wicore.Document, col, ro
 	}
 }
 
+func (er *eventRegistry) triggerDocumentFileTypeChanged(doc wicore.Document, fileType wicore.FileType) {
+	er.deferred <- func() {
+		items := func() []func(doc wicore.Document, fileType wicore.FileType) {
+			er.lock.Lock()
+			defer er.lock.Unlock()
+			items := make([]func(doc wicore.Document, fileType wicore.FileType), 0, len(er.documentFileTypeChanged))
+			for _, item := range er.documentFileTypeChanged {
+				items = append(items, item.callback)
+			}
+			return items
+		}()
+		for _, item := range items {
+			item(doc, fileType)
+		}
+	}
+}
+
+func (er *eventRegistry) triggerDocumentSelectionChanged(doc wicore.Document, startCol, startRow, endCol, endRow int) {
+	er.deferred <- func() {
+		items := func() []func(doc wicore.Document, startCol, startRow, endCol, endRow int) {
+			er.lock.Lock()
+			defer er.lock.Unlock()
+			items := make([]func(doc wicore.Document, startCol, startRow, endCol, endRow int), 0, len(er.documentSelectionChanged))
+			for _, item := range er.documentSelectionChanged {
+				items = append(items, item.callback)
+			}
+			return items
+		}()
+		for _, item := range items {
+			item(doc, startCol, startRow, endCol, endRow)
+		}
+	}
+}
+
 func (er *eventRegistry) triggerEditorKeyboardModeChanged(mode wicore.KeyboardMode) {
 	er.deferred <- func() {
 		items := func() []func(mode wicore.KeyboardMode) {
@@ -530,6 +713,23 @@ func (er *eventRegistry) triggerEditorLanguage(l lang.Language) {
 	}
 }
 
+func (er *eventRegistry) triggerEditorRegisterChanged(name string) {
+	er.deferred <- func() {
+		items := func() []func(name string) {
+			er.lock.Lock()
+			defer er.lock.Unlock()
+			items := make([]func(name string), 0, len(er.editorRegisterChanged))
+			for _, item := range er.editorRegisterChanged {
+				items = append(items, item.callback)
+			}
+			return items
+		}()
+		for _, item := range items {
+			item(name)
+		}
+	}
+}
+
 func (er *eventRegistry) triggerTerminalKeyPressed(k key.Press) {
 	er.deferred <- func() {
 		items := func() []func(k key.Press) {
@@ -95,6 +95,7 @@ type editorProxy struct {
 	factoryNames []string
 	keyboardMode wicore.KeyboardMode
 	version      string
+	client       *rpc.Client // Queries the editor through internal.EditorRPC. nil if not supported.
 }
 
 func (e *editorProxy) ID() string {
@@ -125,6 +126,26 @@ func (e *editorProxy) KeyboardMode() wicore.KeyboardMode {
 	return e.keyboardMode
 }
 
+func (e *editorProxy) RegisterContent(name string) string {
+	out := ""
+	if e.client != nil {
+		if err := e.client.Call("EditorRPC.RegisterContent", name, &out); err != nil {
+			log.Printf("RPC RegisterContent call failure: %s", err)
+		}
+	}
+	return out
+}
+
+func (e *editorProxy) SelectedText() string {
+	out := ""
+	if e.client != nil {
+		if err := e.client.Call("EditorRPC.SelectedText", 0, &out); err != nil {
+			log.Printf("RPC SelectedText call failure: %s", err)
+		}
+	}
+	return out
+}
+
 func (e *editorProxy) Version() string {
 	return e.version
 }
@@ -145,6 +166,12 @@ func Main(plugin wicore.Plugin) int {
 	// kill the plugin process in this case.
 	conn := wicore.MakeReadWriteCloser(os.Stdin, os.Stdout)
 	server := rpc.NewServer()
+	// The editor serves the queries on the file descriptors 3 and 4, when
+	// supported by the OS.
+	var client *rpc.Client
+	if os.Getenv("WIRPC") == "1" {
+		client = rpc.NewClient(wicore.MakeReadWriteCloser(os.NewFile(4, "editor"), os.NewFile(3, "editor")))
+	}
 	reg, rpc, deferred := makeEventRegistry()
 	e := &editorProxy{
 		reg,
@@ -154,6 +181,7 @@ func Main(plugin wicore.Plugin) int {
 		[]string{},
 		wicore.Normal,
 		"",
+		client,
 	}
 	p := &pluginRPC{
 		e:      e,
@@ -0,0 +1,138 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package text
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+// lazyLeaf is the size in bytes of the leaves of a Buffer loaded from a
+// Source. It is much larger than maxLeaf so that indexing a multi-gigabytes
+// file doesn't create millions of nodes.
+const lazyLeaf = 64 * 1024
+
+// lazyCacheSize is the number of lazy leaves kept in memory by a Source.
+const lazyCacheSize = 64
+
+// Source is the read-only backing store of Buffers too large to be held in
+// memory, usually a file. Only the lines and runes of the content are counted
+// when the Buffer is created; the bytes themselves are read on demand and
+// only the recently used ones are cached.
+//
+// The content of the io.ReaderAt must not change while Buffers reference it.
+// A Source is safe for concurrent use, so these Buffers are immutable
+// snapshots like any other.
+type Source struct {
+	r io.ReaderAt
+
+	lock  sync.Mutex
+	cache map[*node]*list.Element
+	lru   *list.List // Of *cachedLeaf, the most recently used first.
+	err   error
+}
+
+type cachedLeaf struct {
+	n    *node
+	data []byte
+}
+
+// NewSource returns a Source reading from r.
+func NewSource(r io.ReaderAt) *Source {
+	return &Source{
+		r:     r,
+		cache: map[*node]*list.Element{},
+		lru:   list.New(),
+	}
+}
+
+// Load scans up to n bytes at offset off and returns them as a Buffer.
+//
+// The returned Buffer may be shorter than n so a multi-bytes UTF-8 sequence
+// is never split; the next call should start at off+Len(). An empty Buffer
+// means the end of the Source was reached.
+func (s *Source) Load(off int64, n int) (Buffer, error) {
+	var leaves []*node
+	buf := make([]byte, lazyLeaf)
+	for n > 0 {
+		size := lazyLeaf
+		if size > n {
+			size = n
+		}
+		i, err := s.r.ReadAt(buf[:size], off)
+		b := buf[:i]
+		if err == nil {
+			// Stop on a rune boundary, so the runes are counted correctly.
+			for j := len(b) - 1; j >= 0 && j > len(b)-utf8.UTFMax; j-- {
+				if utf8.RuneStart(b[j]) {
+					if !utf8.FullRune(b[j:]) {
+						b = b[:j]
+					}
+					break
+				}
+			}
+		}
+		if len(b) == 0 {
+			break
+		}
+		leaves = append(leaves, s.newLeaf(off, b))
+		off += int64(len(b))
+		n -= len(b)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Buffer{build(leaves)}, err
+		}
+	}
+	return Buffer{build(leaves)}, nil
+}
+
+// Err returns the first error that happened while reading the content on
+// demand. The content that couldn't be read is replaced with zeros.
+func (s *Source) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+// newLeaf returns a lazy leaf of b, which is located at offset off. b is not
+// referenced.
+func (s *Source) newLeaf(off int64, b []byte) *node {
+	return &node{
+		src:    s,
+		off:    off,
+		length: len(b),
+		lines:  bytes.Count(b, newLine),
+		runes:  utf8.RuneCount(b),
+	}
+}
+
+// read returns the content of the lazy leaf n.
+func (s *Source) read(n *node) []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, ok := s.cache[n]; ok {
+		s.lru.MoveToFront(e)
+		return e.Value.(*cachedLeaf).data
+	}
+	data := make([]byte, n.length)
+	if i, err := s.r.ReadAt(data, n.off); i != len(data) && s.err == nil {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		s.err = err
+	}
+	s.cache[n] = s.lru.PushFront(&cachedLeaf{n, data})
+	if s.lru.Len() > lazyCacheSize {
+		e := s.lru.Back()
+		s.lru.Remove(e)
+		delete(s.cache, e.Value.(*cachedLeaf).n)
+	}
+	return data
+}
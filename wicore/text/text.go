@@ -0,0 +1,499 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package text implements the text storage engine used by documents.
+//
+// Buffer is a persistent rope: the text is split in chunks stored in the leaves
+// of a balanced binary tree. Every modification returns a new Buffer and leaves
+// the original untouched, sharing all the unmodified chunks. This means a
+// Buffer is an immutable snapshot that can be read concurrently from any
+// goroutine without locking, for example to save or search a document while
+// the user keeps on typing.
+//
+// All offsets are in bytes unless specified otherwise. Lines are separated by
+// "\n", which is included in the byte count but is not returned by Line().
+package text
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// maxLeaf is the maximum size in bytes of a leaf chunk. It is a trade off
+// between the tree depth and the cost of splitting a leaf, which requires
+// recounting the lines and runes of the two halves.
+const maxLeaf = 4096
+
+var newLine = []byte{'\n'}
+
+// node is either a leaf, which has data, or a branch, which has exactly two
+// children. Nodes are never modified once created.
+//
+// A lazy leaf has no data; its content is read on demand from src at offset
+// off. See Source.
+type node struct {
+	left   *node
+	right  *node
+	data   []byte  // Only set on leaves that are not lazy.
+	src    *Source // Only set on lazy leaves.
+	off    int64   // Offset of a lazy leaf in src.
+	length int     // Length in bytes.
+	lines  int     // Number of "\n".
+	runes  int     // Number of runes.
+	height int     // 0 for leaves.
+}
+
+func newLeaf(b []byte) *node {
+	return &node{
+		data:   b,
+		length: len(b),
+		lines:  bytes.Count(b, newLine),
+		runes:  utf8.RuneCount(b),
+	}
+}
+
+// bytes returns the content of a leaf, reading it from its Source if it is
+// lazy.
+func (n *node) bytes() []byte {
+	if n.src == nil {
+		return n.data
+	}
+	return n.src.read(n)
+}
+
+func newBranch(l, r *node) *node {
+	h := l.height
+	if r.height > h {
+		h = r.height
+	}
+	return &node{
+		left:   l,
+		right:  r,
+		length: l.length + r.length,
+		lines:  l.lines + r.lines,
+		runes:  l.runes + r.runes,
+		height: h + 1,
+	}
+}
+
+// chunk cuts b into leaves, never splitting a multi-bytes UTF-8 sequence. b is
+// referenced, not copied.
+func chunk(b []byte) []*node {
+	out := make([]*node, 0, len(b)/maxLeaf+1)
+	for len(b) != 0 {
+		end := len(b)
+		if end > maxLeaf {
+			end = maxLeaf
+			for end > maxLeaf/2 && !utf8.RuneStart(b[end]) {
+				end--
+			}
+		}
+		out = append(out, newLeaf(b[:end:end]))
+		b = b[end:]
+	}
+	return out
+}
+
+// build returns a balanced tree out of leaves.
+func build(leaves []*node) *node {
+	switch len(leaves) {
+	case 0:
+		return nil
+	case 1:
+		return leaves[0]
+	default:
+		mid := len(leaves) / 2
+		return newBranch(build(leaves[:mid]), build(leaves[mid:]))
+	}
+}
+
+// balance returns a branch of l and r, doing a rotation if necessary. l and r
+// heights must not differ by more than 2.
+func balance(l, r *node) *node {
+	if l.height > r.height+1 {
+		if l.left.height >= l.right.height {
+			return newBranch(l.left, newBranch(l.right, r))
+		}
+		return newBranch(newBranch(l.left, l.right.left), newBranch(l.right.right, r))
+	}
+	if r.height > l.height+1 {
+		if r.right.height >= r.left.height {
+			return newBranch(newBranch(l, r.left), r.right)
+		}
+		return newBranch(newBranch(l, r.left.left), newBranch(r.left.right, r.right))
+	}
+	return newBranch(l, r)
+}
+
+// isSmall returns true if n is a leaf that should be merged with its neighbor
+// when possible. This is what happens when typing one character at a time.
+func isSmall(n *node) bool {
+	return n.height == 0 && n.length < maxLeaf/2
+}
+
+// concat returns the concatenation of l and r as a balanced tree.
+func concat(l, r *node) *node {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+	if l.height == 0 && r.height == 0 && l.length+r.length <= maxLeaf {
+		b := make([]byte, 0, l.length+r.length)
+		b = append(b, l.bytes()...)
+		b = append(b, r.bytes()...)
+		return newLeaf(b)
+	}
+	if l.height > r.height+1 || (l.height != 0 && isSmall(r)) {
+		return balance(l.left, concat(l.right, r))
+	}
+	if r.height > l.height+1 || (r.height != 0 && isSmall(l)) {
+		return balance(concat(l, r.left), r.right)
+	}
+	return newBranch(l, r)
+}
+
+// split returns the part before offset i and the part starting at offset i.
+func split(n *node, i int) (*node, *node) {
+	if n == nil || i <= 0 {
+		return nil, n
+	}
+	if i >= n.length {
+		return n, nil
+	}
+	if n.height == 0 {
+		if n.src != nil {
+			b := n.bytes()
+			return n.src.newLeaf(n.off, b[:i]), n.src.newLeaf(n.off+int64(i), b[i:])
+		}
+		return newLeaf(n.data[:i:i]), newLeaf(n.data[i:])
+	}
+	if i == n.left.length {
+		return n.left, n.right
+	}
+	if i < n.left.length {
+		ll, lr := split(n.left, i)
+		return ll, concat(lr, n.right)
+	}
+	rl, rr := split(n.right, i-n.left.length)
+	return concat(n.left, rl), rr
+}
+
+// walk calls f for each chunk overlapping [start, end) in order. It stops early
+// when f returns false.
+func walk(n *node, start, end int, f func(b []byte) bool) bool {
+	if n == nil || start >= end {
+		return true
+	}
+	if n.height == 0 {
+		return f(n.bytes()[start:end])
+	}
+	if start < n.left.length {
+		e := end
+		if e > n.left.length {
+			e = n.left.length
+		}
+		if !walk(n.left, start, e, f) {
+			return false
+		}
+	}
+	if end > n.left.length {
+		s := start - n.left.length
+		if s < 0 {
+			s = 0
+		}
+		return walk(n.right, s, end-n.left.length, f)
+	}
+	return true
+}
+
+// nthNewLine returns the offset of the k-th "\n", 1-based.
+//
+// The content of a lazy leaf may not match its counts anymore if its Source
+// failed to be read. The end of the leaf is then returned.
+func nthNewLine(n *node, k int) int {
+	offset := 0
+	for n.height != 0 {
+		if k <= n.left.lines {
+			n = n.left
+		} else {
+			k -= n.left.lines
+			offset += n.left.length
+			n = n.right
+		}
+	}
+	for i, c := range n.bytes() {
+		if c == '\n' {
+			k--
+			if k == 0 {
+				return offset + i
+			}
+		}
+	}
+	return offset + n.length - 1
+}
+
+// Buffer is an immutable text buffer. The zero value is an empty buffer.
+type Buffer struct {
+	root *node
+}
+
+// New returns a Buffer with the content b.
+//
+// b is referenced and not copied, so it must not be modified afterward. This
+// permits loading large files without doubling the memory usage.
+func New(b []byte) Buffer {
+	return Buffer{build(chunk(b))}
+}
+
+// NewString returns a Buffer with the content s.
+func NewString(s string) Buffer {
+	return New([]byte(s))
+}
+
+func (b Buffer) String() string {
+	return string(b.Bytes())
+}
+
+// Len returns the length in bytes.
+func (b Buffer) Len() int {
+	if b.root == nil {
+		return 0
+	}
+	return b.root.length
+}
+
+// RuneCount returns the number of runes.
+func (b Buffer) RuneCount() int {
+	if b.root == nil {
+		return 0
+	}
+	return b.root.runes
+}
+
+// LineCount returns the number of lines. It is the number of "\n" plus one, so
+// an empty buffer has one empty line.
+func (b Buffer) LineCount() int {
+	if b.root == nil {
+		return 1
+	}
+	return b.root.lines + 1
+}
+
+// Bytes returns a copy of the whole content.
+func (b Buffer) Bytes() []byte {
+	return b.Range(0, b.Len())
+}
+
+// Range returns a copy of the bytes in [start, end).
+func (b Buffer) Range(start, end int) []byte {
+	start, end = b.clamp(start, end)
+	out := make([]byte, 0, end-start)
+	walk(b.root, start, end, func(c []byte) bool {
+		out = append(out, c...)
+		return true
+	})
+	return out
+}
+
+// Walk calls f for each chunk of the bytes in [start, end) in order, without
+// copying them. The chunks must not be modified. Walk stops early when f
+// returns false.
+func (b Buffer) Walk(start, end int, f func(chunk []byte) bool) {
+	start, end = b.clamp(start, end)
+	walk(b.root, start, end, f)
+}
+
+// WriteTo implements io.WriterTo.
+func (b Buffer) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	var err error
+	walk(b.root, 0, b.Len(), func(c []byte) bool {
+		var i int
+		i, err = w.Write(c)
+		n += int64(i)
+		return err == nil
+	})
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt.
+func (b Buffer) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("text: negative offset")
+	}
+	if off >= int64(b.Len()) {
+		return 0, io.EOF
+	}
+	n := 0
+	start, end := b.clamp(int(off), int(off)+len(p))
+	walk(b.root, start, end, func(c []byte) bool {
+		n += copy(p[n:], c)
+		return true
+	})
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Insert returns a new Buffer with p inserted at offset. p is copied.
+func (b Buffer) Insert(offset int, p []byte) Buffer {
+	if len(p) == 0 {
+		return b
+	}
+	offset, _ = b.clamp(offset, offset)
+	c := make([]byte, len(p))
+	copy(c, p)
+	l, r := split(b.root, offset)
+	return Buffer{concat(concat(l, build(chunk(c))), r)}
+}
+
+// InsertString returns a new Buffer with s inserted at offset.
+func (b Buffer) InsertString(offset int, s string) Buffer {
+	return b.Insert(offset, []byte(s))
+}
+
+// Delete returns a new Buffer with the bytes in [start, end) removed.
+func (b Buffer) Delete(start, end int) Buffer {
+	start, end = b.clamp(start, end)
+	if start == end {
+		return b
+	}
+	l, _ := split(b.root, start)
+	_, r := split(b.root, end)
+	return Buffer{concat(l, r)}
+}
+
+// Slice returns a new Buffer with only the bytes in [start, end).
+func (b Buffer) Slice(start, end int) Buffer {
+	start, end = b.clamp(start, end)
+	_, r := split(b.root, start)
+	l, _ := split(r, end-start)
+	return Buffer{l}
+}
+
+// Concat returns a new Buffer with the content of o appended.
+func (b Buffer) Concat(o Buffer) Buffer {
+	return Buffer{concat(b.root, o.root)}
+}
+
+// LineStart returns the offset of the first byte of a line, 0-based. Returns
+// Len() if the line is past the end.
+func (b Buffer) LineStart(line int) int {
+	if line <= 0 {
+		return 0
+	}
+	if line >= b.LineCount() {
+		return b.Len()
+	}
+	return nthNewLine(b.root, line) + 1
+}
+
+// LineEnd returns the offset of the "\n" terminating a line, or Len() for the
+// last line.
+func (b Buffer) LineEnd(line int) int {
+	if line < 0 {
+		line = 0
+	}
+	if line+1 >= b.LineCount() {
+		return b.Len()
+	}
+	return nthNewLine(b.root, line+1)
+}
+
+// Line returns the content of a line without the "\n".
+func (b Buffer) Line(line int) string {
+	return string(b.Range(b.LineStart(line), b.LineEnd(line)))
+}
+
+// LineAt returns the line containing the byte at offset.
+func (b Buffer) LineAt(offset int) int {
+	offset, _ = b.clamp(offset, offset)
+	line := 0
+	n := b.root
+	for n != nil && n.height != 0 {
+		if offset < n.left.length {
+			n = n.left
+		} else {
+			offset -= n.left.length
+			line += n.left.lines
+			n = n.right
+		}
+	}
+	if n != nil {
+		line += bytes.Count(n.bytes()[:offset], newLine)
+	}
+	return line
+}
+
+// RuneIndex returns the number of runes before offset.
+func (b Buffer) RuneIndex(offset int) int {
+	offset, _ = b.clamp(offset, offset)
+	runes := 0
+	n := b.root
+	for n != nil && n.height != 0 {
+		if offset < n.left.length {
+			n = n.left
+		} else {
+			offset -= n.left.length
+			runes += n.left.runes
+			n = n.right
+		}
+	}
+	if n != nil {
+		runes += utf8.RuneCount(n.bytes()[:offset])
+	}
+	return runes
+}
+
+// RuneOffset returns the offset of the rune at index i. It is the reverse of
+// RuneIndex. Returns Len() if i is past the end.
+func (b Buffer) RuneOffset(i int) int {
+	if i <= 0 {
+		return 0
+	}
+	if i >= b.RuneCount() {
+		return b.Len()
+	}
+	offset := 0
+	n := b.root
+	for n.height != 0 {
+		if i < n.left.runes {
+			n = n.left
+		} else {
+			i -= n.left.runes
+			offset += n.left.length
+			n = n.right
+		}
+	}
+	for j := range string(n.bytes()) {
+		if i == 0 {
+			return offset + j
+		}
+		i--
+	}
+	return offset + n.length
+}
+
+// clamp constrains start and end in [0, Len()] with start <= end.
+func (b Buffer) clamp(start, end int) (int, int) {
+	l := b.Len()
+	if start < 0 {
+		start = 0
+	}
+	if start > l {
+		start = l
+	}
+	if end > l {
+		end = l
+	}
+	if end < start {
+		end = start
+	}
+	return start, end
+}
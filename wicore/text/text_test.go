@@ -0,0 +1,144 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package text
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/maruel/ut"
+)
+
+// checkTree verifies the tree invariants.
+func checkTree(t *testing.T, n *node) {
+	if n == nil || n.height == 0 {
+		return
+	}
+	d := n.left.height - n.right.height
+	ut.AssertEqual(t, true, d >= -1 && d <= 1)
+	ut.AssertEqual(t, n.left.length+n.right.length, n.length)
+	ut.AssertEqual(t, n.left.lines+n.right.lines, n.lines)
+	checkTree(t, n.left)
+	checkTree(t, n.right)
+}
+
+func TestEmpty(t *testing.T) {
+	b := Buffer{}
+	ut.AssertEqual(t, 0, b.Len())
+	ut.AssertEqual(t, 1, b.LineCount())
+	ut.AssertEqual(t, "", b.Line(0))
+	ut.AssertEqual(t, 0, b.LineStart(1))
+	ut.AssertEqual(t, 0, b.LineAt(10))
+	ut.AssertEqual(t, "", b.Delete(0, 10).String())
+}
+
+func TestLines(t *testing.T) {
+	b := NewString("foo\nbär\n\nbaz")
+	ut.AssertEqual(t, 4, b.LineCount())
+	ut.AssertEqual(t, 12, b.RuneCount())
+	ut.AssertEqual(t, "foo", b.Line(0))
+	ut.AssertEqual(t, "bär", b.Line(1))
+	ut.AssertEqual(t, "", b.Line(2))
+	ut.AssertEqual(t, "baz", b.Line(3))
+	ut.AssertEqual(t, 4, b.LineStart(1))
+	ut.AssertEqual(t, 8, b.LineEnd(1))
+	ut.AssertEqual(t, 1, b.LineAt(5))
+	ut.AssertEqual(t, 3, b.LineAt(b.Len()))
+	ut.AssertEqual(t, 7, b.RuneOffset(6))
+	ut.AssertEqual(t, 6, b.RuneIndex(7))
+}
+
+func TestSnapshot(t *testing.T) {
+	a := NewString("hello world")
+	b := a.InsertString(5, ",")
+	c := b.Delete(0, 7)
+	ut.AssertEqual(t, "hello world", a.String())
+	ut.AssertEqual(t, "hello, world", b.String())
+	ut.AssertEqual(t, "world", c.String())
+	ut.AssertEqual(t, "lo, w", b.Slice(3, 8).String())
+}
+
+func TestReadWrite(t *testing.T) {
+	data := strings.Repeat("0123456789\n", 2000)
+	b := NewString(data)
+	checkTree(t, b.root)
+	out := &bytes.Buffer{}
+	n, err := b.WriteTo(out)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, int64(len(data)), n)
+	ut.AssertEqual(t, data, out.String())
+
+	p := make([]byte, 20)
+	i, err := b.ReadAt(p, int64(len(data)-10))
+	ut.AssertEqual(t, io.EOF, err)
+	ut.AssertEqual(t, 10, i)
+	ut.AssertEqual(t, "123456789\n", string(p[:i]))
+}
+
+func TestRandomEdits(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	expected := []byte(strings.Repeat("abc\ndéf\n", 3000))
+	b := New(append([]byte{}, expected...))
+	for i := 0; i < 2000; i++ {
+		offset := r.Intn(len(expected) + 1)
+		for offset < len(expected) && expected[offset]&0xC0 == 0x80 {
+			offset++
+		}
+		if r.Intn(3) == 0 {
+			end := offset + r.Intn(20)
+			if end > len(expected) {
+				end = len(expected)
+			}
+			for end < len(expected) && expected[end]&0xC0 == 0x80 {
+				end++
+			}
+			b = b.Delete(offset, end)
+			expected = append(expected[:offset], expected[end:]...)
+		} else {
+			s := []byte("x\ny")[:1+r.Intn(3)]
+			b = b.Insert(offset, s)
+			expected = append(expected[:offset], append(append([]byte{}, s...), expected[offset:]...)...)
+		}
+	}
+	checkTree(t, b.root)
+	ut.AssertEqual(t, string(expected), b.String())
+	ut.AssertEqual(t, bytes.Count(expected, newLine)+1, b.LineCount())
+	lines := strings.Split(string(expected), "\n")
+	for i, l := range lines {
+		ut.AssertEqualIndex(t, i, l, b.Line(i))
+	}
+}
+
+func TestSource(t *testing.T) {
+	// Make sure a multi-bytes sequence crosses the leaves and the Load() calls.
+	data := strings.Repeat("0123456789\n", 10000) + strings.Repeat("é", lazyLeaf)
+	s := NewSource(strings.NewReader(data))
+	var b Buffer
+	for {
+		chunk, err := s.Load(int64(b.Len()), 100001)
+		ut.AssertEqual(t, nil, err)
+		if chunk.Len() == 0 {
+			break
+		}
+		b = b.Concat(chunk)
+	}
+	checkTree(t, b.root)
+	ut.AssertEqual(t, data, b.String())
+	ut.AssertEqual(t, 10001, b.LineCount())
+	ut.AssertEqual(t, utf8.RuneCountInString(data), b.RuneCount())
+	ut.AssertEqual(t, "0123456789", b.Line(5000))
+	ut.AssertEqual(t, 5000, b.LineAt(b.LineStart(5000)))
+	ut.AssertEqual(t, len(data)-2, b.RuneOffset(b.RuneCount()-1))
+
+	// Edits split the lazy leaves.
+	e := b.InsertString(60, "x").Delete(len(data)-4, len(data)-2)
+	ut.AssertEqual(t, data[:60]+"x"+data[60:len(data)-4]+data[len(data)-2:], e.String())
+	ut.AssertEqual(t, "01234x56789", e.Line(5))
+	ut.AssertEqual(t, nil, s.Err())
+}
@@ -42,6 +42,20 @@ func GetKeyBindingCommand(e Editor, mode KeyboardMode, key key.Press) string {
 	}
 }
 
+// GetKeyBindingSequence traverses the Window hierarchy tree to find the
+// command bound to a sequence of keys. more is true if a longer sequence
+// starting with these keys is bound in any View of the hierarchy.
+func GetKeyBindingSequence(e Editor, mode KeyboardMode, keys []key.Press) (cmdName string, more bool) {
+	for active := e.ActiveWindow(); active != nil; active = active.Parent() {
+		name, m := active.View().KeyBindings().GetSequence(mode, keys)
+		if cmdName == "" {
+			cmdName = name
+		}
+		more = more || m
+	}
+	return
+}
+
 // RootWindow returns the root Window when given any Window in the tree.
 func RootWindow(w Window) Window {
 	for {